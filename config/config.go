@@ -0,0 +1,134 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Config is read from a JSON file, e.g.
+//
+//	{
+//	  "connectors": [
+//	    {
+//	      "schema": "devops",
+//	      "type": "devops",
+//	      "url": "https://dev.azure.com/my-organisation",
+//	      "pat": "my-personal-access-token",
+//	      "concurrency": 4,
+//	      "cacheTtl": { "projects": "1h", "pipelines": "10m" },
+//	      "caseSensitive": { "builds": ["sourcebranch"], "branchpolicies": ["branch"] }
+//	    }
+//	  ],
+//	  "http": {
+//	    "requestsPerSecond": 10,
+//	    "burst": 20,
+//	    "maxRetries": 5
+//	  },
+//	  "mirror": {
+//	    "dir": ".devopsdb",
+//	    "tables": [
+//	      { "table": "devops.builds", "dateColumn": "finishtime", "keyColumn": "id", "days": 90 }
+//	    ]
+//	  },
+//	  "timeZone": "Europe/London"
+//	}
+type Config struct {
+	Connectors []ConnectorConfig `json:"connectors"`
+	Http       HttpConfig        `json:"http"`
+	Mirror     MirrorConfig      `json:"mirror"`
+
+	// Where dates in queries without a time zone are (e.g. timestamp '2022-01-31 09:00'),
+	// as an IANA name. The default is UTC
+	TimeZone string `json:"timeZone"`
+}
+
+// Location returns the time zone, or UTC if there isn't one
+func (c Config) Location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(c.TimeZone)
+}
+
+type ConnectorConfig struct {
+	Schema string `json:"schema"` // The name to use for the connector in queries (e.g. 'devops' in 'devops.projects')
+	Type   string `json:"type"`   // Which connector to use (only 'devops' so far)
+	Url    string `json:"url"`
+	Pat    string `json:"pat"`
+
+	// How many calls the engine can make to the connector at the same time
+	Concurrency int `json:"concurrency"`
+
+	// How long to keep each table's results before asking the connector again.
+	// Tables that aren't listed aren't cached
+	CacheTtl map[string]Duration `json:"cacheTtl"`
+
+	// The columns of each table that are compared with case (e.g. so 'Main' and 'main'
+	// are different branches). Every other column ignores case
+	CaseSensitive map[string][]string `json:"caseSensitive"`
+}
+
+// Duration is written in config as a string like "90s" or "1h30m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	err := json.Unmarshal(data, &text)
+	if err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+// CacheTtls returns the TTLs as time.Durations, keyed on table name
+func (c ConnectorConfig) CacheTtls() map[string]time.Duration {
+	ttls := make(map[string]time.Duration, len(c.CacheTtl))
+	for table, ttl := range c.CacheTtl {
+		ttls[table] = time.Duration(ttl)
+	}
+	return ttls
+}
+
+// HttpConfig controls how the connectors' calls to their APIs are throttled and retried.
+// Anything left out (or zero) uses the default
+type HttpConfig struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"` // Per host
+	Burst             int     `json:"burst"`
+	MaxRetries        int     `json:"maxRetries"`
+}
+
+// MirrorConfig lists the tables that 'sync' copies to disk, so they can be queried offline
+type MirrorConfig struct {
+	Dir    string              `json:"dir"` // Where the copies are kept (default '.devopsdb')
+	Tables []MirrorTableConfig `json:"tables"`
+}
+
+type MirrorTableConfig struct {
+	Table      string `json:"table"`      // The schema and table, e.g. 'devops.builds'
+	DateColumn string `json:"dateColumn"` // Used to fetch only new rows, and to drop old ones
+	KeyColumn  string `json:"keyColumn"`  // Identifies a row, so updated rows replace the old copy
+	Days       int    `json:"days"`       // How many days of rows to keep (0 keeps everything)
+}
+
+func Load(path string) (*Config, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	err = json.Unmarshal(contents, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadsConnectors(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "devopsdb.json")
+	os.WriteFile(path, []byte(`{
+		"connectors": [
+			{ "schema": "devops", "type": "devops", "url": "https://dev.azure.com/org", "pat": "secret", "concurrency": 4 }
+		]
+	}`), 0600)
+
+	config, err := Load(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ConnectorConfig{
+		{Schema: "devops", Type: "devops", Url: "https://dev.azure.com/org", Pat: "secret", Concurrency: 4},
+	}, config.Connectors)
+}
+
+func TestReturnsErrorForMissingFile(t *testing.T) {
+
+	_, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+
+	assert.NotNil(t, err)
+}
+
+func TestLoadsHttpSettings(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "devopsdb.json")
+	os.WriteFile(path, []byte(`{
+		"connectors": [],
+		"http": { "requestsPerSecond": 2.5, "burst": 5, "maxRetries": 3 }
+	}`), 0600)
+
+	config, err := Load(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, HttpConfig{RequestsPerSecond: 2.5, Burst: 5, MaxRetries: 3}, config.Http)
+}
+
+func TestLoadsCacheTtls(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "devopsdb.json")
+	os.WriteFile(path, []byte(`{
+		"connectors": [
+			{ "schema": "devops", "type": "devops", "cacheTtl": { "projects": "1h", "pipelines": "90s" } }
+		]
+	}`), 0600)
+
+	config, err := Load(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]time.Duration{
+		"projects":  time.Hour,
+		"pipelines": 90 * time.Second,
+	}, config.Connectors[0].CacheTtls())
+}
+
+func TestLoadsCaseSensitiveColumns(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "devopsdb.json")
+	os.WriteFile(path, []byte(`{
+		"connectors": [
+			{ "schema": "devops", "type": "devops", "caseSensitive": { "refs": ["name", "creator"] } }
+		]
+	}`), 0600)
+
+	config, err := Load(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"refs": {"name", "creator"}}, config.Connectors[0].CaseSensitive)
+}
+
+func TestReturnsErrorForInvalidCacheTtl(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "devopsdb.json")
+	os.WriteFile(path, []byte(`{
+		"connectors": [ { "schema": "devops", "cacheTtl": { "projects": "soon" } } ]
+	}`), 0600)
+
+	_, err := Load(path)
+
+	assert.NotNil(t, err)
+}
+
+func TestLoadsMirrorTables(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "devopsdb.json")
+	os.WriteFile(path, []byte(`{
+		"connectors": [],
+		"mirror": {
+			"dir": "mirror",
+			"tables": [ { "table": "devops.builds", "dateColumn": "finishtime", "keyColumn": "id", "days": 90 } ]
+		}
+	}`), 0600)
+
+	config, err := Load(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, MirrorConfig{
+		Dir: "mirror",
+		Tables: []MirrorTableConfig{
+			{Table: "devops.builds", DateColumn: "finishtime", KeyColumn: "id", Days: 90},
+		},
+	}, config.Mirror)
+}
+
+func TestLoadsTimeZone(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "devopsdb.json")
+	os.WriteFile(path, []byte(`{ "connectors": [], "timeZone": "Europe/London" }`), 0600)
+
+	config, err := Load(path)
+	assert.Nil(t, err)
+
+	location, err := config.Location()
+	assert.Nil(t, err)
+	assert.Equal(t, "Europe/London", location.String())
+
+	location, err = Config{}.Location()
+	assert.Nil(t, err)
+	assert.Equal(t, time.UTC, location)
+
+	_, err = Config{TimeZone: "Nowhere/Special"}.Location()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,132 @@
+package connectors
+
+import (
+	"devopsdb/models"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// NewCachingConnector remembers the rows the connector returns for each query, and
+// returns them again for the same query until they're older than the table's TTL.
+// Tables without a TTL aren't cached.
+//
+// Queries are the same if everything passed to the connector is the same (table,
+// columns, top, pushed-down filters and required filters). Filters the engine
+// applies itself don't matter, as they're applied to the cached rows too
+func NewCachingConnector(connector Connector, ttls map[string]time.Duration) Connector {
+	return &cachingConnector{
+		Connector: connector,
+		ttls:      ttls,
+		entries:   make(map[string]cacheEntry),
+		now:       time.Now,
+	}
+}
+
+type cachingConnector struct {
+	Connector
+
+	ttls map[string]time.Duration
+	now  func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	rows    models.ResultTable
+	expires time.Time
+}
+
+func (c *cachingConnector) Get(query ConnectorQuery) models.RowIterator {
+	ttl := c.ttls[query.TableName]
+	if ttl <= 0 {
+		return c.Connector.Get(query)
+	}
+
+	key, err := cacheKey(query)
+	if err != nil {
+		return c.Connector.Get(query)
+	}
+
+	if rows, found := c.lookup(key); found {
+		return models.NewTableIterator(rows)
+	}
+
+	return &cachingIterator{
+		rows: c.Connector.Get(query),
+		store: func(rows models.ResultTable) {
+			c.store(key, rows, ttl)
+		},
+	}
+}
+
+func (c *cachingConnector) lookup(key string) (models.ResultTable, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.rows, true
+}
+
+func (c *cachingConnector) store(key string, rows models.ResultTable, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Entries are only removed when they're looked up, so the ones for queries that aren't
+	// run again (e.g. each batch of a lookup join) are removed here once they've expired
+	now := c.now()
+	for other, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, other)
+		}
+	}
+
+	c.entries[key] = cacheEntry{rows: rows, expires: now.Add(ttl)}
+}
+
+// Maps are marshalled with their keys in order, so the same query always gives the same key
+func cacheKey(query ConnectorQuery) (string, error) {
+	key, err := json.Marshal(query)
+	return string(key), err
+}
+
+// cachingIterator passes rows through as they're read, and only stores them once the
+// caller has read all of them. If the caller stops early or there's an error we don't
+// know what the rest of the rows would have been, so nothing is cached
+type cachingIterator struct {
+	rows  models.RowIterator
+	store func(rows models.ResultTable)
+	seen  models.ResultTable
+}
+
+func (it *cachingIterator) Next() (map[string]string, error) {
+	row, err := it.rows.Next()
+	if err == io.EOF && it.store != nil {
+		it.store(it.seen)
+		it.store = nil
+	}
+	if err != nil {
+		it.store = nil
+		return row, err
+	}
+
+	it.seen = append(it.seen, row)
+	return row, nil
+}
+
+func (it *cachingIterator) Close() {
+	it.store = nil
+	it.seen = nil
+	it.rows.Close()
+}
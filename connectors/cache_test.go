@@ -0,0 +1,112 @@
+package connectors
+
+import (
+	"devopsdb/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingConnector struct {
+	calls int
+	rows  models.ResultTable
+}
+
+func (c *countingConnector) GetSchemaForTable(table string) ([]string, error) {
+	return []string{"name"}, nil
+}
+func (c *countingConnector) GetRequiredFiltersForTable(table string) []RequiredFilter {
+	return nil
+}
+func (c *countingConnector) SupportsFilter(table string, filter models.QueryFilter) bool {
+	return false
+}
+func (c *countingConnector) Get(query ConnectorQuery) models.RowIterator {
+	c.calls++
+	return models.NewTableIterator(c.rows)
+}
+
+func newTestCache(ttls map[string]time.Duration) (*cachingConnector, *countingConnector, *time.Time) {
+	inner := &countingConnector{rows: models.ResultTable{{"name": "a"}, {"name": "b"}}}
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cache := NewCachingConnector(inner, ttls).(*cachingConnector)
+	cache.now = func() time.Time { return now }
+
+	return cache, inner, &now
+}
+
+func TestCacheReturnsStoredRowsForTheSameQuery(t *testing.T) {
+
+	cache, inner, _ := newTestCache(map[string]time.Duration{"projects": time.Minute})
+	query := ConnectorQuery{TableName: "projects", RequiredFilters: map[string]string{"org": "x"}}
+
+	models.Collect(cache.Get(query))
+	results, err := models.Collect(cache.Get(query))
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"name": "a"}, {"name": "b"}}, results)
+	assert.Equal(t, 1, inner.calls)
+}
+
+func TestCacheCallsConnectorForDifferentQueries(t *testing.T) {
+
+	cache, inner, _ := newTestCache(map[string]time.Duration{"projects": time.Minute})
+
+	models.Collect(cache.Get(ConnectorQuery{TableName: "projects", RequiredFilters: map[string]string{"org": "x"}}))
+	models.Collect(cache.Get(ConnectorQuery{TableName: "projects", RequiredFilters: map[string]string{"org": "y"}}))
+	models.Collect(cache.Get(ConnectorQuery{TableName: "projects", Filters: []models.QueryFilter{
+		{Type: "eq", FieldName: "name", Value: "a"},
+	}}))
+
+	assert.Equal(t, 3, inner.calls)
+}
+
+func TestCacheExpiresAfterTtl(t *testing.T) {
+
+	cache, inner, now := newTestCache(map[string]time.Duration{"projects": time.Minute})
+	query := ConnectorQuery{TableName: "projects"}
+
+	models.Collect(cache.Get(query))
+	*now = now.Add(time.Minute)
+	models.Collect(cache.Get(query))
+
+	assert.Equal(t, 2, inner.calls)
+}
+
+func TestCacheRemovesExpiredEntriesWhenStoring(t *testing.T) {
+
+	cache, _, now := newTestCache(map[string]time.Duration{"projects": time.Minute})
+
+	models.Collect(cache.Get(ConnectorQuery{TableName: "projects", RequiredFilters: map[string]string{"org": "x"}}))
+	models.Collect(cache.Get(ConnectorQuery{TableName: "projects", RequiredFilters: map[string]string{"org": "y"}}))
+	*now = now.Add(time.Minute)
+	models.Collect(cache.Get(ConnectorQuery{TableName: "projects", RequiredFilters: map[string]string{"org": "z"}}))
+
+	assert.Equal(t, 1, len(cache.entries))
+}
+
+func TestCacheIgnoresTablesWithoutTtl(t *testing.T) {
+
+	cache, inner, _ := newTestCache(map[string]time.Duration{"projects": time.Minute})
+	query := ConnectorQuery{TableName: "pipelines"}
+
+	models.Collect(cache.Get(query))
+	models.Collect(cache.Get(query))
+
+	assert.Equal(t, 2, inner.calls)
+}
+
+func TestCacheDoesNotStorePartiallyReadResults(t *testing.T) {
+
+	cache, inner, _ := newTestCache(map[string]time.Duration{"projects": time.Minute})
+	query := ConnectorQuery{TableName: "projects"}
+
+	rows := cache.Get(query)
+	rows.Next()
+	rows.Close()
+	models.Collect(cache.Get(query))
+
+	assert.Equal(t, 2, inner.calls)
+}
@@ -3,6 +3,33 @@ package connectors
 import "devopsdb/models"
 
 type Connector interface {
-	GetSchemaForTable(table string) []string
-	Get(query ConnectorQuery) models.ResultTable
+	// GetSchemaForTable returns the table's columns, or nil if there's no such table
+	GetSchemaForTable(table string) ([]string, error)
+	GetRequiredFiltersForTable(table string) []RequiredFilter
+
+	// SupportsFilter says whether the connector fully applies the filter itself (e.g. by
+	// passing it to the API), in which case it will be passed in ConnectorQuery.Filters.
+	// Anything not supported is applied by the engine to the rows the connector returns.
+	// Filters can be on a function of the columns (e.g. lower(name) = 'main'), in which case
+	// filter.Expression says what it is, so connectors can say which functions they support
+	// They can also compare with other columns (e.g. finishtime > queuetime), in which case
+	// filter.ValueExpression is set rather than filter.Value
+	SupportsFilter(table string, filter models.QueryFilter) bool
+
+	// Get returns the table's rows as they're read from the source. Errors talking
+	// to the source are returned from the iterator
+	Get(query ConnectorQuery) models.RowIterator
+}
+
+// RequiredFilter is a field that a table can't be queried without (usually because
+// the underlying API needs it in the URL), e.g. DevOps pipelines can only be listed
+// one project at a time.
+//
+// If the query doesn't restrict the field to a set of values, the engine can find
+// every possible value by reading SourceColumn from SourceTable and query each one
+// in turn. If there's no SourceTable, the query fails instead
+type RequiredFilter struct {
+	FieldName    string
+	SourceTable  string
+	SourceColumn string
 }
@@ -1,9 +1,7 @@
 package connectors
 
 import (
-	"context"
 	"devopsdb/models"
-	"log"
 	"strconv"
 
 	"github.com/microsoft/azure-devops-go-api/azuredevops"
@@ -23,119 +21,147 @@ func CreateDevopsClient(apiUrl string, pat string) *DevOpsClient {
 	}
 }
 
-func (client *DevOpsClient) GetSchemaForTable(table string) []string {
+func (client *DevOpsClient) GetSchemaForTable(table string) ([]string, error) {
 	if table == "projects" {
-		return []string{"name", "url"}
+		return []string{"name", "url"}, nil
 	}
 
 	if table == "pipelines" {
-		return []string{"id", "project", "folder", "name", "url"}
+		return []string{"id", "project", "folder", "name", "url"}, nil
 	}
 
-	return []string(nil)
-}
+	if table == "builds" {
+		return []string{"id", "project", "definition", "number", "status", "result", "reason", "requestedfor", "sourcebranch", "queuetime", "starttime", "finishtime", "url"}, nil
+	}
 
-func (client *DevOpsClient) Get(query ConnectorQuery) models.ResultTable {
-	if query.TableName == "projects" {
-		result := client.getProjects(query)
+	// The branch is without 'refs/heads/' (e.g. 'main'), and is the start of the branches'
+	// names when the matchkind is 'Prefix' (e.g. 'release/')
+	if table == "branchpolicies" {
+		return []string{"id", "project", "repository", "branch", "matchkind", "policytype", "enabled", "blocking", "settings"}, nil
+	}
 
-		result = models.OnlyColumns(result, query.ColumnNames)
-		return result
+	// The default branch is without 'refs/heads/', like the branches of branch policies
+	if table == "repositories" {
+		return []string{"id", "project", "name", "defaultbranch", "isfork", "size", "url"}, nil
 	}
 
-	if query.TableName == "pipelines" {
-		result := client.getPipelines(query)
+	if table == "repositorypermissions" {
+		return []string{"project", "repository", "identity", "permission", "access"}, nil
+	}
 
-		result = models.OnlyColumns(result, query.ColumnNames)
-		return result
+	return []string(nil), nil
+}
+
+func (client *DevOpsClient) GetRequiredFiltersForTable(table string) []RequiredFilter {
+	// Everything inside a project can only be listed one project at a time
+	if table == "pipelines" || table == "builds" || table == "repositories" || table == "branchpolicies" || table == "repositorypermissions" {
+		return []RequiredFilter{
+			{FieldName: "project", SourceTable: "projects", SourceColumn: "name"},
+		}
 	}
 
-	return models.ResultTable{}
+	return []RequiredFilter(nil)
 }
 
-func (client *DevOpsClient) getProjects(query ConnectorQuery) models.ResultTable {
-	connection := azuredevops.NewPatConnection(client.ApiUrl, client.Pat)
+func (client *DevOpsClient) SupportsFilter(table string, filter models.QueryFilter) bool {
+	// We only ever ask the API for the project(s) the query asks for, so the
+	// rows we return will always match that filter. The API ignores case, so the
+	// engine checks the case of the names if the filter doesn't
+	for _, required := range client.GetRequiredFiltersForTable(table) {
+		if filter.FieldName == required.FieldName && (filter.Type == "eq" || filter.Type == "in") && filter.ValueExpression == nil && !filter.IsCaseSensitive() {
+			return true
+		}
+	}
 
-	ctx := context.Background()
+	// Times and ids don't have a case
+	if table == "builds" && (isBuildsTimeFilter(filter) || isBuildsIdFilter(filter)) {
+		return true
+	}
 
-	coreClient, err := core.NewClient(ctx, connection)
-	if err != nil {
-		log.Fatal(err)
+	// Nothing else can be passed to the API (yet)
+	return false
+}
+
+func (client *DevOpsClient) Get(query ConnectorQuery) models.RowIterator {
+	if query.TableName == "projects" {
+		return models.NewColumnsIterator(client.getProjects(query), query.ColumnNames)
 	}
 
-	responseValue, err := coreClient.GetProjects(ctx, core.GetProjectsArgs{})
-	if err != nil {
-		log.Fatal(err)
+	if query.TableName == "pipelines" {
+		return models.NewColumnsIterator(client.getPipelines(query), query.ColumnNames)
 	}
 
-	var results models.ResultTable
+	if query.TableName == "builds" {
+		return models.NewColumnsIterator(client.getBuilds(query), query.ColumnNames)
+	}
 
-	index := 0
-	for responseValue != nil {
-		for _, teamProjectReference := range (*responseValue).Value {
-			results = append(results, map[string]string{
-				"name": *teamProjectReference.Name,
-				"url":  *teamProjectReference.Url,
-			})
-			index++
-		}
+	if query.TableName == "repositories" {
+		return models.NewColumnsIterator(client.getRepositories(query), query.ColumnNames)
+	}
 
-		if responseValue.ContinuationToken != "" {
-			projectArgs := core.GetProjectsArgs{
-				ContinuationToken: &responseValue.ContinuationToken,
-			}
-			responseValue, err = coreClient.GetProjects(ctx, projectArgs)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			responseValue = nil
-		}
+	if query.TableName == "branchpolicies" {
+		return models.NewColumnsIterator(client.getBranchPolicies(query), query.ColumnNames)
 	}
 
-	for _, filter := range query.Filters {
-		results = filter.Filter(results)
+	if query.TableName == "repositorypermissions" {
+		return models.NewColumnsIterator(client.getRepositoryPermissions(query), query.ColumnNames)
 	}
 
-	return results
+	return models.NewTableIterator(models.ResultTable{})
 }
 
-func (client *DevOpsClient) getPipelines(query ConnectorQuery) models.ResultTable {
+func (client *DevOpsClient) getProjects(query ConnectorQuery) models.RowIterator {
 	connection := azuredevops.NewPatConnection(client.ApiUrl, client.Pat)
 
-	// Must have a 'project' filter or bomb.. this is an API restriction
-	projectFilter := ""
-	for _, filter := range query.Filters {
-		if filter.Type == "eq" && filter.FieldName == "project" {
-			projectFilter = filter.Value
+	ctx := queryContext(query)
+
+	return newPagedIterator(query.Top, func(continuationToken string) (models.ResultTable, string, error) {
+		coreClient, err := core.NewClient(ctx, connection)
+		if err != nil {
+			return nil, "", err
 		}
-	}
-	
-	// TODO: This should also check for the 'project' field in top-level AND conditions, which would also 
-	// allow a valid API call
-	if projectFilter == "" {
-		log.Fatal("Cannot search Pipelines without passing a 'equals' filter for 'project'. This is a restriction of the DevOps API.")
-	}
 
-	ctx := context.Background()
+		responseValue, err := coreClient.GetProjects(ctx, core.GetProjectsArgs{
+			ContinuationToken: continuationTokenArgument(continuationToken),
+			Top:               topArgument(query),
+		})
+		if err != nil {
+			return nil, "", err
+		}
 
-	pipelineClient := pipelines.NewClient(ctx, connection)
+		var results models.ResultTable
+		for _, teamProjectReference := range responseValue.Value {
+			results = append(results, map[string]string{
+				"name": *teamProjectReference.Name,
+				"url":  *teamProjectReference.Url,
+			})
+		}
 
-	args := pipelines.ListPipelinesArgs{
-		Project: &projectFilter,
-	}
+		return results, responseValue.ContinuationToken, nil
+	})
+}
 
-	// This should handle 'where' clauses etc.
-	responseValue, err := pipelineClient.ListPipelines(ctx, args)
-	if err != nil {
-		log.Fatal(err)
-	}
+func (client *DevOpsClient) getPipelines(query ConnectorQuery) models.RowIterator {
+	connection := azuredevops.NewPatConnection(client.ApiUrl, client.Pat)
+
+	projectFilter := query.RequiredFilters["project"]
+
+	ctx := queryContext(query)
+
+	pipelineClient := pipelines.NewClient(ctx, connection)
 
-	var results models.ResultTable
+	return newPagedIterator(query.Top, func(continuationToken string) (models.ResultTable, string, error) {
+		responseValue, err := pipelineClient.ListPipelines(ctx, pipelines.ListPipelinesArgs{
+			ContinuationToken: continuationTokenArgument(continuationToken),
+			Project:           &projectFilter,
+			Top:               topArgument(query),
+		})
+		if err != nil {
+			return nil, "", err
+		}
 
-	index := 0
-	for responseValue != nil {
-		for _, pipelineRef := range (*responseValue).Value {
+		var results models.ResultTable
+		for _, pipelineRef := range responseValue.Value {
 			results = append(results, map[string]string{
 				"id":      strconv.Itoa(*pipelineRef.Id),
 				"project": projectFilter,
@@ -143,22 +169,25 @@ func (client *DevOpsClient) getPipelines(query ConnectorQuery) models.ResultTabl
 				"name":    *pipelineRef.Name,
 				"url":     *pipelineRef.Url,
 			})
-			index++
 		}
 
-		if responseValue.ContinuationToken != "" {
-			args := pipelines.ListPipelinesArgs{
-				ContinuationToken: &responseValue.ContinuationToken,
-				Project:           &projectFilter,
-			}
-			responseValue, err = pipelineClient.ListPipelines(ctx, args)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			responseValue = nil
-		}
+		return results, responseValue.ContinuationToken, nil
+	})
+}
+
+// The 'top' argument for an API call, which is only set if the engine told us
+// how many rows it needs
+func topArgument(query ConnectorQuery) *int {
+	if query.Top == 0 {
+		return nil
 	}
+	return &query.Top
+}
 
-	return results
+// The API wants no continuation token at all for the first page
+func continuationTokenArgument(continuationToken string) *string {
+	if continuationToken == "" {
+		return nil
+	}
+	return &continuationToken
 }
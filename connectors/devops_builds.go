@@ -0,0 +1,246 @@
+package connectors
+
+import (
+	"devopsdb/models"
+	"strconv"
+	"time"
+
+	"github.com/microsoft/azure-devops-go-api/azuredevops"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/build"
+)
+
+// The columns the builds API can filter by with its 'minTime' and 'maxTime' arguments, in
+// order of preference (it can only use one at a time), and the order it needs the builds in
+// to do it
+var buildsTimeColumns = []struct {
+	column string
+	order  build.BuildQueryOrder
+}{
+	{"finishtime", build.BuildQueryOrderValues.FinishTimeAscending},
+	{"starttime", build.BuildQueryOrderValues.StartTimeAscending},
+	{"queuetime", build.BuildQueryOrderValues.QueueTimeAscending},
+}
+
+// Whether the filter can be turned in to the 'minTime' or 'maxTime' argument of the builds API
+func isBuildsTimeFilter(filter models.QueryFilter) bool {
+	if filter.Type != "gt" && filter.Type != "ge" && filter.Type != "lt" && filter.Type != "le" {
+		return false
+	}
+
+	// A time truncated to a unit is never after the time itself, so the API can find the
+	// builds after it, e.g. date_trunc('day', finishtime) >= '2022-03-01'
+	column, truncated := buildsTimeFilterColumn(filter)
+	if truncated && filter.Type != "gt" && filter.Type != "ge" {
+		return false
+	}
+
+	for _, timeColumn := range buildsTimeColumns {
+		if column == timeColumn.column {
+			_, err := parseTime(filter.Value)
+			return err == nil
+		}
+	}
+	return false
+}
+
+// The column the filter compares, and whether it's truncated with date_trunc first
+func buildsTimeFilterColumn(filter models.QueryFilter) (string, bool) {
+	if filter.Expression == nil {
+		return filter.FieldName, false
+	}
+
+	expression := filter.Expression
+	if expression.Type != "function" || expression.Function != "date_trunc" || len(expression.Arguments) != 2 ||
+		expression.Arguments[0].Type != "value" || expression.Arguments[1].Type != "column" {
+		return "", false
+	}
+	return expression.Arguments[1].FieldName, true
+}
+
+// Whether the filter can be turned in to the 'buildIds' argument of the builds API, which
+// lets a join look builds up by their ids
+func isBuildsIdFilter(filter models.QueryFilter) bool {
+	if filter.FieldName != "id" || (filter.Type != "eq" && filter.Type != "in") {
+		return false
+	}
+	_, found := buildIds([]models.QueryFilter{filter})
+	return found
+}
+
+// The API can stop after as many builds as the engine wants, but only if it applies every
+// filter exactly. Otherwise some of those builds might be filtered out below, and we'd return
+// fewer than there are, so we leave it to the engine to stop reading once it has enough
+func buildsTop(query ConnectorQuery) int {
+	for _, filter := range query.Filters {
+		if !isBuildsIdFilter(filter) {
+			return 0
+		}
+	}
+	return query.Top
+}
+
+func (client *DevOpsClient) getBuilds(query ConnectorQuery) models.RowIterator {
+	connection := azuredevops.NewPatConnection(client.ApiUrl, client.Pat)
+
+	query.Top = buildsTop(query)
+
+	projectFilter := query.RequiredFilters["project"]
+
+	ctx := queryContext(query)
+
+	args := build.GetBuildsArgs{
+		Project: &projectFilter,
+		Top:     topArgument(query),
+	}
+
+	// The API only filters by a time if the builds are ordered by it. It's also slightly
+	// less precise than we are (e.g. 'after' vs. 'on or after'), and can only use one of
+	// the time columns, so the filters are checked again below
+	if timeRange, found := buildsTimeRange(query.Filters); found {
+		args.QueryOrder = &timeRange.order
+		if timeRange.min != nil {
+			args.MinTime = &azuredevops.Time{Time: *timeRange.min}
+		}
+		if timeRange.max != nil {
+			args.MaxTime = &azuredevops.Time{Time: *timeRange.max}
+		}
+	}
+
+	if ids, found := buildIds(query.Filters); found {
+		args.BuildIds = &ids
+	}
+
+	rows := newPagedIterator(query.Top, func(continuationToken string) (models.ResultTable, string, error) {
+		buildClient, err := build.NewClient(ctx, connection)
+		if err != nil {
+			return nil, "", err
+		}
+
+		args.ContinuationToken = continuationTokenArgument(continuationToken)
+
+		responseValue, err := buildClient.GetBuilds(ctx, args)
+		if err != nil {
+			return nil, "", err
+		}
+
+		var results models.ResultTable
+		for _, b := range responseValue.Value {
+			row := map[string]string{
+				"id":           strconv.Itoa(*b.Id),
+				"project":      projectFilter,
+				"number":       stringValue(b.BuildNumber),
+				"sourcebranch": stringValue(b.SourceBranch),
+				"queuetime":    formatTime(b.QueueTime),
+				"starttime":    formatTime(b.StartTime),
+				"finishtime":   formatTime(b.FinishTime),
+				"url":          stringValue(b.Url),
+			}
+
+			if b.Definition != nil {
+				row["definition"] = stringValue(b.Definition.Name)
+			}
+			if b.Status != nil {
+				row["status"] = string(*b.Status)
+			}
+			if b.Result != nil {
+				row["result"] = string(*b.Result)
+			}
+			if b.Reason != nil {
+				row["reason"] = string(*b.Reason)
+			}
+			if b.RequestedFor != nil {
+				row["requestedfor"] = stringValue(b.RequestedFor.DisplayName)
+			}
+
+			results = append(results, row)
+		}
+
+		return results, responseValue.ContinuationToken, nil
+	})
+
+	return models.NewFilterIterator(rows, query.Filters)
+}
+
+type buildsTimes struct {
+	order build.BuildQueryOrder
+	min   *time.Time // The latest of the minimum times the filters ask for
+	max   *time.Time // .. and the earliest of the maximums
+}
+
+// The range of times the filters ask for, on the first of the time columns that they
+// filter at all
+func buildsTimeRange(filters []models.QueryFilter) (buildsTimes, bool) {
+	for _, timeColumn := range buildsTimeColumns {
+		result := buildsTimes{order: timeColumn.order}
+
+		for _, filter := range filters {
+			if column, _ := buildsTimeFilterColumn(filter); column != timeColumn.column || !isBuildsTimeFilter(filter) {
+				continue
+			}
+
+			value, _ := parseTime(filter.Value)
+			if (filter.Type == "gt" || filter.Type == "ge") && (result.min == nil || value.After(*result.min)) {
+				result.min = &value
+			}
+			if (filter.Type == "lt" || filter.Type == "le") && (result.max == nil || value.Before(*result.max)) {
+				result.max = &value
+			}
+		}
+
+		if result.min != nil || result.max != nil {
+			return result, true
+		}
+	}
+
+	return buildsTimes{}, false
+}
+
+// The ids the filters restrict the builds to, if they're all numbers (which they'd need
+// to be to match anything)
+func buildIds(filters []models.QueryFilter) ([]int, bool) {
+	values, restricted := models.ValuesForField(filters, "id")
+	if !restricted {
+		return nil, false
+	}
+
+	ids := []int{}
+	for _, value := range values {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// Dates are returned in ISO 8601 format in UTC, so they can be compared as text
+func formatTime(value *azuredevops.Time) string {
+	if value == nil {
+		return ""
+	}
+	return value.Time.UTC().Format(time.RFC3339)
+}
+
+// Accepts dates in the format we return them, or just the date part
+func parseTime(value string) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return parsed, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func intValue(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
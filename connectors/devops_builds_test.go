@@ -0,0 +1,127 @@
+package connectors
+
+import (
+	"devopsdb/models"
+	"testing"
+	"time"
+
+	"github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildsTimeRangeUsesTheNarrowestFinishTimeFilters(t *testing.T) {
+
+	timeRange, found := buildsTimeRange([]models.QueryFilter{
+		{Type: "eq", FieldName: "project", Value: "a"},
+		{Type: "ge", FieldName: "finishtime", Value: "2022-01-01"},
+		{Type: "gt", FieldName: "finishtime", Value: "2022-02-01T09:30:00Z"},
+		{Type: "lt", FieldName: "finishtime", Value: "2022-03-01"},
+		{Type: "le", FieldName: "finishtime", Value: "2022-04-01"},
+		{Type: "ge", FieldName: "starttime", Value: "2022-01-15"},
+	})
+
+	assert.True(t, found)
+	assert.Equal(t, build.BuildQueryOrderValues.FinishTimeAscending, timeRange.order)
+	assert.Equal(t, time.Date(2022, 2, 1, 9, 30, 0, 0, time.UTC), *timeRange.min)
+	assert.Equal(t, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), *timeRange.max)
+}
+
+func TestBuildsTimeRangeCanUseTheStartTime(t *testing.T) {
+
+	timeRange, found := buildsTimeRange([]models.QueryFilter{
+		{Type: "le", FieldName: "starttime", Value: "2022-03-01T00:00:00Z"},
+	})
+
+	assert.True(t, found)
+	assert.Equal(t, build.BuildQueryOrderValues.StartTimeAscending, timeRange.order)
+	assert.Nil(t, timeRange.min)
+	assert.Equal(t, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), *timeRange.max)
+}
+
+func TestTimeRangesArePassedToTheBuildsApi(t *testing.T) {
+
+	client := CreateDevopsClient("", "")
+
+	assert.True(t, client.SupportsFilter("builds", models.QueryFilter{Type: "ge", FieldName: "finishtime", Value: "2022-01-01"}))
+	assert.True(t, client.SupportsFilter("builds", models.QueryFilter{Type: "le", FieldName: "finishtime", Value: "2022-01-01"}))
+	assert.True(t, client.SupportsFilter("builds", models.QueryFilter{Type: "gt", FieldName: "queuetime", Value: "2022-01-01T09:00:00Z"}))
+	assert.False(t, client.SupportsFilter("builds", models.QueryFilter{Type: "eq", FieldName: "finishtime", Value: "2022-01-01"}))
+	assert.False(t, client.SupportsFilter("builds", models.QueryFilter{Type: "ge", FieldName: "finishtime", Value: "yesterday"}))
+	assert.False(t, client.SupportsFilter("pipelines", models.QueryFilter{Type: "ge", FieldName: "finishtime", Value: "2022-01-01"}))
+}
+
+// e.g. "where date_trunc('day', finishtime) >= '2022-03-01'", which can only be true for builds
+// that finished after then
+func TestTruncatedTimesArePassedToTheBuildsApi(t *testing.T) {
+
+	client := CreateDevopsClient("", "")
+	truncated := func(unit string, column string) *models.Expression {
+		return &models.Expression{Type: "function", Function: "date_trunc", Arguments: []models.Expression{
+			{Type: "value", Value: unit}, {Type: "column", FieldName: column},
+		}}
+	}
+
+	after := models.QueryFilter{Type: "ge", Value: "2022-03-01", Expression: truncated("day", "finishtime")}
+	assert.True(t, client.SupportsFilter("builds", after))
+	assert.False(t, client.SupportsFilter("builds", models.QueryFilter{Type: "le", Value: "2022-03-01", Expression: truncated("day", "finishtime")}))
+	assert.False(t, client.SupportsFilter("builds", models.QueryFilter{Type: "ge", Value: "2022-03-01", Expression: truncated("day", "result")}))
+	assert.False(t, client.SupportsFilter("builds", models.QueryFilter{Type: "ge", Value: "2022-03-01", Expression: &models.Expression{
+		Type: "function", Function: "lower", Arguments: []models.Expression{{Type: "column", FieldName: "finishtime"}},
+	}}))
+
+	timeRange, found := buildsTimeRange([]models.QueryFilter{after})
+	assert.True(t, found)
+	assert.Equal(t, build.BuildQueryOrderValues.FinishTimeAscending, timeRange.order)
+	assert.Equal(t, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), *timeRange.min)
+	assert.Nil(t, timeRange.max)
+}
+
+func TestBuildIdsArePassedToTheBuildsApi(t *testing.T) {
+
+	client := CreateDevopsClient("", "")
+	ids, found := buildIds([]models.QueryFilter{
+		{Type: "in", FieldName: "id", Values: []string{"1", "2", "3"}},
+		{Type: "eq", FieldName: "result", Value: "failed"},
+	})
+
+	assert.True(t, found)
+	assert.Equal(t, []int{1, 2, 3}, ids)
+	assert.True(t, client.SupportsFilter("builds", models.QueryFilter{Type: "eq", FieldName: "id", Value: "1"}))
+	assert.False(t, client.SupportsFilter("builds", models.QueryFilter{Type: "in", FieldName: "id", Values: []string{"1", "latest"}}))
+	assert.False(t, client.SupportsFilter("pipelines", models.QueryFilter{Type: "eq", FieldName: "id", Value: "1"}))
+}
+
+// The API's time filters are checked again after it's applied them, so it can't stop early
+func TestBuildsOnlyStopEarlyWhenTheApiAppliesTheFiltersExactly(t *testing.T) {
+
+	assert.Equal(t, 10, buildsTop(ConnectorQuery{Top: 10}))
+	assert.Equal(t, 10, buildsTop(ConnectorQuery{Top: 10, Filters: []models.QueryFilter{
+		{Type: "in", FieldName: "id", Values: []string{"1", "2"}},
+	}}))
+	assert.Equal(t, 0, buildsTop(ConnectorQuery{Top: 10, Filters: []models.QueryFilter{
+		{Type: "in", FieldName: "id", Values: []string{"1", "2"}},
+		{Type: "gt", FieldName: "finishtime", Value: "2022-01-01"},
+	}}))
+}
+
+func TestCaseSensitiveProjectsAreCheckedByTheEngine(t *testing.T) {
+
+	client := CreateDevopsClient("", "")
+
+	assert.True(t, client.SupportsFilter("builds", models.QueryFilter{Type: "eq", FieldName: "project", Value: "Main"}))
+	assert.True(t, client.SupportsFilter("builds", models.QueryFilter{Type: "eq", FieldName: "project", Value: "Main", Collation: models.CaseInsensitive}))
+	assert.False(t, client.SupportsFilter("builds", models.QueryFilter{Type: "eq", FieldName: "project", Value: "Main", Collation: models.CaseSensitive}))
+
+	// Ids don't have a case
+	assert.True(t, client.SupportsFilter("builds", models.QueryFilter{Type: "eq", FieldName: "id", Value: "1", Collation: models.CaseSensitive}))
+}
+
+func TestComparisonsWithOtherColumnsAreCheckedByTheEngine(t *testing.T) {
+
+	client := CreateDevopsClient("", "")
+	definition := &models.Expression{Type: "column", FieldName: "definition"}
+
+	assert.False(t, client.SupportsFilter("builds", models.QueryFilter{Type: "eq", FieldName: "project", ValueExpression: definition}))
+	assert.False(t, client.SupportsFilter("builds", models.QueryFilter{Type: "eq", FieldName: "id", ValueExpression: definition}))
+	assert.False(t, client.SupportsFilter("builds", models.QueryFilter{Type: "gt", FieldName: "finishtime", ValueExpression: &models.Expression{Type: "column", FieldName: "queuetime"}}))
+}
@@ -0,0 +1,313 @@
+package connectors
+
+import (
+	"context"
+	"devopsdb/models"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/microsoft/azure-devops-go-api/azuredevops"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/identity"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/policy"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/security"
+)
+
+// The well-known ID of the 'Git Repositories' security namespace. Tokens in this
+// namespace look like 'repoV2/{projectId}/{repositoryId}'
+var gitSecurityNamespaceId = uuid.MustParse("2e9eb7ed-3c0a-47d4-87c1-0ffdd275fd87")
+
+func (client *DevOpsClient) getBranchPolicies(query ConnectorQuery) models.RowIterator {
+	connection := azuredevops.NewPatConnection(client.ApiUrl, client.Pat)
+
+	projectFilter := query.RequiredFilters["project"]
+
+	ctx := queryContext(query)
+
+	var repositoryNames map[string]string
+
+	return newPagedIterator(query.Top, func(continuationToken string) (models.ResultTable, string, error) {
+		policyClient, err := policy.NewClient(ctx, connection)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if repositoryNames == nil {
+			repositoryNames, _, err = getRepositoryNames(ctx, connection, projectFilter)
+			if err != nil {
+				return nil, "", err
+			}
+		}
+
+		responseValue, err := policyClient.GetPolicyConfigurations(ctx, policy.GetPolicyConfigurationsArgs{
+			ContinuationToken: continuationTokenArgument(continuationToken),
+			Project:           &projectFilter,
+			Top:               topArgument(query),
+		})
+		if err != nil {
+			return nil, "", err
+		}
+
+		var results models.ResultTable
+		for _, configuration := range responseValue.Value {
+			rows, err := branchPolicyRows(configuration, projectFilter, repositoryNames)
+			if err != nil {
+				return nil, "", err
+			}
+			results = append(results, rows...)
+		}
+
+		return results, responseValue.ContinuationToken, nil
+	})
+}
+
+// A policy is scoped to any number of repository/branch pairs, so there's a row for each one
+func branchPolicyRows(configuration policy.PolicyConfiguration, project string, repositoryNames map[string]string) (models.ResultTable, error) {
+	if configuration.IsDeleted != nil && *configuration.IsDeleted {
+		return nil, nil
+	}
+
+	settings, err := json.Marshal(configuration.Settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// Policies of types that have since been removed don't say what they were
+	policyType := ""
+	if configuration.Type != nil {
+		policyType = stringValue(configuration.Type.DisplayName)
+	}
+
+	var results models.ResultTable
+	for _, scope := range policyScopes(configuration.Settings) {
+		results = append(results, map[string]string{
+			"id":         intValue(configuration.Id),
+			"project":    project,
+			"repository": repositoryNames[scope.repositoryId],
+			"branch":     scope.branch,
+			"matchkind":  scope.matchKind,
+			"policytype": policyType,
+			"enabled":    strconv.FormatBool(configuration.IsEnabled != nil && *configuration.IsEnabled),
+			"blocking":   strconv.FormatBool(configuration.IsBlocking != nil && *configuration.IsBlocking),
+			"settings":   string(settings),
+		})
+	}
+	return results, nil
+}
+
+func (client *DevOpsClient) getRepositoryPermissions(query ConnectorQuery) models.RowIterator {
+	// The ACLs come back in one go, so there's only ever one 'page'
+	return newPagedIterator(query.Top, func(string) (models.ResultTable, string, error) {
+		results, err := client.getRepositoryPermissionRows(query)
+		return results, "", err
+	})
+}
+
+func (client *DevOpsClient) getRepositoryPermissionRows(query ConnectorQuery) (models.ResultTable, error) {
+	connection := azuredevops.NewPatConnection(client.ApiUrl, client.Pat)
+
+	projectFilter := query.RequiredFilters["project"]
+
+	ctx := queryContext(query)
+
+	repositoryNames, projectId, err := getRepositoryNames(ctx, connection, projectFilter)
+	if err != nil {
+		return nil, err
+	}
+	if projectId == "" {
+		return models.ResultTable{}, nil
+	}
+
+	securityClient := security.NewClient(ctx, connection)
+
+	permissionNames, err := getPermissionNames(ctx, securityClient)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk the permissions in bit order so the rows come out in a stable order
+	var permissionBits []int
+	for bit := range permissionNames {
+		permissionBits = append(permissionBits, bit)
+	}
+	sort.Ints(permissionBits)
+
+	token := "repoV2/" + projectId
+	recurse := true
+	accessControlLists, err := securityClient.QueryAccessControlLists(ctx, security.QueryAccessControlListsArgs{
+		SecurityNamespaceId: &gitSecurityNamespaceId,
+		Token:               &token,
+		Recurse:             &recurse,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results models.ResultTable
+	descriptors := make(map[string]bool)
+
+	for _, accessControlList := range *accessControlLists {
+		// Tokens are 'repoV2/{project}' for project-wide permissions and 'repoV2/{project}/{repo}'
+		// for a single repository. Anything deeper is a branch-level permission, which we skip
+		tokenParts := strings.Split(strings.TrimSuffix(*accessControlList.Token, "/"), "/")
+		if len(tokenParts) > 3 || accessControlList.AcesDictionary == nil {
+			continue
+		}
+
+		// Project-wide permissions apply to every repository, so have no repository name
+		repositoryName := ""
+		if len(tokenParts) == 3 {
+			repositoryName = repositoryNames[tokenParts[2]]
+		}
+
+		for descriptor, entry := range *accessControlList.AcesDictionary {
+			descriptors[descriptor] = true
+
+			for _, bit := range permissionBits {
+				access := ""
+				if entry.Deny != nil && *entry.Deny&bit != 0 {
+					access = "deny"
+				} else if entry.Allow != nil && *entry.Allow&bit != 0 {
+					access = "allow"
+				}
+
+				if access == "" {
+					continue
+				}
+
+				results = append(results, map[string]string{
+					"project":    projectFilter,
+					"repository": repositoryName,
+					"identity":   descriptor,
+					"permission": permissionNames[bit],
+					"access":     access,
+				})
+			}
+		}
+	}
+
+	// The ACLs only tell us identity descriptors, so swap them for display names
+	identityNames, err := getIdentityNames(ctx, connection, descriptors)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range results {
+		if name, found := identityNames[row["identity"]]; found {
+			row["identity"] = name
+		}
+	}
+
+	return results, nil
+}
+
+// Returns the display name of each permission in the Git Repositories namespace, keyed
+// on the bit that represents it in an access control entry
+func getPermissionNames(ctx context.Context, securityClient security.Client) (map[int]string, error) {
+	namespaces, err := securityClient.QuerySecurityNamespaces(ctx, security.QuerySecurityNamespacesArgs{
+		SecurityNamespaceId: &gitSecurityNamespaceId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	permissionNames := make(map[int]string)
+	for _, namespace := range *namespaces {
+		if namespace.Actions == nil {
+			continue
+		}
+		for _, action := range *namespace.Actions {
+			permissionNames[*action.Bit] = *action.DisplayName
+		}
+	}
+
+	return permissionNames, nil
+}
+
+func getIdentityNames(ctx context.Context, connection *azuredevops.Connection, uniqueDescriptors map[string]bool) (map[string]string, error) {
+	identityNames := make(map[string]string)
+
+	if len(uniqueDescriptors) == 0 {
+		return identityNames, nil
+	}
+
+	var descriptors []string
+	for descriptor := range uniqueDescriptors {
+		descriptors = append(descriptors, descriptor)
+	}
+
+	identityClient, err := identity.NewClient(ctx, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the URLs to a sensible length by asking for identities in batches
+	const batchSize = 50
+	for start := 0; start < len(descriptors); start += batchSize {
+		end := start + batchSize
+		if end > len(descriptors) {
+			end = len(descriptors)
+		}
+
+		batch := strings.Join(descriptors[start:end], ",")
+		identities, err := identityClient.ReadIdentities(ctx, identity.ReadIdentitiesArgs{Descriptors: &batch})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, found := range *identities {
+			if found.Descriptor == nil || found.ProviderDisplayName == nil {
+				continue
+			}
+			identityNames[*found.Descriptor] = *found.ProviderDisplayName
+		}
+	}
+
+	return identityNames, nil
+}
+
+type policyScope struct {
+	repositoryId string
+	branch       string // Without 'refs/heads/', e.g. 'main', or 'release/' for a prefix
+	matchKind    string // Whether the branch is 'Exact' or a 'Prefix' of the branches the policy applies to
+}
+
+// Policy settings are free-form JSON, but most policy types have a 'scope' array
+// saying which repositories and branches the policy applies to. A missing repository
+// ID means 'all repositories', and a missing branch 'all branches'
+func policyScopes(settings interface{}) []policyScope {
+	settingsMap, isMap := settings.(map[string]interface{})
+	if !isMap {
+		return []policyScope{{}}
+	}
+
+	scopes, isSlice := settingsMap["scope"].([]interface{})
+	if !isSlice || len(scopes) == 0 {
+		return []policyScope{{}}
+	}
+
+	var result []policyScope
+	for _, scope := range scopes {
+		scopeMap, isMap := scope.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+
+		repositoryId, _ := scopeMap["repositoryId"].(string)
+		refName, _ := scopeMap["refName"].(string)
+		matchKind, _ := scopeMap["matchKind"].(string)
+
+		result = append(result, policyScope{
+			repositoryId: repositoryId,
+			branch:       strings.TrimPrefix(refName, "refs/heads/"),
+			matchKind:    matchKind,
+		})
+	}
+
+	// The policy still applies to something, even if we can't tell what
+	if len(result) == 0 {
+		return []policyScope{{}}
+	}
+	return result
+}
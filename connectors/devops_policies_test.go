@@ -0,0 +1,87 @@
+package connectors
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/microsoft/azure-devops-go-api/azuredevops/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBranchPoliciesWithoutATypeOrIdStillHaveRows(t *testing.T) {
+
+	enabled := true
+	rows, err := branchPolicyRows(policy.PolicyConfiguration{IsEnabled: &enabled}, "a", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{
+		"id": "", "project": "a", "repository": "", "branch": "", "matchkind": "", "policytype": "",
+		"enabled": "true", "blocking": "false", "settings": "null",
+	}}, rows)
+}
+
+func TestPolicyScopes(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		settings interface{}
+		expected []policyScope
+	}{
+		{"no settings", nil, []policyScope{{}}},
+		{"settings that aren't an object", "text", []policyScope{{}}},
+		{"no scope", map[string]interface{}{"minimumApproverCount": 2.0}, []policyScope{{}}},
+		{"an empty scope", map[string]interface{}{"scope": []interface{}{}}, []policyScope{{}}},
+		{"a scope that isn't an array", map[string]interface{}{"scope": "repo"}, []policyScope{{}}},
+		{"scopes that aren't objects", map[string]interface{}{"scope": []interface{}{"repo"}}, []policyScope{{}}},
+		{
+			"repositories and branches",
+			map[string]interface{}{"scope": []interface{}{
+				map[string]interface{}{"repositoryId": "r1", "refName": "refs/heads/main", "matchKind": "Exact"},
+				map[string]interface{}{"repositoryId": "r2", "refName": "refs/heads/release/", "matchKind": "Prefix"},
+				"ignored",
+			}},
+			[]policyScope{
+				{repositoryId: "r1", branch: "main", matchKind: "Exact"},
+				{repositoryId: "r2", branch: "release/", matchKind: "Prefix"},
+			},
+		},
+		{
+			"every repository",
+			map[string]interface{}{"scope": []interface{}{
+				map[string]interface{}{"repositoryId": nil, "refName": "refs/heads/main", "matchKind": "Exact"},
+			}},
+			[]policyScope{{branch: "main", matchKind: "Exact"}},
+		},
+		{
+			"every branch of a repository",
+			map[string]interface{}{"scope": []interface{}{map[string]interface{}{"repositoryId": "r1"}}},
+			[]policyScope{{repositoryId: "r1"}},
+		},
+		{
+			"refs that aren't branches",
+			map[string]interface{}{"scope": []interface{}{map[string]interface{}{"refName": "refs/tags/v1", "matchKind": "Exact"}}},
+			[]policyScope{{branch: "refs/tags/v1", matchKind: "Exact"}},
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, policyScopes(test.settings), test.name)
+	}
+}
+
+func TestBranchPoliciesHaveARowForEachScope(t *testing.T) {
+
+	id := 7
+	rows, err := branchPolicyRows(policy.PolicyConfiguration{
+		Id: &id,
+		Settings: map[string]interface{}{"scope": []interface{}{
+			map[string]interface{}{"repositoryId": "r1", "refName": "refs/heads/main", "matchKind": "Exact"},
+			map[string]interface{}{"repositoryId": "r2", "refName": "refs/heads/release/", "matchKind": "Prefix"},
+		}},
+	}, "a", map[string]string{"r1": "api", "r2": "web"})
+
+	assert.Nil(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, []string{"api", "main", "Exact"}, []string{rows[0]["repository"], rows[0]["branch"], rows[0]["matchkind"]})
+	assert.Equal(t, []string{"web", "release/", "Prefix"}, []string{rows[1]["repository"], rows[1]["branch"], rows[1]["matchkind"]})
+}
@@ -0,0 +1,91 @@
+package connectors
+
+import (
+	"context"
+	"devopsdb/models"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/azure-devops-go-api/azuredevops"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/git"
+)
+
+func (client *DevOpsClient) getRepositories(query ConnectorQuery) models.RowIterator {
+	connection := azuredevops.NewPatConnection(client.ApiUrl, client.Pat)
+
+	projectFilter := query.RequiredFilters["project"]
+
+	ctx := queryContext(query)
+
+	// The API returns every repository in the project at once, so there's only ever one 'page'
+	return newPagedIterator(query.Top, func(string) (models.ResultTable, string, error) {
+		repositories, err := listRepositories(ctx, connection, projectFilter)
+		if err != nil {
+			return nil, "", err
+		}
+
+		var results models.ResultTable
+		for _, repository := range repositories {
+			results = append(results, repositoryRow(repository, projectFilter))
+		}
+		return results, "", nil
+	})
+}
+
+func repositoryRow(repository git.GitRepository, project string) map[string]string {
+	row := map[string]string{
+		"project":       project,
+		"name":          stringValue(repository.Name),
+		"defaultbranch": strings.TrimPrefix(stringValue(repository.DefaultBranch), "refs/heads/"),
+		"isfork":        strconv.FormatBool(repository.IsFork != nil && *repository.IsFork),
+		"url":           stringValue(repository.Url),
+	}
+	if repository.Id != nil {
+		row["id"] = repository.Id.String()
+	}
+	if repository.Size != nil {
+		row["size"] = strconv.FormatUint(*repository.Size, 10)
+	}
+	return row
+}
+
+func listRepositories(ctx context.Context, connection *azuredevops.Connection, project string) ([]git.GitRepository, error) {
+	gitClient, err := git.NewClient(ctx, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	repositories, err := gitClient.GetRepositories(ctx, git.GetRepositoriesArgs{Project: &project})
+	if err != nil {
+		return nil, err
+	}
+	return *repositories, nil
+}
+
+// Returns the name of each repository in the project keyed on its ID, along with the
+// project's ID (which is what security tokens are built from)
+func getRepositoryNames(ctx context.Context, connection *azuredevops.Connection, project string) (map[string]string, string, error) {
+	repositories, err := listRepositories(ctx, connection, project)
+	if err != nil {
+		return nil, "", err
+	}
+
+	repositoryNames, projectId := repositoryNamesById(repositories)
+	return repositoryNames, projectId, nil
+}
+
+// Repositories without an ID can't be matched to anything, so they're left out
+func repositoryNamesById(repositories []git.GitRepository) (map[string]string, string) {
+	projectId := ""
+	repositoryNames := make(map[string]string)
+	for _, repository := range repositories {
+		if repository.Id == nil {
+			continue
+		}
+		repositoryNames[repository.Id.String()] = stringValue(repository.Name)
+		if repository.Project != nil && repository.Project.Id != nil {
+			projectId = repository.Project.Id.String()
+		}
+	}
+	return repositoryNames, projectId
+}
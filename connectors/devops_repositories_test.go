@@ -0,0 +1,53 @@
+package connectors
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/core"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/git"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositoryRows(t *testing.T) {
+
+	id := uuid.MustParse("2e9eb7ed-3c0a-47d4-87c1-0ffdd275fd87")
+	name, branch := "api", "refs/heads/main"
+	size := uint64(1024)
+
+	assert.Equal(t, map[string]string{
+		"id": id.String(), "project": "a", "name": "api", "defaultbranch": "main", "isfork": "false", "size": "1024", "url": "",
+	}, repositoryRow(git.GitRepository{Id: &id, Name: &name, DefaultBranch: &branch, Size: &size}, "a"))
+
+	// Empty repositories don't have a default branch
+	assert.Equal(t, map[string]string{
+		"project": "a", "name": "api", "defaultbranch": "", "isfork": "false", "url": "",
+	}, repositoryRow(git.GitRepository{Name: &name}, "a"))
+}
+
+func TestRepositoryNamesSkipsMissingValues(t *testing.T) {
+
+	id := uuid.MustParse("2e9eb7ed-3c0a-47d4-87c1-0ffdd275fd87")
+	otherId := uuid.MustParse("6d1e1a39-2c5a-4bd4-9a0e-33c3d1bb8d0a")
+	projectId := uuid.MustParse("b4b1d4f4-7e5c-4a4e-8c8d-1a1f6b2f3c4d")
+	name := "api"
+
+	names, project := repositoryNamesById([]git.GitRepository{
+		{Id: &id, Name: &name, Project: &core.TeamProjectReference{Id: &projectId}},
+		{Id: &otherId},
+		{Name: &name},
+	})
+
+	assert.Equal(t, map[string]string{id.String(): "api", otherId.String(): ""}, names)
+	assert.Equal(t, projectId.String(), project)
+}
+
+func TestRepositoriesAreListedOneProjectAtATime(t *testing.T) {
+
+	client := CreateDevopsClient("", "")
+
+	assert.Equal(t, []RequiredFilter{{FieldName: "project", SourceTable: "projects", SourceColumn: "name"}}, client.GetRequiredFiltersForTable("repositories"))
+	columns, err := client.GetSchemaForTable("repositories")
+	assert.Nil(t, err)
+	assert.Contains(t, columns, "defaultbranch")
+}
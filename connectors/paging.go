@@ -0,0 +1,64 @@
+package connectors
+
+import (
+	"devopsdb/models"
+	"io"
+)
+
+// Fetches one page of results from an API, given the continuation token returned
+// with the previous page ("" for the first page). Returning an empty continuation
+// token means this was the last page
+type fetchPage func(continuationToken string) (rows models.ResultTable, nextContinuationToken string, err error)
+
+// pagedIterator only asks the API for the next page when the caller has read every
+// row of the current one, so rows can be streamed as they arrive and we stop calling
+// the API as soon as the caller stops reading
+type pagedIterator struct {
+	fetch fetchPage
+	top   int
+
+	page              models.ResultTable
+	continuationToken string
+	fetchedFirstPage  bool
+	returned          int
+	closed            bool
+}
+
+func newPagedIterator(top int, fetch fetchPage) *pagedIterator {
+	return &pagedIterator{fetch: fetch, top: top}
+}
+
+func (it *pagedIterator) Next() (map[string]string, error) {
+	for len(it.page) == 0 {
+		lastPage := it.fetchedFirstPage && it.continuationToken == ""
+		haveEnough := it.top != 0 && it.returned >= it.top
+
+		if it.closed || lastPage || haveEnough {
+			return nil, io.EOF
+		}
+
+		page, continuationToken, err := it.fetch(it.continuationToken)
+		if err != nil {
+			return nil, err
+		}
+
+		it.page = page
+		it.continuationToken = continuationToken
+		it.fetchedFirstPage = true
+	}
+
+	if it.top != 0 && it.returned >= it.top {
+		return nil, io.EOF
+	}
+
+	row := it.page[0]
+	it.page = it.page[1:]
+	it.returned++
+
+	return row, nil
+}
+
+func (it *pagedIterator) Close() {
+	it.closed = true
+	it.page = nil
+}
@@ -0,0 +1,74 @@
+package connectors
+
+import (
+	"devopsdb/models"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagedIteratorFollowsContinuationTokens(t *testing.T) {
+
+	pages := fakePages()
+	rows := newPagedIterator(0, pages.fetch)
+
+	results, err := models.Collect(rows)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"id": "1"}, {"id": "2"}, {"id": "3"}}, results)
+	assert.Equal(t, []string{"", "page2"}, pages.requestedTokens)
+}
+
+func TestPagedIteratorOnlyFetchesPagesWhenTheyAreNeeded(t *testing.T) {
+
+	pages := fakePages()
+	rows := newPagedIterator(0, pages.fetch)
+
+	rows.Next()
+	rows.Next()
+
+	assert.Equal(t, []string{""}, pages.requestedTokens)
+}
+
+func TestPagedIteratorStopsAtTop(t *testing.T) {
+
+	pages := fakePages()
+	rows := newPagedIterator(2, pages.fetch)
+
+	results, _ := models.Collect(rows)
+
+	assert.Equal(t, models.ResultTable{{"id": "1"}, {"id": "2"}}, results)
+	assert.Equal(t, []string{""}, pages.requestedTokens)
+}
+
+func TestPagedIteratorStopsWhenClosed(t *testing.T) {
+
+	pages := fakePages()
+	rows := newPagedIterator(0, pages.fetch)
+
+	rows.Next()
+	rows.Close()
+	_, err := rows.Next()
+
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []string{""}, pages.requestedTokens)
+}
+
+type pageRecorder struct {
+	requestedTokens []string
+}
+
+func fakePages() *pageRecorder {
+	return &pageRecorder{}
+}
+
+func (p *pageRecorder) fetch(continuationToken string) (models.ResultTable, string, error) {
+	p.requestedTokens = append(p.requestedTokens, continuationToken)
+
+	if continuationToken == "" {
+		return models.ResultTable{{"id": "1"}, {"id": "2"}}, "page2", nil
+	}
+
+	return models.ResultTable{{"id": "3"}}, "", nil
+}
@@ -1,10 +1,26 @@
 package connectors
 
-import "devopsdb/models"
+import (
+	"context"
+	"devopsdb/middleware"
+	"devopsdb/models"
+)
 
 type ConnectorQuery struct {
 	TableName   string
 	ColumnNames []string
-	Top         int
-	Filters     []models.QueryFilter
+	Top         int                  // The connector can stop fetching once it has this many rows (0 means no limit)
+	Filters     []models.QueryFilter // Only the filters the connector said it supports
+
+	// The single value to use for each of the table's required filters
+	RequiredFilters map[string]string
+
+	// Counts the HTTP requests made for the query, if it isn't nil. Connectors that use
+	// HTTP should make their requests with queryContext, so they're counted
+	Stats *middleware.Stats `json:"-"`
+}
+
+// The context for any HTTP requests made for the query
+func queryContext(query ConnectorQuery) context.Context {
+	return middleware.WithStats(context.Background(), query.Stats)
 }
@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// aggregateNode groups the rows by the 'group by' columns, and works out the aggregates
+// for each group. Each output row has the group's columns plus one column per aggregate,
+// named after it (e.g. 'count(*)')
+type aggregateNode struct {
+	child         planNode
+	groupBy       []string
+	aggregates    []models.Aggregate
+	caseSensitive []string
+}
+
+func (n *aggregateNode) open() (models.RowIterator, error) {
+	rows, err := n.child.open()
+	if err != nil {
+		return nil, err
+	}
+	return &aggregateIterator{rows: rows, node: n}, nil
+}
+
+func (n *aggregateNode) children() []planNode {
+	return []planNode{n.child}
+}
+
+func (n *aggregateNode) describe() []string {
+	var names []string
+	for _, aggregate := range n.aggregates {
+		names = append(names, aggregate.Name)
+	}
+
+	description := "Aggregate " + strings.Join(names, ", ")
+	if len(n.groupBy) > 0 {
+		description += " group by " + strings.Join(n.groupBy, ", ")
+	}
+	return []string{description}
+}
+
+// The running totals for one aggregate in one group
+type aggregateState struct {
+	count int
+	sum   float64
+	value string // The min or max so far
+
+	// The values used so far, for 'distinct'
+	seen map[string]bool
+}
+
+type aggregateGroup struct {
+	row    map[string]string // The group by columns
+	states []aggregateState
+}
+
+// aggregateIterator has to read every row before it knows the first result, so it
+// does that on the first call to Next
+type aggregateIterator struct {
+	rows    models.RowIterator
+	node    *aggregateNode
+	results models.RowIterator
+}
+
+func (it *aggregateIterator) Next() (map[string]string, error) {
+	if it.results == nil {
+		results, err := it.aggregate()
+		if err != nil {
+			return nil, err
+		}
+		it.results = models.NewTableIterator(results)
+	}
+	return it.results.Next()
+}
+
+func (it *aggregateIterator) aggregate() (models.ResultTable, error) {
+	defer it.rows.Close()
+
+	groups := make(map[string]*aggregateGroup)
+	var order []string
+
+	// Without a 'group by' everything is in one group, even if there are no rows
+	if len(it.node.groupBy) == 0 {
+		groups[""] = it.newGroup(map[string]string{})
+		order = append(order, "")
+	}
+
+	for {
+		row, err := it.rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		key := joinKey(row, it.node.groupBy, it.node.caseSensitive)
+		group, found := groups[key]
+		if !found {
+			group = it.newGroup(row)
+			groups[key] = group
+			order = append(order, key)
+		}
+
+		for index, aggregate := range it.node.aggregates {
+			group.states[index].add(aggregate, row, slices.Contains(it.node.caseSensitive, aggregate.FieldName))
+		}
+	}
+
+	var results models.ResultTable
+	for _, key := range order {
+		group := groups[key]
+		for index, aggregate := range it.node.aggregates {
+			group.row[aggregate.Name] = group.states[index].result(aggregate)
+		}
+		results = append(results, group.row)
+	}
+	return results, nil
+}
+
+func (it *aggregateIterator) newGroup(row map[string]string) *aggregateGroup {
+	group := &aggregateGroup{
+		row:    make(map[string]string),
+		states: make([]aggregateState, len(it.node.aggregates)),
+	}
+	for _, column := range it.node.groupBy {
+		group.row[column] = row[column]
+	}
+	return group
+}
+
+func (it *aggregateIterator) Close() {
+	it.rows.Close()
+}
+
+func (s *aggregateState) add(aggregate models.Aggregate, row map[string]string, caseSensitive bool) {
+	// count(*) counts every row, but everything else ignores empty values
+	if aggregate.FieldName == "" {
+		s.count++
+		return
+	}
+
+	value := row[aggregate.FieldName]
+	if value == "" {
+		return
+	}
+
+	if aggregate.Distinct {
+		if s.seen == nil {
+			s.seen = make(map[string]bool)
+		}
+		if s.seen[valueKey(value, caseSensitive)] {
+			return
+		}
+		s.seen[valueKey(value, caseSensitive)] = true
+	}
+
+	switch aggregate.Function {
+	case "sum", "avg":
+		number, isNumber := models.ParseNumber(value)
+		if !isNumber {
+			return
+		}
+		s.sum += number
+
+	case "min":
+		if s.count == 0 || compareValues(value, s.value, caseSensitive) < 0 {
+			s.value = value
+		}
+
+	case "max":
+		if s.count == 0 || compareValues(value, s.value, caseSensitive) > 0 {
+			s.value = value
+		}
+	}
+
+	s.count++
+}
+
+func (s *aggregateState) result(aggregate models.Aggregate) string {
+	switch aggregate.Function {
+	case "count":
+		return strconv.Itoa(s.count)
+	case "sum", "avg":
+		// Like SQL, there's no total (or average) of no numbers
+		if s.count == 0 {
+			return ""
+		}
+		if aggregate.Function == "sum" {
+			return models.FormatNumber(s.sum)
+		}
+		return models.FormatNumber(s.sum / float64(s.count))
+	}
+	return s.value
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// e.g. "select result, count(*), sum(duration) from ci.builds group by result order by count(*) desc"
+func TestGroupByWithAggregates(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"result", "count(*)", "sum(duration)", "max(duration)"},
+		GroupBy: []string{"result"},
+		Aggregates: []models.Aggregate{
+			{Function: "count", Name: "count(*)"},
+			{Function: "sum", FieldName: "duration", Name: "sum(duration)"},
+			{Function: "max", FieldName: "duration", Name: "max(duration)"},
+		},
+		OrderBy: []models.OrderBy{{FieldName: "count(*)", Descending: true}},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"result": "succeeded", "count(*)": "2", "sum(duration)": "15", "max(duration)": "10"},
+		{"result": "failed", "count(*)": "1", "sum(duration)": "7", "max(duration)": "7"},
+	}, results)
+}
+
+func TestAggregateWithoutGroupByReturnsOneRow(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	result, _ := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"count(*)", "sum(duration)", "avg(duration)"},
+		Filters: []models.QueryFilter{{Type: "eq", FieldName: "result", Value: "cancelled"}},
+		Aggregates: []models.Aggregate{
+			{Function: "count", Name: "count(*)"},
+			{Function: "sum", FieldName: "duration", Name: "sum(duration)"},
+			{Function: "avg", FieldName: "duration", Name: "avg(duration)"},
+		},
+	})
+
+	// Like avg, there's no sum of no values
+	assert.Equal(t, models.ResultTable{{"count(*)": "0", "sum(duration)": "", "avg(duration)": ""}}, resultsOf(result))
+}
+
+func TestReturnsErrorForColumnNotInGroupBy(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	_, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns:    []string{"id", "count(*)"},
+		GroupBy:    []string{"result"},
+		Aggregates: []models.Aggregate{{Function: "count", Name: "count(*)"}},
+	})
+
+	assert.EqualError(t, err, "'id' needs to be in the 'group by', or used in an aggregate function")
+}
+
+func TestCountDistinct(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"count(distinct pipeline)", "count(*)"},
+		Aggregates: []models.Aggregate{
+			{Function: "count", FieldName: "pipeline", Distinct: true, Name: "count(distinct pipeline)"},
+			{Function: "count", Name: "count(*)"},
+		},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"count(distinct pipeline)": "2", "count(*)": "3"}}, results)
+}
+
+func TestAliasesOfAggregates(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"outcome", "builds"},
+		Expressions: map[string]models.Expression{
+			"outcome": {Type: "column", FieldName: "result"},
+			"builds":  {Type: "column", FieldName: "count(*)"},
+		},
+		GroupBy:    []string{"result"},
+		Aggregates: []models.Aggregate{{Function: "count", Name: "count(*)"}},
+		OrderBy:    []models.OrderBy{{FieldName: "builds", Descending: true}},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"outcome": "succeeded", "builds": "2"},
+		{"outcome": "failed", "builds": "1"},
+	}, results)
+}
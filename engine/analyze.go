@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"fmt"
+	"time"
+)
+
+// analyzedNode measures what happens when the node it wraps runs, for 'explain analyze'
+type analyzedNode struct {
+	planNode
+	rows    int
+	elapsed time.Duration
+}
+
+// Wraps every node in the plan so it's measured
+func analyze(node planNode) planNode {
+	return &analyzedNode{planNode: withChildren(node, analyze)}
+}
+
+func (n *analyzedNode) open() (models.RowIterator, error) {
+	return n.measure(n.planNode.open)
+}
+
+// The right side of a lookup join is opened once for each batch of keys
+func (n *analyzedNode) openWithLookup(keys []models.QueryFilter, required []map[string]string) (models.RowIterator, error) {
+	return n.measure(func() (models.RowIterator, error) {
+		return n.planNode.(lookupNode).openWithLookup(keys, required)
+	})
+}
+
+func (n *analyzedNode) measure(open func() (models.RowIterator, error)) (models.RowIterator, error) {
+	start := time.Now()
+	rows, err := open()
+	n.elapsed += time.Since(start)
+
+	if err != nil {
+		return nil, err
+	}
+	return &analyzedIterator{rows: rows, node: n}, nil
+}
+
+func (n *analyzedNode) describe() []string {
+	actual := fmt.Sprintf("actual: %v rows", n.rows)
+
+	// Children are analyzed too, so we know how many rows came in
+	if children := n.children(); len(children) > 0 {
+		rowsIn := 0
+		for _, child := range children {
+			rowsIn += child.(*analyzedNode).rows
+		}
+		actual = fmt.Sprintf("actual: %v rows in, %v rows out", rowsIn, n.rows)
+	}
+
+	// The time includes the time spent waiting for the children
+	actual += fmt.Sprintf(", %v", n.elapsed.Round(10*time.Microsecond))
+
+	if scan, isScan := n.planNode.(*scanNode); isScan {
+		actual += fmt.Sprintf(", %v HTTP requests, %v bytes", scan.requests.Requests(), scan.requests.Bytes())
+	}
+
+	return append(n.planNode.describe(), actual)
+}
+
+type analyzedIterator struct {
+	rows models.RowIterator
+	node *analyzedNode
+}
+
+func (it *analyzedIterator) Next() (map[string]string, error) {
+	start := time.Now()
+	row, err := it.rows.Next()
+	it.node.elapsed += time.Since(start)
+
+	if err == nil {
+		it.node.rows++
+	}
+	return row, err
+}
+
+func (it *analyzedIterator) Close() {
+	it.rows.Close()
+}
+
+// Runs the query to the end, then describes the plan along with what actually happened
+func explainAnalyze(plan planNode) (models.ResultTable, error) {
+	start := time.Now()
+	analyzed := analyze(plan)
+
+	rows, err := analyzed.open()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = models.Collect(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	results := explain(analyzed)
+	results = append(results, map[string]string{
+		"plan": fmt.Sprintf("Total time: %v", time.Since(start).Round(10*time.Microsecond)),
+	})
+	return results, nil
+}
@@ -0,0 +1,272 @@
+package engine
+
+import (
+	"devopsdb/middleware"
+	"devopsdb/models"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainDescribesThePlanWithoutCallingConnectors(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds", Alias: "b",
+		Columns: []string{"b.id", "p.name"},
+		Filters: []models.QueryFilter{
+			{Type: "eq", FieldName: "p.folder", Value: "prod"},
+			{Type: "ne", FieldName: "b.result", Value: "failed"},
+		},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "pipelines", Alias: "p",
+			On: []models.JoinCondition{{LeftField: "b.pipeline", RightField: "p.id"}},
+		}},
+		Limit:   5,
+		Explain: true,
+	})
+	results := resultsOf(result)
+
+	var lines []string
+	for _, row := range results {
+		lines = append(lines, row["plan"])
+	}
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"plan"}, result.Columns)
+	assert.Equal(t, []string{
+		"Limit 5",
+		"  Project b.id, p.name",
+		"    Hash join (inner) on b.pipeline = p.id",
+		"      Filter (run locally) b.result != 'failed'",
+		"        Scan ci.builds as b",
+		"          - columns: id, pipeline, result",
+		"          - estimated API calls: 1 (more if the results are paged)",
+		"      Scan ci.pipelines as p",
+		"        - columns: name, id",
+		"        - sent to the API: folder = 'prod'",
+		"        - estimated API calls: 1 (more if the results are paged)",
+	}, lines)
+	assert.Equal(t, 0, len(connector.queries))
+}
+
+// e.g. "explain with prod as (select id from ci.pipelines where folder = 'prod')
+// select id from ci.builds where pipeline in (select id from prod)"
+func TestExplainDoesNotRunCommonTableExpressionsOrSubqueries(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id"},
+		Filters: []models.QueryFilter{{Type: "in", FieldName: "pipeline", Subquery: &models.Query{Table: "prod", Columns: []string{"id"}}}},
+		With: []models.CommonTableExpression{
+			{Name: "prod", Query: models.Query{
+				SchemaName: "ci", Table: "pipelines",
+				Columns: []string{"id"},
+				Filters: []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: "prod"}},
+			}},
+		},
+		Explain: true,
+	})
+	results := resultsOf(result)
+
+	var lines []string
+	for _, row := range results {
+		lines = append(lines, row["plan"])
+	}
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"Run the 'with' clause, then the query",
+		"  'prod' from the 'with' clause",
+		"    - columns: id",
+		"    Project id",
+		"      Scan ci.pipelines",
+		"        - columns: id",
+		"        - sent to the API: folder = 'prod'",
+		"        - estimated API calls: 1 (more if the results are paged)",
+		"  Run the subqueries, then the query",
+		"    Subquery for pipeline in (subquery)",
+		"      Project id",
+		"        Scan prod (from the 'with' clause)",
+		"          - columns: id",
+		"          - estimated API calls: 1 (more if the results are paged)",
+		"    Project id",
+		"      Scan ci.builds",
+		"        - columns: id",
+		"        - sent to the API: pipeline in (subquery)",
+		"        - estimated API calls: 1 (more if the results are paged)",
+	}, lines)
+	assert.Equal(t, 0, len(connector.queries))
+}
+
+func TestExplainEstimatesCallsForRequiredFilters(t *testing.T) {
+
+	engine, _ := createEngine()
+
+	result, _ := engine.Execute(models.Query{
+		SchemaName: "azureDevOps", Table: "pipelines",
+		Filters: []models.QueryFilter{{Type: "in", FieldName: "project", Values: []string{"a", "b"}}},
+		Explain: true,
+	})
+	explained := resultsOf(result)
+
+	result, _ = engine.Execute(models.Query{SchemaName: "azureDevOps", Table: "pipelines", Explain: true})
+	explainedFanOut := resultsOf(result)
+
+	result, _ = engine.Execute(models.Query{
+		SchemaName: "azureDevOps", Table: "pipelines",
+		Filters: []models.QueryFilter{{Type: "in", FieldName: "project", Subquery: &models.Query{
+			SchemaName: "azureDevOps", Table: "projects", Columns: []string{"name"},
+		}}},
+		Explain: true,
+	})
+	explainedSubquery := resultsOf(result)
+
+	assert.Equal(t,
+		"- estimated API calls: 2 (more if the results are paged)",
+		strings.TrimSpace(explained[len(explained)-1]["plan"]),
+	)
+	assert.Equal(t,
+		"- estimated API calls: 1 per value of azureDevOps.projects.name, plus the calls to read them (more if the results are paged)",
+		strings.TrimSpace(explainedFanOut[len(explainedFanOut)-1]["plan"]),
+	)
+	assert.Equal(t,
+		"- estimated API calls: 1 per value of the subquery for project, plus the calls to read them (more if the results are paged)",
+		strings.TrimSpace(explainedSubquery[len(explainedSubquery)-1]["plan"]),
+	)
+}
+
+func TestExplainAnalyzeReportsWhatEachStepDid(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds", Alias: "b",
+		Columns: []string{"b.id", "p.name"},
+		Filters: []models.QueryFilter{{Type: "ne", FieldName: "b.result", Value: "failed"}},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "pipelines", Alias: "p",
+			On: []models.JoinCondition{{LeftField: "b.pipeline", RightField: "p.id"}},
+		}},
+		Explain: true,
+		Analyze: true,
+	})
+	results := resultsOf(result)
+
+	// The timings change from run to run
+	timing := regexp.MustCompile(`[0-9.]+[µnm]?s\b`)
+	var lines []string
+	for _, row := range results {
+		lines = append(lines, timing.ReplaceAllString(row["plan"], "T"))
+	}
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"Project b.id, p.name",
+		"  - actual: 2 rows in, 2 rows out, T",
+		"  Hash join (inner) on b.pipeline = p.id",
+		"    - actual: 5 rows in, 2 rows out, T",
+		"    Filter (run locally) b.result != 'failed'",
+		"      - actual: 3 rows in, 2 rows out, T",
+		"      Scan ci.builds as b",
+		"        - columns: id, pipeline, result",
+		"        - estimated API calls: 1 (more if the results are paged)",
+		"        - actual: 3 rows, T, 0 HTTP requests, 0 bytes",
+		"    Scan ci.pipelines as p",
+		"      - columns: name, id",
+		"      - estimated API calls: 1 (more if the results are paged)",
+		"      - actual: 3 rows, T, 0 HTTP requests, 0 bytes",
+		"Total time: T",
+	}, lines)
+	assert.Equal(t, 2, len(connector.queries))
+}
+
+func TestExplainAnalyzeReportsCommonTableExpressionsAndSubqueries(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id"},
+		Filters: []models.QueryFilter{{Type: "in", FieldName: "pipeline", Subquery: &models.Query{Table: "prod", Columns: []string{"id"}}}},
+		With: []models.CommonTableExpression{
+			{Name: "prod", Query: models.Query{
+				SchemaName: "ci", Table: "pipelines",
+				Columns: []string{"id"},
+				Filters: []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: "prod"}},
+			}},
+		},
+		Explain: true,
+		Analyze: true,
+	})
+	results := resultsOf(result)
+
+	timing := regexp.MustCompile(`[0-9.]+[µnm]?s\b`)
+	var lines []string
+	for _, row := range results {
+		lines = append(lines, timing.ReplaceAllString(row["plan"], "T"))
+	}
+
+	assert.Nil(t, err)
+	// The subquery's results are sent to the API once it has run
+	assert.Equal(t, []string{
+		"Run the 'with' clause, then the query",
+		"  - actual: 3 rows in, 2 rows out, T",
+		"  'prod' from the 'with' clause",
+		"    - columns: id",
+		"    - actual: 1 rows in, 1 rows out, T",
+		"    Project id",
+		"      - actual: 1 rows in, 1 rows out, T",
+		"      Scan ci.pipelines",
+		"        - columns: id",
+		"        - sent to the API: folder = 'prod'",
+		"        - estimated API calls: 1 (more if the results are paged)",
+		"        - actual: 1 rows, T, 0 HTTP requests, 0 bytes",
+		"  Run the subqueries, then the query",
+		"    - actual: 3 rows in, 2 rows out, T",
+		"    Subquery for pipeline in (subquery)",
+		"      - actual: 1 rows in, 1 rows out, T",
+		"      Project id",
+		"        - actual: 1 rows in, 1 rows out, T",
+		"        Scan prod (from the 'with' clause)",
+		"          - columns: id",
+		"          - estimated API calls: 1 (more if the results are paged)",
+		"          - actual: 1 rows, T, 0 HTTP requests, 0 bytes",
+		"    Project id",
+		"      - actual: 2 rows in, 2 rows out, T",
+		"      Scan ci.builds",
+		"        - columns: id",
+		"        - sent to the API: pipeline in ('10')",
+		"        - estimated API calls: 1 (more if the results are paged)",
+		"        - actual: 2 rows, T, 0 HTTP requests, 0 bytes",
+		"Total time: T",
+	}, lines)
+	assert.Equal(t, 2, len(connector.queries))
+}
+
+func TestExplainAnalyzeCountsHttpRequests(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	engine := New()
+	engine.AddConnector("web", &httpConnector{
+		url:    server.URL,
+		client: &http.Client{Transport: middleware.New(http.DefaultTransport, middleware.Options{})},
+	})
+
+	result, err := engine.Execute(models.Query{SchemaName: "web", Table: "pages", Explain: true, Analyze: true})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Regexp(t, "actual: 1 rows, .*, 2 HTTP requests, 20 bytes$", results[len(results)-2]["plan"])
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Values are compared without case, in the same way as filters, unless they're from a
+// column that's configured to be case-sensitive. The nodes that compare rows (to join,
+// group, sort or remove duplicates) are given the case-sensitive columns of their rows
+
+// The text that's the same for every value that's equal to this one
+func valueKey(value string, caseSensitive bool) string {
+	if caseSensitive {
+		return value
+	}
+	return strings.ToLower(value)
+}
+
+func compareValues(a string, b string, caseSensitive bool) int {
+	if caseSensitive {
+		return models.CompareValuesWithCase(a, b)
+	}
+	return models.CompareValues(a, b)
+}
+
+// The text that's the same for every row with equal values in the columns
+func joinKey(row map[string]string, columns []string, caseSensitive []string) string {
+	var values []string
+	for _, column := range columns {
+		values = append(values, valueKey(row[column], slices.Contains(caseSensitive, column)))
+	}
+	return strings.Join(values, "\x00")
+}
+
+func compareRows(a map[string]string, b map[string]string, orderBy []models.OrderBy, caseSensitive []string) int {
+	for _, column := range orderBy {
+		comparison := compareValues(a[column.FieldName], b[column.FieldName], slices.Contains(caseSensitive, column.FieldName))
+		if column.Descending {
+			comparison = -comparison
+		}
+		if comparison != 0 {
+			return comparison
+		}
+	}
+	return 0
+}
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupsCaseSensitiveColumnsByCase(t *testing.T) {
+
+	engine := createCaseSensitiveEngine()
+	count := models.Aggregate{Function: "count", Name: "count(*)"}
+	distinctNames := models.Aggregate{Function: "count", FieldName: "result", Distinct: true, Name: "count(distinct result)"}
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns:    []string{"result", "count(*)"},
+		GroupBy:    []string{"result"},
+		Aggregates: []models.Aggregate{count},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"result": "failed", "count(*)": "2"},
+		{"result": "Failed", "count(*)": "1"},
+	}, resultsOf(result))
+
+	result, err = engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns:    []string{"count(distinct result)"},
+		Aggregates: []models.Aggregate{distinctNames},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"count(distinct result)": "2"}}, resultsOf(result))
+}
+
+func TestJoinsCaseSensitiveColumnsByCase(t *testing.T) {
+
+	engine := createCaseSensitiveEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds", Alias: "b",
+		Columns: []string{"b.id", "p.folder"},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "pipelines", Alias: "p",
+			On: []models.JoinCondition{{LeftField: "p.name", RightField: "b.result"}},
+		}},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"b.id": "1", "p.folder": "a"},
+		{"b.id": "2", "p.folder": "b"},
+		{"b.id": "3", "p.folder": "a"},
+	}, resultsOf(result))
+}
+
+func TestSortsCaseSensitiveColumnsByCase(t *testing.T) {
+
+	engine := createCaseSensitiveEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id", "outcome"},
+		Expressions: map[string]models.Expression{
+			"outcome": {Type: "column", FieldName: "result"},
+		},
+		OrderBy: []models.OrderBy{{FieldName: "outcome"}, {FieldName: "id", Descending: true}},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"id": "2", "outcome": "Failed"},
+		{"id": "3", "outcome": "failed"},
+		{"id": "1", "outcome": "failed"},
+	}, resultsOf(result))
+}
+
+func TestRemovesDuplicatesOfCaseSensitiveColumnsByCase(t *testing.T) {
+
+	engine := createCaseSensitiveEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns:  []string{"result"},
+		Distinct: true,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"result": "failed"}, {"result": "Failed"}}, resultsOf(result))
+
+	// .. and when they're combined with other queries, or from a 'with' clause
+	result, err = engine.Execute(models.Query{
+		With: []models.CommonTableExpression{{Name: "names", Query: models.Query{
+			SchemaName: "ci", Table: "pipelines",
+			Columns: []string{"name"},
+		}}},
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"result"},
+		SetOperations: []models.SetOperation{{Type: "union", Query: models.Query{
+			Table: "names", Columns: []string{"name"},
+		}}},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"result": "failed"}, {"result": "Failed"}}, resultsOf(result))
+}
+
+func TestPartitionsCaseSensitiveColumnsByCase(t *testing.T) {
+
+	engine := createCaseSensitiveEngine()
+	count := models.WindowFunction{Function: "count", PartitionBy: []string{"result"}, Name: "count(*) over (partition by result)"}
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id", count.Name},
+		Windows: []models.WindowFunction{count},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"id": "1", count.Name: "2"},
+		{"id": "2", count.Name: "1"},
+		{"id": "3", count.Name: "2"},
+	}, resultsOf(result))
+}
+
+func TestContinuationTokensPageThroughCaseSensitiveColumns(t *testing.T) {
+
+	engine := createCaseSensitiveEngine()
+	query := models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id", "result"},
+		OrderBy: []models.OrderBy{{FieldName: "result"}},
+		Limit:   1,
+	}
+
+	var ids []string
+	for page := 0; page < 5; page++ {
+		result, err := engine.Execute(query)
+		assert.Nil(t, err)
+		for _, row := range resultsOf(result) {
+			ids = append(ids, row["id"])
+		}
+
+		query.Continuation = result.ContinuationToken()
+		if query.Continuation == "" {
+			break
+		}
+	}
+
+	assert.Equal(t, []string{"2", "1", "3"}, ids)
+}
+
+// Builds whose results only differ by case, and pipelines named after them
+func createCaseSensitiveEngine() *QueryEngine {
+	engine := New()
+	engine.AddConnector("ci", &tableConnector{tables: map[string]models.ResultTable{
+		"builds": {
+			{"id": "1", "pipeline": "10", "result": "failed"},
+			{"id": "2", "pipeline": "20", "result": "Failed"},
+			{"id": "3", "pipeline": "10", "result": "failed"},
+		},
+		"pipelines": {
+			{"id": "10", "name": "failed", "folder": "a"},
+			{"id": "20", "name": "Failed", "folder": "b"},
+		},
+	}})
+	engine.SetCaseSensitive("ci", "builds", []string{"result"})
+	engine.SetCaseSensitive("ci", "pipelines", []string{"name"})
+	return engine
+}
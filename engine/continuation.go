@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"devopsdb/models"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"golang.org/x/exp/slices"
+)
+
+// continuation is where the next page of a query starts. It's given to callers as an
+// opaque token, which they pass back with the same query.
+//
+// When the query is sorted by columns it returns, the page starts after the last row's
+// values for them (After), which is just another filter, so it can be sent to the API
+// rather than reading every row before it again. Offset is then the number of rows with
+// those same values that have already been returned. Otherwise the page starts Offset
+// rows in to the results. Query is a hash of the query the token is for, so it can't be
+// used to page through another one
+type continuation struct {
+	Query  string   `json:"query"`
+	After  []string `json:"after,omitempty"`
+	Offset int      `json:"offset,omitempty"`
+}
+
+func (c continuation) token() string {
+	text, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(text)
+}
+
+func readContinuation(token string) (continuation, error) {
+	var result continuation
+	text, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || json.Unmarshal(text, &result) != nil || result.Offset < 0 {
+		return result, fmt.Errorf("the continuation token isn't valid")
+	}
+	return result, nil
+}
+
+// Changes the query to return the page its continuation token points at, and returns
+// where that page starts
+func continueQuery(query models.Query) (models.Query, continuation, error) {
+	if query.Continuation == "" {
+		return query, continuation{Query: queryHash(query), Offset: query.Offset}, nil
+	}
+
+	start, err := readContinuation(query.Continuation)
+	if err != nil {
+		return query, start, err
+	}
+
+	if start.Query != queryHash(query) {
+		return query, start, fmt.Errorf("the continuation token isn't for this query")
+	}
+
+	if start.After != nil {
+		if !sortsByReturnedColumns(query) || len(start.After) != len(query.OrderBy) {
+			return query, start, fmt.Errorf("the continuation token isn't for this query")
+		}
+		query.Filters = append(slices.Clone(query.Filters), afterFilter(query.OrderBy, start.After))
+	}
+
+	query.Continuation = ""
+	query.Offset = start.Offset
+	return query, start, nil
+}
+
+// Identifies the query a continuation token is for. The offset is left out, as the token
+// says where its page starts, and so is 'explain', so the next page can be explained
+func queryHash(query models.Query) string {
+	query.Continuation = ""
+	query.Offset = 0
+	query.Explain = false
+	query.Analyze = false
+	text, _ := json.Marshal(query)
+	hash := sha256.Sum256(text)
+	return base64.RawURLEncoding.EncodeToString(hash[:12])
+}
+
+// Whether the query is sorted by columns that it returns, and that can be filtered in the
+// 'where' clause without changing any other rows, so the pages can start after the
+// values of the last row
+func sortsByReturnedColumns(query models.Query) bool {
+	if len(query.OrderBy) == 0 || len(query.SetOperations) > 0 || len(query.Windows) > 0 {
+		return false
+	}
+
+	for _, orderBy := range query.OrderBy {
+		if _, isExpression := query.Expressions[orderBy.FieldName]; isExpression {
+			return false
+		}
+		for _, aggregate := range query.Aggregates {
+			if aggregate.Name == orderBy.FieldName {
+				return false
+			}
+		}
+
+		// With 'select *' the columns of joined tables are returned with the table's alias,
+		// so the sorted column might not be in the results under the same name
+		if len(query.Columns) == 0 && len(query.Joins) > 0 {
+			return false
+		}
+		if len(query.Columns) > 0 && !slices.Contains(query.Columns, orderBy.FieldName) {
+			return false
+		}
+	}
+	return true
+}
+
+// The filter for the rows that sort at or after the values, e.g. for 'order by a, b desc'
+// "a > x or (a >= x and b <= y)"
+func afterFilter(orderBy []models.OrderBy, values []string) models.QueryFilter {
+	after, atOrAfter := "gt", "ge"
+	if orderBy[0].Descending {
+		after, atOrAfter = "lt", "le"
+	}
+
+	filter := models.QueryFilter{Type: atOrAfter, FieldName: orderBy[0].FieldName, Value: values[0]}
+	if len(orderBy) == 1 {
+		return filter
+	}
+
+	return models.QueryFilter{Type: "or", Children: []models.QueryFilter{
+		{Type: after, FieldName: orderBy[0].FieldName, Value: values[0]},
+		{Type: "and", Children: []models.QueryFilter{filter, afterFilter(orderBy[1:], values[1:])}},
+	}}
+}
+
+// pageIterator keeps track of the rows returned, so it can work out where the next page
+// starts
+type pageIterator struct {
+	rows          models.RowIterator
+	query         models.Query
+	start         continuation
+	keyset        bool     // Whether the next page starts after the values of the last row
+	caseSensitive []string // The columns that are sorted with case
+
+	returned int
+	last     map[string]string
+	same     int  // How many rows in a row have had the last row's values
+	more     bool // Whether there was a row after the last one on this page
+}
+
+func newPageIterator(rows models.RowIterator, query models.Query, start continuation, caseSensitive []string) *pageIterator {
+	return &pageIterator{rows: rows, query: query, start: start, keyset: sortsByReturnedColumns(query), caseSensitive: caseSensitive}
+}
+
+func (it *pageIterator) Next() (map[string]string, error) {
+	row, err := it.rows.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	// The row after the page's last one is only read to see if there is one
+	if it.returned == it.query.Limit {
+		it.more = true
+		return nil, io.EOF
+	}
+
+	it.returned++
+	if it.last != nil && compareRows(row, it.last, it.query.OrderBy, it.caseSensitive) == 0 {
+		it.same++
+	} else {
+		it.same = 1
+	}
+	it.last = row
+	return row, nil
+}
+
+func (it *pageIterator) Close() {
+	it.rows.Close()
+}
+
+// The token for the next page, or empty if there are no more rows so there isn't one
+func (it *pageIterator) token() string {
+	if !it.more {
+		return ""
+	}
+
+	next := continuation{Query: it.start.Query, Offset: it.start.Offset + it.returned}
+	if !it.keyset {
+		return next.token()
+	}
+
+	next.After = make([]string, len(it.query.OrderBy))
+	for index, orderBy := range it.query.OrderBy {
+		next.After[index] = it.last[orderBy.FieldName]
+	}
+	next.Offset = it.same
+
+	// If every row had the same values, the rows before this page with them count too
+	if it.same == it.returned {
+		switch {
+		case it.start.After != nil && it.sameValues(it.start.After, next.After):
+			next.Offset += it.start.Offset
+		case it.start.After == nil && it.start.Offset > 0:
+			// The rows skipped by the query's offset might have had them, so the next page
+			// has to be counted from the start
+			next = continuation{Query: it.start.Query, Offset: it.start.Offset + it.returned}
+		}
+	}
+	return next.token()
+}
+
+// Whether the values of the sorted columns are the same
+func (it *pageIterator) sameValues(a []string, b []string) bool {
+	for index, orderBy := range it.query.OrderBy {
+		if compareValues(a[index], b[index], slices.Contains(it.caseSensitive, orderBy.FieldName)) != 0 {
+			return false
+		}
+	}
+	return true
+}
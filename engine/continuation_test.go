@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContinuationTokensPageThroughSortedResults(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+	query := models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id", "duration"},
+		OrderBy: []models.OrderBy{{FieldName: "duration", Descending: true}},
+		Limit:   2,
+	}
+
+	result, err := engine.Execute(query)
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"id": "3", "duration": "10"}, {"id": "2", "duration": "7"}}, resultsOf(result))
+	token := result.ContinuationToken()
+
+	query.Continuation = token
+	result, err = engine.Execute(query)
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"id": "1", "duration": "5"}}, resultsOf(result))
+	assert.Equal(t, "", result.ContinuationToken())
+
+	// The page starts at the last row's values, which is a filter like any other, so a
+	// connector that supports it doesn't have to read the rows before it again
+	query.Explain = true
+	result, err = engine.Execute(query)
+	var lines []string
+	for _, row := range resultsOf(result) {
+		lines = append(lines, row["plan"])
+	}
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"Limit 2 offset 1",
+		"  Project id, duration",
+		"    Sort duration desc",
+		"      Filter (run locally) duration <= '7'",
+		"        Scan ci.builds",
+		"          - columns: id, duration",
+		"          - estimated API calls: 1 (more if the results are paged)",
+	}, lines)
+	assert.Equal(t, 2, len(connector.queries))
+}
+
+func TestContinuationTokensPageThroughRowsWithTheSameValues(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+	query := models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id", "pipeline"},
+		OrderBy: []models.OrderBy{{FieldName: "pipeline"}},
+		Limit:   1,
+	}
+
+	var ids []string
+	for page := 0; page < 5; page++ {
+		result, err := engine.Execute(query)
+		assert.Nil(t, err)
+		for _, row := range resultsOf(result) {
+			ids = append(ids, row["id"])
+		}
+
+		query.Continuation = result.ContinuationToken()
+		if query.Continuation == "" {
+			break
+		}
+	}
+
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+}
+
+func TestContinuationTokensForUnsortedResultsSkipTheRowsAlreadyReturned(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+	query := models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id"},
+		Limit:   2,
+	}
+
+	result, _ := engine.Execute(query)
+	assert.Equal(t, models.ResultTable{{"id": "1"}, {"id": "2"}}, resultsOf(result))
+
+	query.Continuation = result.ContinuationToken()
+	result, err := engine.Execute(query)
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"id": "3"}}, resultsOf(result))
+
+	query.Continuation = "not a token"
+	_, err = engine.Execute(query)
+	assert.EqualError(t, err, "the continuation token isn't valid")
+}
+
+func TestNoContinuationTokenWhenThePageHasTheLastRow(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+	query := models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id"},
+		OrderBy: []models.OrderBy{{FieldName: "id"}},
+		Limit:   1,
+	}
+
+	// There are three builds, so the third page is full but there isn't a fourth
+	var pages []models.ResultTable
+	for len(pages) < 3 {
+		result, err := engine.Execute(query)
+		assert.Nil(t, err)
+		pages = append(pages, resultsOf(result))
+		query.Continuation = result.ContinuationToken()
+	}
+
+	assert.Equal(t, []models.ResultTable{{{"id": "1"}}, {{"id": "2"}}, {{"id": "3"}}}, pages)
+	assert.Equal(t, "", query.Continuation)
+}
+
+func TestContinuationTokensOnlyWorkWithTheirQuery(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+	query := models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id"},
+		Limit:   1,
+		Offset:  1,
+	}
+
+	result, _ := engine.Execute(query)
+	assert.Equal(t, models.ResultTable{{"id": "2"}}, resultsOf(result))
+	token := result.ContinuationToken()
+
+	// The same query, with its offset, gets the next page
+	query.Continuation = token
+	result, err := engine.Execute(query)
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"id": "3"}}, resultsOf(result))
+
+	other := query
+	other.Filters = []models.QueryFilter{{Type: "eq", FieldName: "result", Value: "failed"}}
+	_, err = engine.Execute(other)
+	assert.EqualError(t, err, "the continuation token isn't for this query")
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"devopsdb/connectors"
+	"devopsdb/middleware"
+	"devopsdb/models"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+func createPlannerEngine() (*QueryEngine, *tableConnector) {
+	engine := New()
+	connector := &tableConnector{tables: map[string]models.ResultTable{
+		"builds": {
+			{"id": "1", "pipeline": "10", "result": "succeeded", "duration": "5"},
+			{"id": "2", "pipeline": "10", "result": "failed", "duration": "7"},
+			{"id": "3", "pipeline": "20", "result": "succeeded", "duration": "10"},
+		},
+		"pipelines": {
+			{"id": "10", "name": "deploy", "folder": "prod"},
+			{"id": "20", "name": "test", "folder": "dev"},
+			{"id": "30", "name": "unused", "folder": "dev"},
+		},
+	}}
+	engine.AddConnector("ci", connector)
+	return engine, connector
+}
+
+// tableConnector serves tables from memory, and can only filter pipelines by folder (or
+// lower(name)) and builds by pipeline, ignoring case
+type tableConnector struct {
+	tables  map[string]models.ResultTable
+	queries []connectors.ConnectorQuery
+}
+
+func (c *tableConnector) GetSchemaForTable(table string) ([]string, error) {
+	if table == "builds" {
+		return []string{"id", "pipeline", "result", "duration"}, nil
+	}
+	return []string{"id", "name", "folder"}, nil
+}
+
+func (c *tableConnector) GetRequiredFiltersForTable(table string) []connectors.RequiredFilter {
+	return nil
+}
+
+func (c *tableConnector) SupportsFilter(table string, filter models.QueryFilter) bool {
+	lowerName := filter.Expression != nil && filter.Expression.String() == "lower(name)"
+	return !filter.IsCaseSensitive() && ((table == "pipelines" && (filter.FieldName == "folder" || lowerName) && filter.Type == "eq") ||
+		(table == "builds" && filter.FieldName == "pipeline" && filter.Type == "in"))
+}
+
+func (c *tableConnector) Get(query connectors.ConnectorQuery) models.RowIterator {
+	c.queries = append(c.queries, query)
+
+	var rows models.ResultTable
+	for _, row := range c.tables[query.TableName] {
+		copied := make(map[string]string)
+		for column, value := range row {
+			if len(query.ColumnNames) == 0 || slices.Contains(query.ColumnNames, column) {
+				copied[column] = value
+			}
+		}
+		if passes(row, query.Filters) {
+			rows = append(rows, copied)
+		}
+	}
+	return models.NewTableIterator(rows)
+}
+
+func (c *tableConnector) queryFor(table string) connectors.ConnectorQuery {
+	index := slices.IndexFunc(c.queries, func(query connectors.ConnectorQuery) bool {
+		return strings.EqualFold(query.TableName, table)
+	})
+	if index < 0 {
+		return connectors.ConnectorQuery{}
+	}
+	return c.queries[index]
+}
+
+func passes(row map[string]string, filters []models.QueryFilter) bool {
+	for _, filter := range filters {
+		if len(filter.Filter(models.ResultTable{row})) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// httpConnector makes two requests for each query, and returns a single row
+type httpConnector struct {
+	url    string
+	client *http.Client
+}
+
+func (c *httpConnector) GetSchemaForTable(table string) ([]string, error) {
+	return []string{"body"}, nil
+}
+
+func (c *httpConnector) GetRequiredFiltersForTable(table string) []connectors.RequiredFilter {
+	return nil
+}
+
+func (c *httpConnector) SupportsFilter(table string, filter models.QueryFilter) bool {
+	return false
+}
+
+func (c *httpConnector) Get(query connectors.ConnectorQuery) models.RowIterator {
+	ctx := middleware.WithStats(context.Background(), query.Stats)
+
+	var body []byte
+	for i := 0; i < 2; i++ {
+		request, _ := http.NewRequestWithContext(ctx, "GET", c.url, nil)
+		response, err := c.client.Do(request)
+		if err != nil {
+			return models.NewErrorIterator(err)
+		}
+		body, _ = io.ReadAll(response.Body)
+		response.Body.Close()
+	}
+
+	return models.NewTableIterator(models.ResultTable{{"body": string(body)}})
+}
+
+// Reads every row from the result
+func resultsOf(result *models.QueryResult) models.ResultTable {
+	results, _ := models.Collect(result.Rows)
+	return results
+}
@@ -0,0 +1,296 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// How many rows of the left side a lookup join reads before it looks up their keys
+var lookupBatchSize = 100
+
+// joinNode joins the rows of its right child on to its left child. The right side
+// is read in to a hash table (while the left side starts to be read), so each left row
+// only needs one lookup to find its matches. If there are no columns to join on, every row matches every other.
+//
+// If the connector for the right side can filter on the join keys, it's a lookup join
+// instead: the left side is read in batches, and the right side is read once per batch
+// with just the keys from that batch, rather than reading the whole table
+type joinNode struct {
+	left      planNode
+	right     planNode
+	joinType  string   // 'inner' or 'left'
+	leftKeys  []string // The columns of the left rows that have to equal..
+	rightKeys []string // .. these columns of the right rows
+
+	// The keys on both sides that are compared with case, because one of them is case-sensitive
+	caseSensitive []string
+
+	// The scan on the right that the keys are sent to, for a lookup join
+	lookup *scanNode
+}
+
+// lookupNode is the right side of a lookup join: the scan the keys are sent to, or a node
+// that only passes some of its rows on. It reads just the rows with the keys in the
+// filters, given the values of the scan's other required filters
+type lookupNode interface {
+	planNode
+	openWithLookup(keys []models.QueryFilter, required []map[string]string) (models.RowIterator, error)
+}
+
+func (n *joinNode) open() (models.RowIterator, error) {
+	left, err := n.left.open()
+	if err != nil {
+		return nil, err
+	}
+
+	if n.lookup != nil {
+		return &lookupJoinIterator{left: left, node: n}, nil
+	}
+
+	right, err := n.right.open()
+	if err != nil {
+		left.Close()
+		return nil, err
+	}
+
+	return newHashJoinIterator(left, right, n), nil
+}
+
+func (n *joinNode) children() []planNode {
+	return []planNode{n.left, n.right}
+}
+
+func (n *joinNode) describe() []string {
+	if len(n.leftKeys) == 0 {
+		return []string{"Join (" + n.joinType + ", every row with every row)"}
+	}
+
+	var conditions []string
+	for index := range n.leftKeys {
+		conditions = append(conditions, n.leftKeys[index]+" = "+n.rightKeys[index])
+	}
+
+	if n.lookup != nil {
+		return []string{
+			"Lookup join (" + n.joinType + ") on " + strings.Join(conditions, " and "),
+			fmt.Sprintf("looks up the keys in %v.%v, %v rows at a time", n.lookup.schema, n.lookup.table, lookupBatchSize),
+		}
+	}
+	return []string{"Hash join (" + n.joinType + ") on " + strings.Join(conditions, " and ")}
+}
+
+type hashJoinIterator struct {
+	left  models.RowIterator
+	right models.RowIterator
+	node  *joinNode
+
+	// The right side is read in the background, and the result is sent once it's done
+	built   chan error
+	closing chan struct{}
+	table   map[string]models.ResultTable
+
+	// The left row we're returning matches for, and the matches we haven't returned yet
+	current map[string]string
+	matches models.ResultTable
+}
+
+// Starts reading the right side straight away, so the calls for it are made while the
+// first rows of the left side are read
+func newHashJoinIterator(left models.RowIterator, right models.RowIterator, node *joinNode) *hashJoinIterator {
+	it := &hashJoinIterator{
+		left:    left,
+		right:   right,
+		node:    node,
+		built:   make(chan error, 1),
+		closing: make(chan struct{}),
+		table:   make(map[string]models.ResultTable),
+	}
+	go func() {
+		it.built <- it.build()
+	}()
+	return it
+}
+
+func (it *hashJoinIterator) Next() (map[string]string, error) {
+	for len(it.matches) == 0 {
+		row, err := it.left.Next()
+
+		// Only the first row has to wait for the right side, but it's read first
+		if it.built != nil {
+			buildErr := <-it.built
+			it.built = nil
+			if buildErr != nil {
+				return nil, buildErr
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		it.current = row
+		it.matches = it.table[joinKey(row, it.node.leftKeys, it.node.caseSensitive)]
+
+		// Left joins keep the rows that don't match anything
+		if len(it.matches) == 0 && it.node.joinType == "left" {
+			return copyRow(row), nil
+		}
+	}
+
+	match := it.matches[0]
+	it.matches = it.matches[1:]
+
+	joined := copyRow(it.current)
+	for column, value := range match {
+		joined[column] = value
+	}
+	return joined, nil
+}
+
+func (it *hashJoinIterator) build() error {
+	defer it.right.Close()
+
+	for {
+		// We stop early if we're closed before the right side has all been read
+		select {
+		case <-it.closing:
+			return io.EOF
+		default:
+		}
+
+		row, err := it.right.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		key := joinKey(row, it.node.rightKeys, it.node.caseSensitive)
+		it.table[key] = append(it.table[key], row)
+	}
+}
+
+// The right side is closed once it's been read, so we only wait for that to happen
+func (it *hashJoinIterator) Close() {
+	it.left.Close()
+	if it.built != nil {
+		close(it.closing)
+		<-it.built
+		it.built = nil
+	}
+}
+
+// lookupJoinIterator reads a batch of left rows, then hash joins them to the right
+// rows that have their keys
+type lookupJoinIterator struct {
+	left models.RowIterator
+	node *joinNode
+
+	// The values of the required filters that don't come from the keys, which are the same
+	// for every batch, so they're only worked out for the first
+	required []map[string]string
+
+	batch    *hashJoinIterator
+	finished bool
+}
+
+func (it *lookupJoinIterator) Next() (map[string]string, error) {
+	for {
+		if it.batch == nil {
+			if it.finished {
+				return nil, io.EOF
+			}
+
+			err := it.nextBatch()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		row, err := it.batch.Next()
+		if err == io.EOF {
+			it.batch.Close()
+			it.batch = nil
+			continue
+		}
+		return row, err
+	}
+}
+
+func (it *lookupJoinIterator) nextBatch() error {
+	var rows models.ResultTable
+	for len(rows) < lookupBatchSize {
+		row, err := it.left.Next()
+		if err == io.EOF {
+			it.finished = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	scan := it.node.lookup
+	if it.required == nil {
+		required, err := scan.resolveRequiredFiltersForLookup()
+		if err != nil {
+			return err
+		}
+		it.required = required
+	}
+
+	// The scan only returns rows with the keys in this batch
+	var keys []models.QueryFilter
+	for index, key := range it.node.rightKeys {
+		field := scan.localName(key)
+		if !slices.Contains(scan.lookupKeys, field) {
+			continue
+		}
+
+		leftKey := it.node.leftKeys[index]
+		var values []string
+		seen := make(map[string]bool)
+		for _, row := range rows {
+			value := valueKey(row[leftKey], slices.Contains(it.node.caseSensitive, leftKey))
+			if !seen[value] {
+				seen[value] = true
+				values = append(values, row[leftKey])
+			}
+		}
+		keys = append(keys, models.QueryFilter{Type: "in", FieldName: field, Values: values})
+	}
+
+	right, err := it.node.right.(lookupNode).openWithLookup(keys, it.required)
+	if err != nil {
+		return err
+	}
+
+	it.batch = newHashJoinIterator(models.NewTableIterator(rows), right, it.node)
+	return nil
+}
+
+func (it *lookupJoinIterator) Close() {
+	it.left.Close()
+	if it.batch != nil {
+		it.batch.Close()
+	}
+}
+
+func copyRow(row map[string]string) map[string]string {
+	result := make(map[string]string, len(row))
+	for column, value := range row {
+		result[column] = value
+	}
+	return result
+}
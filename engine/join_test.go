@@ -0,0 +1,280 @@
+package engine
+
+import (
+	"devopsdb/connectors"
+	"devopsdb/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// e.g. "select b.id, p.name from ci.builds b inner join ci.pipelines p on p.id = b.pipeline"
+func TestInnerJoin(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds", Alias: "b",
+		Columns: []string{"b.id", "p.name"},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "pipelines", Alias: "p",
+			On: []models.JoinCondition{{LeftField: "p.id", RightField: "b.pipeline"}},
+		}},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b.id", "p.name"}, result.Columns)
+	assert.Equal(t, models.ResultTable{
+		{"b.id": "1", "p.name": "deploy"},
+		{"b.id": "2", "p.name": "deploy"},
+		{"b.id": "3", "p.name": "test"},
+	}, results)
+}
+
+// Unqualified columns are found in whichever table has them
+func TestLeftJoinKeepsRowsWithoutMatches(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "pipelines",
+		Columns: []string{"name", "result"},
+		Joins: []models.Join{{
+			Type: "left", SchemaName: "ci", Table: "builds",
+			On: []models.JoinCondition{{LeftField: "pipelines.id", RightField: "builds.pipeline"}},
+		}},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"name": "deploy", "result": "succeeded"},
+		{"name": "deploy", "result": "failed"},
+		{"name": "test", "result": "succeeded"},
+		{"name": "unused", "result": ""},
+	}, results)
+}
+
+func TestLookupJoinSendsTheKeysInBatches(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+	lookupBatchSize = 2
+	defer func() { lookupBatchSize = 100 }()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "pipelines", Alias: "p",
+		Columns: []string{"p.name", "b.id"},
+		Filters: []models.QueryFilter{{Type: "ne", FieldName: "b.result", Value: "failed"}},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "builds", Alias: "b",
+			On: []models.JoinCondition{{LeftField: "b.pipeline", RightField: "p.id"}},
+		}},
+	})
+	results := resultsOf(result)
+
+	var lookups []models.QueryFilter
+	for _, query := range connector.queries {
+		if query.TableName == "builds" {
+			lookups = append(lookups, query.Filters...)
+		}
+	}
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"p.name": "deploy", "b.id": "1"},
+		{"p.name": "test", "b.id": "3"},
+	}, results)
+	assert.Equal(t, []models.QueryFilter{
+		{Type: "in", FieldName: "pipeline", Values: []string{"10", "20"}},
+		{Type: "in", FieldName: "pipeline", Values: []string{"30"}},
+	}, lookups)
+}
+
+// projectBuildsConnector can only read builds one project at a time
+type projectBuildsConnector struct {
+	*tableConnector
+}
+
+func (c *projectBuildsConnector) GetRequiredFiltersForTable(table string) []connectors.RequiredFilter {
+	if table == "builds" {
+		return []connectors.RequiredFilter{{FieldName: "project", SourceTable: "projects", SourceColumn: "name"}}
+	}
+	return nil
+}
+
+func TestLookupJoinOnlyReadsTheValuesOfRequiredFiltersOnce(t *testing.T) {
+
+	_, tables := createPlannerEngine()
+	tables.tables["projects"] = models.ResultTable{{"name": "web"}}
+	connector := &projectBuildsConnector{tables}
+
+	engine := New()
+	engine.AddConnector("ci", connector)
+	lookupBatchSize = 1
+	defer func() { lookupBatchSize = 100 }()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "pipelines", Alias: "p",
+		Columns: []string{"p.name", "b.id"},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "builds", Alias: "b",
+			On: []models.JoinCondition{{LeftField: "b.pipeline", RightField: "p.id"}},
+		}},
+	})
+	results := resultsOf(result)
+
+	calls := make(map[string]int)
+	for _, query := range connector.queries {
+		calls[query.TableName]++
+	}
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"p.name": "deploy", "b.id": "1"},
+		{"p.name": "deploy", "b.id": "2"},
+		{"p.name": "test", "b.id": "3"},
+	}, results)
+	assert.Equal(t, map[string]int{"pipelines": 1, "projects": 1, "builds": 3}, calls)
+}
+
+func TestExplainShowsLookupJoins(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "pipelines", Alias: "p",
+		Columns: []string{"p.name", "b.id"},
+		Joins: []models.Join{{
+			Type: "left", SchemaName: "ci", Table: "builds", Alias: "b",
+			On: []models.JoinCondition{{LeftField: "p.id", RightField: "b.pipeline"}},
+		}},
+		Explain: true,
+	})
+	results := resultsOf(result)
+
+	var lines []string
+	for _, row := range results {
+		lines = append(lines, row["plan"])
+	}
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"Project p.name, b.id",
+		"  Lookup join (left) on p.id = b.pipeline",
+		"    - looks up the keys in ci.builds, 100 rows at a time",
+		"    Scan ci.pipelines as p",
+		"      - columns: name, id",
+		"      - estimated API calls: 1 (more if the results are paged)",
+		"    Scan ci.builds as b",
+		"      - columns: id, pipeline",
+		"      - sent to the API: the join's keys for pipeline",
+		"      - estimated API calls: 1 for each batch of keys from the join (more if the results are paged)",
+	}, lines)
+	assert.Equal(t, 0, len(connector.queries))
+}
+
+func TestPushesFiltersToEachSideOfJoin(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, _ := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds", Alias: "b",
+		Columns: []string{"b.id"},
+		Filters: []models.QueryFilter{{Type: "and", Children: []models.QueryFilter{
+			{Type: "eq", FieldName: "p.folder", Value: "prod"},
+			{Type: "eq", FieldName: "b.result", Value: "succeeded"},
+		}}},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "pipelines", Alias: "p",
+			On: []models.JoinCondition{{LeftField: "b.pipeline", RightField: "p.id"}},
+		}},
+	})
+	results := resultsOf(result)
+
+	// Pipelines can filter by folder themselves, but builds are filtered as they're read
+	builds := connector.queryFor("builds")
+	pipelines := connector.queryFor("pipelines")
+	assert.Equal(t, []models.QueryFilter(nil), builds.Filters)
+	assert.Equal(t, []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: "prod"}}, pipelines.Filters)
+	assert.Equal(t, []string{"id", "pipeline", "result"}, builds.ColumnNames)
+	assert.Equal(t, models.ResultTable{{"b.id": "1"}}, results)
+}
+
+func TestComparesColumnsOfJoinedTablesAfterTheJoin(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	// b.id >= p.id - 8
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds", Alias: "b",
+		Columns: []string{"b.id"},
+		Filters: []models.QueryFilter{{Type: "ge", FieldName: "b.id", ValueExpression: &models.Expression{
+			Type: "operator", Operator: "-", Arguments: []models.Expression{
+				{Type: "column", FieldName: "p.id"},
+				{Type: "value", Value: "8"},
+			},
+		}}},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "pipelines", Alias: "p",
+			On: []models.JoinCondition{{LeftField: "b.pipeline", RightField: "p.id"}},
+		}},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"b.id": "2"}}, resultsOf(result))
+	assert.Equal(t, []models.QueryFilter(nil), connector.queryFor("builds").Filters)
+	assert.Equal(t, []models.QueryFilter(nil), connector.queryFor("pipelines").Filters)
+}
+
+// slowConnector takes a while to answer each call, and records how many it's answering at once
+type slowConnector struct {
+	*tableConnector
+
+	lock       sync.Mutex
+	running    int
+	maxRunning int
+}
+
+func (c *slowConnector) Get(query connectors.ConnectorQuery) models.RowIterator {
+	c.lock.Lock()
+	c.running++
+	if c.running > c.maxRunning {
+		c.maxRunning = c.running
+	}
+	rows := c.tableConnector.Get(query)
+	c.lock.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	c.lock.Lock()
+	c.running--
+	c.lock.Unlock()
+	return rows
+}
+
+func TestHashJoinReadsBothSidesAtOnce(t *testing.T) {
+
+	_, tables := createPlannerEngine()
+	connector := &slowConnector{tableConnector: tables}
+
+	engine := New()
+	engine.AddConnector("ci", connector)
+	engine.SetConcurrency("ci", 2)
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds", Alias: "b",
+		Columns: []string{"b.id", "p.name"},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "pipelines", Alias: "p",
+			On: []models.JoinCondition{{LeftField: "p.id", RightField: "b.pipeline"}},
+		}},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, 2, connector.maxRunning)
+}
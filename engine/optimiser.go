@@ -0,0 +1,375 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// optimise rewrites the plan so that as much work as possible happens in the
+// connectors (and so the APIs), and we only ask them for what we need
+func optimise(node planNode) (planNode, error) {
+	node = pushDownFilters(node)
+	node = applyConnectorFilters(node)
+	chooseLookupJoins(node)
+	pushDownLimit(node)
+	pruneColumns(node, nil, true)
+
+	// Now we know which filters apply to each table, we can check that we know how
+	// to call each connector
+	return node, planScans(node)
+}
+
+// Moves each filter as close to the table it's about as it can go, so we can filter
+// the rows before they're joined, and offer the filter to the connector
+func pushDownFilters(node planNode) planNode {
+	filter, isFilter := node.(*filterNode)
+	if !isFilter {
+		return withChildren(node, pushDownFilters)
+	}
+
+	var kept []models.QueryFilter
+	for _, condition := range models.SplitConjuncts(filter.filters) {
+		if !pushFilter(filter.child, condition) {
+			kept = append(kept, condition)
+		}
+	}
+
+	child := pushDownFilters(filter.child)
+	if len(kept) == 0 {
+		return child
+	}
+
+	filter.child = child
+	filter.filters = kept
+	return filter
+}
+
+// Tries to move the filter in to the node, returning false if it has to be applied
+// above it instead
+func pushFilter(node planNode, filter models.QueryFilter) bool {
+	switch n := node.(type) {
+
+	case *scanNode:
+		n.filters = append(n.filters, filter)
+		return true
+
+	case *filterNode:
+		// This node will be pushed down too, so we can just join it
+		n.filters = append(n.filters, filter)
+		return true
+
+	case *joinNode:
+		fields := models.FieldNames([]models.QueryFilter{filter})
+		if providesAll(n.left, fields) {
+			return pushFilter(n.left, filter)
+		}
+
+		// The right side of a left join can be missing, which a filter on it needs to
+		// see, so it can only be filtered after the join
+		if n.joinType == "inner" && providesAll(n.right, fields) {
+			return pushFilter(n.right, filter)
+		}
+	}
+
+	return false
+}
+
+// Gives each scan's filters to its connector, and applies the ones the connector
+// can't handle itself just above the scan
+func applyConnectorFilters(node planNode) planNode {
+	scan, isScan := node.(*scanNode)
+	if !isScan {
+		return withChildren(node, applyConnectorFilters)
+	}
+
+	var local []models.QueryFilter
+	var residual []models.QueryFilter
+	for _, filter := range scan.filters {
+		local = append(local, localFilter(scan, filter))
+	}
+	scan.filters = local
+
+	scan.pushed, residual = splitFilters(scan.connector, scan.table, local)
+	if len(residual) == 0 {
+		return scan
+	}
+
+	// The rows we filter have the scan's column names, rather than the connector's
+	for index := range residual {
+		residual[index] = qualifyFilter(scan, residual[index])
+	}
+	return &filterNode{child: scan, filters: residual}
+}
+
+// Joins become lookup joins when the connector for the right side can filter on the join
+// keys, so we only read the rows that can match rather than the whole table
+func chooseLookupJoins(node planNode) {
+	for _, child := range node.children() {
+		chooseLookupJoins(child)
+	}
+
+	join, isJoin := node.(*joinNode)
+	if !isJoin {
+		return
+	}
+
+	// Filters the connector can't apply are fine, as they're applied to each batch
+	right := join.right
+	if filter, isFilter := right.(*filterNode); isFilter {
+		right = filter.child
+	}
+	scan, isScan := right.(*scanNode)
+	if !isScan {
+		return
+	}
+
+	var keys []string
+	for _, key := range join.rightKeys {
+		field := scan.localName(key)
+		if scan.connector.SupportsFilter(scan.table, models.QueryFilter{Type: "in", FieldName: field}) {
+			keys = append(keys, field)
+		}
+	}
+
+	if len(keys) > 0 {
+		join.lookup = scan
+		scan.lookupKeys = keys
+	}
+}
+
+// If the connector is doing all of the filtering, then the first rows it finds
+// are the ones we'll return (after the offset), so it can stop as soon as it has enough
+func pushDownLimit(node planNode) {
+	if limit, isLimit := node.(*limitNode); isLimit && limit.limit > 0 {
+		// Picking and computing columns doesn't change which rows there are
+		child := limit.child
+		for {
+			if project, isProject := child.(*projectNode); isProject {
+				child = project.child
+			} else if compute, isCompute := child.(*computeNode); isCompute {
+				child = compute.child
+			} else {
+				break
+			}
+		}
+
+		if scan, isScan := child.(*scanNode); isScan {
+			scan.top = limit.limit + limit.offset
+		}
+	}
+
+	for _, child := range node.children() {
+		pushDownLimit(child)
+	}
+}
+
+// Works out which columns each scan needs to ask its connector for, given the columns
+// every node above it uses. 'all' means every column is returned, as in 'select *'
+func pruneColumns(node planNode, needed []string, all bool) {
+	switch n := node.(type) {
+
+	case *scanNode:
+		n.columns = nil
+		if all {
+			return
+		}
+		n.columns = []string{}
+		for _, field := range needed {
+			if n.provides(field) && !slices.Contains(n.columns, n.localName(field)) {
+				n.columns = append(n.columns, n.localName(field))
+			}
+		}
+
+	case *projectNode:
+		pruneColumns(n.child, n.sources, false)
+
+	case *subqueryNode:
+		// The subquery's columns don't have the alias
+		var columns []string
+		for _, field := range needed {
+			if n.provides(field) {
+				columns = append(columns, n.localName(field))
+			}
+		}
+		pruneColumns(n.child, columns, all)
+
+	case *aggregateNode:
+		columns := slices.Clone(n.groupBy)
+		for _, aggregate := range n.aggregates {
+			if aggregate.FieldName != "" {
+				columns = append(columns, aggregate.FieldName)
+			}
+		}
+		pruneColumns(n.child, columns, false)
+
+	case *filterNode:
+		pruneColumns(n.child, append(slices.Clone(needed), models.FieldNames(n.filters)...), all)
+
+	case *sortNode:
+		columns := slices.Clone(needed)
+		for _, orderBy := range n.orderBy {
+			columns = append(columns, orderBy.FieldName)
+		}
+		pruneColumns(n.child, columns, all)
+
+	case *computeNode:
+		// The computed columns come from the columns their expressions use
+		var columns []string
+		for _, field := range needed {
+			if !slices.Contains(n.names, field) {
+				columns = append(columns, field)
+			}
+		}
+		for _, expression := range n.expressions {
+			columns = append(columns, expression.FieldNames()...)
+		}
+		pruneColumns(n.child, columns, all)
+
+	case *windowNode:
+		var columns []string
+		for _, field := range needed {
+			if !windowIsUsed(n.windows, field) {
+				columns = append(columns, field)
+			}
+		}
+		for _, window := range n.windows {
+			if window.FieldName != "" {
+				columns = append(columns, window.FieldName)
+			}
+			columns = append(columns, window.PartitionBy...)
+			for _, orderBy := range window.OrderBy {
+				columns = append(columns, orderBy.FieldName)
+			}
+		}
+		pruneColumns(n.child, columns, all)
+
+	case *setOperationNode:
+		// Every column is used to compare the rows
+		pruneColumns(n.left, n.leftColumns, false)
+		pruneColumns(n.right, n.rightColumns, false)
+
+	case *withNode:
+		// Each query in the 'with' clause returns all of its columns, as any of them can be used
+		for _, expression := range n.expressions {
+			pruneColumns(expression, nil, true)
+		}
+		pruneColumns(n.child, needed, all)
+
+	case *subqueriesNode:
+		for _, subquery := range n.subqueries {
+			pruneColumns(subquery, nil, true)
+		}
+		pruneColumns(n.child, needed, all)
+
+	case *joinNode:
+		columns := append(slices.Clone(needed), n.leftKeys...)
+		columns = append(columns, n.rightKeys...)
+		pruneColumns(n.left, columns, all)
+		pruneColumns(n.right, columns, all)
+
+	default:
+		for _, child := range node.children() {
+			pruneColumns(child, needed, all)
+		}
+	}
+}
+
+func planScans(node planNode) error {
+	if scan, isScan := node.(*scanNode); isScan {
+		return scan.planRequiredFilters()
+	}
+
+	for _, child := range node.children() {
+		err := planScans(child)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replaces each of the node's children with the result of the function
+func withChildren(node planNode, replace func(planNode) planNode) planNode {
+	switch n := node.(type) {
+	case *filterNode:
+		n.child = replace(n.child)
+	case *projectNode:
+		n.child = replace(n.child)
+	case *limitNode:
+		n.child = replace(n.child)
+	case *distinctNode:
+		n.child = replace(n.child)
+	case *computeNode:
+		n.child = replace(n.child)
+	case *sortNode:
+		n.child = replace(n.child)
+	case *aggregateNode:
+		n.child = replace(n.child)
+	case *windowNode:
+		n.child = replace(n.child)
+	case *subqueryNode:
+		n.child = replace(n.child)
+	case *joinNode:
+		n.left = replace(n.left)
+		n.right = replace(n.right)
+	case *setOperationNode:
+		n.left = replace(n.left)
+		n.right = replace(n.right)
+	case *withNode:
+		for index := range n.expressions {
+			n.expressions[index] = replace(n.expressions[index])
+		}
+		n.child = replace(n.child)
+	case *commonTableNode:
+		n.child = replace(n.child)
+	case *subqueriesNode:
+		for index := range n.subqueries {
+			n.subqueries[index] = replace(n.subqueries[index])
+		}
+		n.child = replace(n.child)
+	case *subqueryFilterNode:
+		n.child = replace(n.child)
+	}
+	return node
+}
+
+// Whether the node's rows have the column
+func provides(node planNode, field string) bool {
+	switch n := node.(type) {
+	case *scanNode:
+		return n.provides(field)
+	case *subqueryNode:
+		return n.provides(field)
+	case *joinNode:
+		return provides(n.left, field) || provides(n.right, field)
+	}
+
+	children := node.children()
+	return len(children) == 1 && provides(children[0], field)
+}
+
+func providesAll(node planNode, fields []string) bool {
+	for _, field := range fields {
+		if !provides(node, field) {
+			return false
+		}
+	}
+	return true
+}
+
+// Renames the filter's columns from the scan's names to the connector's
+func localFilter(scan *scanNode, filter models.QueryFilter) models.QueryFilter {
+	return filter.RenameFields(scan.localName)
+}
+
+// .. and back again
+func qualifyFilter(scan *scanNode, filter models.QueryFilter) models.QueryFilter {
+	return filter.RenameFields(func(field string) string {
+		if !scan.qualify {
+			return field
+		}
+		return scan.alias + "." + strings.TrimPrefix(field, scan.alias+".")
+	})
+}
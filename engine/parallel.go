@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"io"
+	"sync"
+)
+
+// How many rows each source can read ahead of the caller. Once a source's buffer is
+// full it waits for the caller to catch up, which keeps memory use bounded
+const parallelBufferSize = 100
+
+// newParallelIterator reads from up to 'concurrency' sources at the same time, but
+// returns all of the rows from the first source, then all of the second etc., so
+// the output is in the same order as if they'd been read one after the other
+//
+// Each source should already take its connector's slots (see engine.parallel), as this only
+// limits how many of these sources run at once
+func newParallelIterator(sources []func() models.RowIterator, concurrency int) models.RowIterator {
+	if concurrency <= 1 || len(sources) <= 1 {
+		return models.NewConcatIterator(sources)
+	}
+
+	it := &parallelIterator{
+		outputs: make([]chan parallelResult, len(sources)),
+		done:    make(chan struct{}),
+	}
+
+	for index := range sources {
+		it.outputs[index] = make(chan parallelResult, parallelBufferSize)
+	}
+
+	go it.dispatch(sources, concurrency)
+
+	return it
+}
+
+type parallelResult struct {
+	row map[string]string
+	err error
+}
+
+type parallelIterator struct {
+	outputs []chan parallelResult
+	current int
+
+	done      chan struct{}
+	closeOnce sync.Once
+	closed    bool
+}
+
+// Starts the sources in order, never running more than 'concurrency' at once. As the
+// sources are started in order, the one the caller is reading from is always running
+func (it *parallelIterator) dispatch(sources []func() models.RowIterator, concurrency int) {
+	slots := make(chan struct{}, concurrency)
+
+	for index, source := range sources {
+		select {
+		case slots <- struct{}{}:
+		case <-it.done:
+			return
+		}
+
+		// If we were closed while waiting, both cases above could have been ready
+		select {
+		case <-it.done:
+			return
+		default:
+		}
+
+		go func(source func() models.RowIterator, output chan parallelResult) {
+			defer func() { <-slots }()
+			defer close(output)
+			it.read(source(), output)
+		}(source, it.outputs[index])
+	}
+}
+
+func (it *parallelIterator) read(rows models.RowIterator, output chan parallelResult) {
+	defer rows.Close()
+
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return
+		}
+
+		select {
+		case output <- parallelResult{row: row, err: err}:
+		case <-it.done:
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (it *parallelIterator) Next() (map[string]string, error) {
+	// Sources that hadn't started when we were closed never will, so don't wait for them
+	if it.closed {
+		return nil, io.EOF
+	}
+
+	for it.current < len(it.outputs) {
+		result, open := <-it.outputs[it.current]
+		if !open {
+			it.current++
+			continue
+		}
+		return result.row, result.err
+	}
+
+	return nil, io.EOF
+}
+
+func (it *parallelIterator) Close() {
+	it.closed = true
+	it.closeOnce.Do(func() {
+		close(it.done)
+	})
+}
+
+// connectorSlots limits how many calls are made to each connector at the same time, across
+// every scan of its tables rather than just the calls for one of them
+type connectorSlots struct {
+	mutex sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// The schema's slots, which are made the first time they're needed
+func (s *connectorSlots) forSchema(schemaName string, limit int) chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.slots[schemaName] == nil {
+		if limit < 1 {
+			limit = 1
+		}
+		s.slots[schemaName] = make(chan struct{}, limit)
+	}
+	return s.slots[schemaName]
+}
+
+// Each time the limit changes, the next query makes new slots
+func (s *connectorSlots) reset(schemaName string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.slots, schemaName)
+}
+
+// Reads the sources, which each call the schema's connector, in parallel. However many
+// sources there are, and however many scans of the connector's tables are running at once,
+// the connector is only ever called as many times at once as its concurrency allows
+func (engine *QueryEngine) parallel(schemaName string, sources []func() models.RowIterator) models.RowIterator {
+	limit := engine.concurrency[schemaName]
+	slots := engine.slots.forSchema(schemaName, limit)
+
+	limited := make([]func() models.RowIterator, len(sources))
+	for index, source := range sources {
+		source := source
+		limited[index] = func() models.RowIterator {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			return &limitedIterator{rows: source(), slots: slots}
+		}
+	}
+
+	return newParallelIterator(limited, limit)
+}
+
+// limitedIterator takes one of its connector's slots while it reads each row, as that's
+// when the connector makes its calls (e.g. for the next page). It doesn't keep the slot
+// while the caller uses the row, so a scan that's waiting for its caller (e.g. the left
+// side of a join) never stops another scan of the same connector from being read
+type limitedIterator struct {
+	rows  models.RowIterator
+	slots chan struct{}
+}
+
+func (it *limitedIterator) Next() (map[string]string, error) {
+	it.slots <- struct{}{}
+	defer func() { <-it.slots }()
+	return it.rows.Next()
+}
+
+func (it *limitedIterator) Close() {
+	it.rows.Close()
+}
@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallelIteratorKeepsSourceOrder(t *testing.T) {
+
+	// The first sources are the slowest, so they'd finish last if we didn't keep the order
+	var sources []func() models.RowIterator
+	for index := 0; index < 5; index++ {
+		delay := time.Duration(5-index) * 5 * time.Millisecond
+		name := fmt.Sprint(index)
+		sources = append(sources, func() models.RowIterator {
+			time.Sleep(delay)
+			return models.NewTableIterator(models.ResultTable{{"name": name + "a"}, {"name": name + "b"}})
+		})
+	}
+
+	results, err := models.Collect(newParallelIterator(sources, 3))
+
+	assert.Nil(t, err)
+	var names []string
+	for _, row := range results {
+		names = append(names, row["name"])
+	}
+	assert.Equal(t, []string{"0a", "0b", "1a", "1b", "2a", "2b", "3a", "3b", "4a", "4b"}, names)
+}
+
+func TestParallelIteratorLimitsConcurrency(t *testing.T) {
+
+	var lock sync.Mutex
+	running := 0
+	maxRunning := 0
+
+	var sources []func() models.RowIterator
+	for index := 0; index < 10; index++ {
+		sources = append(sources, func() models.RowIterator {
+			lock.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			lock.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			lock.Lock()
+			running--
+			lock.Unlock()
+
+			return models.NewTableIterator(models.ResultTable{{"name": "x"}})
+		})
+	}
+
+	results, _ := models.Collect(newParallelIterator(sources, 3))
+
+	assert.Equal(t, 10, len(results))
+	assert.LessOrEqual(t, maxRunning, 3)
+	assert.Greater(t, maxRunning, 1)
+}
+
+func TestParallelIteratorReturnsErrors(t *testing.T) {
+
+	sources := []func() models.RowIterator{
+		func() models.RowIterator { return models.NewTableIterator(models.ResultTable{{"name": "x"}}) },
+		func() models.RowIterator { return &failingIterator{} },
+	}
+
+	rows := newParallelIterator(sources, 2)
+
+	first, err := rows.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "x", first["name"])
+
+	_, err = rows.Next()
+	assert.EqualError(t, err, "the API is down")
+}
+
+func TestParallelIteratorStopsStartingSourcesWhenClosed(t *testing.T) {
+
+	var lock sync.Mutex
+	started := 0
+
+	// Each source has more rows than can be buffered, so it keeps hold of its slot
+	// until the caller reads them
+	manyRows := models.ResultTable{}
+	for index := 0; index < parallelBufferSize*2; index++ {
+		manyRows = append(manyRows, map[string]string{"name": "x"})
+	}
+
+	var sources []func() models.RowIterator
+	for index := 0; index < 10; index++ {
+		sources = append(sources, func() models.RowIterator {
+			lock.Lock()
+			started++
+			lock.Unlock()
+			return models.NewTableIterator(manyRows)
+		})
+	}
+
+	rows := newParallelIterator(sources, 2)
+	rows.Next()
+	rows.Close()
+
+	_, err := rows.Next()
+	assert.Equal(t, io.EOF, err)
+
+	// Give anything that was going to start a chance to
+	time.Sleep(10 * time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 2, started)
+}
+
+type failingIterator struct{}
+
+func (it *failingIterator) Next() (map[string]string, error) {
+	return nil, errors.New("the API is down")
+}
+
+func (it *failingIterator) Close() {}
+
+func TestConcurrencyIsLimitedAcrossEveryScanOfAConnector(t *testing.T) {
+
+	engine := New()
+	engine.SetConcurrency("ci", 2)
+
+	var lock sync.Mutex
+	running := 0
+	maxRunning := 0
+
+	source := func() models.RowIterator {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+
+		return models.NewTableIterator(models.ResultTable{{"name": "x"}})
+	}
+
+	// Two scans of the connector's tables that each need several calls
+	var wait sync.WaitGroup
+	for scan := 0; scan < 2; scan++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			sources := []func() models.RowIterator{source, source, source, source, source}
+			models.Collect(engine.parallel("ci", sources))
+		}()
+	}
+	wait.Wait()
+
+	assert.Equal(t, 2, maxRunning)
+}
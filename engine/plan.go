@@ -0,0 +1,467 @@
+package engine
+
+import (
+	"devopsdb/connectors"
+	"devopsdb/middleware"
+	"devopsdb/models"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// planNode is one step in running a query. Each node reads rows from its children
+// (if it has any) and hands out rows of its own, e.g. a filter node only hands out
+// the rows of its child that pass the filter.
+//
+// Nodes that come from joined tables name their columns 'alias.column', so columns
+// with the same name in different tables don't clash
+type planNode interface {
+	open() (models.RowIterator, error)
+	children() []planNode
+
+	// The first line says what the node does, and any others give the details
+	describe() []string
+}
+
+// explain writes out the plan as an indented tree, one line per row
+func explain(node planNode) models.ResultTable {
+	var rows models.ResultTable
+	explainNode(node, 0, &rows)
+	return rows
+}
+
+func explainNode(node planNode, depth int, rows *models.ResultTable) {
+	indent := strings.Repeat("  ", depth)
+	for index, line := range node.describe() {
+		if index > 0 {
+			line = "  - " + line
+		}
+		*rows = append(*rows, map[string]string{"plan": indent + line})
+	}
+
+	for _, child := range node.children() {
+		explainNode(child, depth+1, rows)
+	}
+}
+
+// scanNode reads a table from a connector
+type scanNode struct {
+	engine    *QueryEngine
+	connector connectors.Connector
+	schema    string
+	table     string
+
+	// When there's more than one table, the columns are named 'alias.column'
+	alias   string
+	qualify bool
+
+	columns  []string             // What to ask the connector for (empty means everything)
+	filters  []models.QueryFilter // The filters that apply to just this table
+	pushed   []models.QueryFilter // .. and the ones the connector can apply itself
+	top      int
+	required []requiredFilterPlan
+
+	// The columns a lookup join can send the keys it's looking for in
+	lookupKeys []string
+
+	// The HTTP requests the connector made, for 'explain analyze'
+	requests middleware.Stats
+}
+
+// Where the filters we've been given are for this table
+func (n *scanNode) provides(field string) bool {
+	return !n.qualify || strings.HasPrefix(field, n.alias+".")
+}
+
+// The column's name in the connector's rows
+func (n *scanNode) localName(field string) string {
+	if !n.qualify {
+		return field
+	}
+	return strings.TrimPrefix(field, n.alias+".")
+}
+
+func (n *scanNode) open() (models.RowIterator, error) {
+	// Some tables can only be read with certain filters, in which case we might
+	// need to call the connector several times (e.g. once per project)
+	requiredFilterSets, err := n.engine.resolveRequiredFilters(n.schema, n.connector, n.required, &n.requests)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.read(n.pushed, requiredFilterSets), nil
+}
+
+// Works out the values of the required filters that don't come from a lookup join's keys,
+// which are the same for every batch of keys
+func (n *scanNode) resolveRequiredFiltersForLookup() ([]map[string]string, error) {
+	var plans []requiredFilterPlan
+	for _, required := range n.required {
+		if !slices.Contains(n.lookupKeys, required.FieldName) {
+			plans = append(plans, required)
+		}
+	}
+	return n.engine.resolveRequiredFilters(n.schema, n.connector, plans, &n.requests)
+}
+
+// The keys a lookup join is looking for are sent to the connector like any other filter,
+// and give the values of the required filters they're for
+func (n *scanNode) openWithLookup(keys []models.QueryFilter, required []map[string]string) (models.RowIterator, error) {
+	filters := append(slices.Clone(n.filters), keys...)
+	for _, plan := range n.required {
+		if slices.Contains(n.lookupKeys, plan.FieldName) {
+			values, _ := models.ValuesForField(filters, plan.FieldName)
+			required = withValues(required, plan.FieldName, values)
+		}
+	}
+
+	pushed, _ := splitFilters(n.connector, n.table, keys)
+	return n.read(append(slices.Clone(n.pushed), pushed...), required), nil
+}
+
+// Calls the connector once for each set of values for the required filters
+func (n *scanNode) read(pushed []models.QueryFilter, requiredFilterSets []map[string]string) models.RowIterator {
+	// Calls to the connector only start once we're ready for their rows (or we're allowed
+	// to make more than one call at once), so we stop calling it once we have enough rows
+	var sources []func() models.RowIterator
+	for _, requiredFilters := range requiredFilterSets {
+		connectorQuery := connectors.ConnectorQuery{
+			TableName:       n.table,
+			ColumnNames:     n.columns,
+			Top:             n.top,
+			Filters:         pushed,
+			RequiredFilters: requiredFilters,
+			Stats:           &n.requests,
+		}
+		sources = append(sources, func() models.RowIterator {
+			return n.connector.Get(connectorQuery)
+		})
+	}
+
+	rows := n.engine.parallel(n.schema, sources)
+
+	if n.qualify {
+		rows = &qualifyIterator{rows: rows, prefix: n.alias + "."}
+	}
+
+	return rows
+}
+
+// Works out where the values for each of the required filters come from, given the filters
+func (n *scanNode) planRequiredFilters() error {
+	// A lookup join will give us values for its keys
+	filters := slices.Clone(n.filters)
+	for _, key := range n.lookupKeys {
+		filters = append(filters, models.QueryFilter{Type: "in", FieldName: key})
+	}
+
+	var err error
+	n.required, err = planRequiredFilters(n.schema, n.connector, n.table, filters)
+	return err
+}
+
+func (n *scanNode) children() []planNode {
+	return nil
+}
+
+func (n *scanNode) describe() []string {
+	name := "Scan " + n.schema + "." + n.table
+	if n.schema == withSchema {
+		name = "Scan " + n.table + " (from the 'with' clause)"
+	}
+	if n.qualify && n.alias != n.table {
+		name += " as " + n.alias
+	}
+
+	lines := []string{name}
+
+	if len(n.columns) == 0 {
+		lines = append(lines, "columns: all")
+	} else {
+		lines = append(lines, "columns: "+strings.Join(n.columns, ", "))
+	}
+
+	for _, filter := range n.pushed {
+		lines = append(lines, "sent to the API: "+filter.String())
+	}
+
+	if len(n.lookupKeys) > 0 {
+		lines = append(lines, "sent to the API: the join's keys for "+strings.Join(n.lookupKeys, ", "))
+	}
+
+	if n.top != 0 {
+		lines = append(lines, fmt.Sprintf("stops after %v rows", n.top))
+	}
+
+	return append(lines, "estimated API calls: "+n.estimatedCalls())
+}
+
+// How many times we'll call the connector. If we need to read another table to find
+// the values of a required filter, we can't know exactly until we've read it
+func (n *scanNode) estimatedCalls() string {
+	calls := 1
+	var lookedUp []string
+	var sources []string
+	for _, required := range n.required {
+		if slices.Contains(n.lookupKeys, required.FieldName) {
+			lookedUp = append(lookedUp, required.FieldName)
+		} else if required.subquery {
+			sources = append(sources, "the subquery for "+required.FieldName)
+		} else if required.restricted {
+			calls *= len(required.values)
+		} else {
+			sources = append(sources, n.schema+"."+required.SourceTable+"."+required.SourceColumn)
+		}
+	}
+
+	estimate := fmt.Sprint(calls)
+	if len(sources) > 0 {
+		estimate = fmt.Sprintf("%v per value of %v, plus the calls to read them", calls, strings.Join(append(lookedUp, sources...), " and "))
+	} else if len(lookedUp) > 0 {
+		estimate = fmt.Sprintf("%v per value of %v", calls, strings.Join(lookedUp, " and "))
+	}
+
+	if len(n.lookupKeys) > 0 {
+		estimate += " for each batch of keys from the join"
+	}
+
+	return estimate + " (more if the results are paged)"
+}
+
+// qualifyIterator renames each column to 'prefix.column'
+type qualifyIterator struct {
+	rows   models.RowIterator
+	prefix string
+}
+
+func (it *qualifyIterator) Next() (map[string]string, error) {
+	row, err := it.rows.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(row))
+	for column, value := range row {
+		result[it.prefix+column] = value
+	}
+	return result, nil
+}
+
+func (it *qualifyIterator) Close() {
+	it.rows.Close()
+}
+
+// filterNode only passes on the rows that match all of its filters
+type filterNode struct {
+	child   planNode
+	filters []models.QueryFilter
+}
+
+func (n *filterNode) open() (models.RowIterator, error) {
+	rows, err := n.child.open()
+	if err != nil {
+		return nil, err
+	}
+	return models.NewFilterIterator(rows, n.filters), nil
+}
+
+func (n *filterNode) openWithLookup(keys []models.QueryFilter, required []map[string]string) (models.RowIterator, error) {
+	rows, err := n.child.(lookupNode).openWithLookup(keys, required)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewFilterIterator(rows, n.filters), nil
+}
+
+func (n *filterNode) children() []planNode {
+	return []planNode{n.child}
+}
+
+func (n *filterNode) describe() []string {
+	var filters []string
+	for _, filter := range n.filters {
+		filters = append(filters, filter.String())
+	}
+	return []string{"Filter (run locally) " + strings.Join(filters, " and ")}
+}
+
+// projectNode picks the columns that are returned, in the order they were selected
+type projectNode struct {
+	child   planNode
+	names   []string // The name of each column in the results
+	sources []string // .. and the column of the child's rows it comes from
+}
+
+func (n *projectNode) open() (models.RowIterator, error) {
+	rows, err := n.child.open()
+	if err != nil {
+		return nil, err
+	}
+	return &projectIterator{rows: rows, node: n}, nil
+}
+
+func (n *projectNode) children() []planNode {
+	return []planNode{n.child}
+}
+
+func (n *projectNode) describe() []string {
+	return []string{"Project " + strings.Join(n.names, ", ")}
+}
+
+type projectIterator struct {
+	rows models.RowIterator
+	node *projectNode
+}
+
+func (it *projectIterator) Next() (map[string]string, error) {
+	row, err := it.rows.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(it.node.names))
+	for index, name := range it.node.names {
+		result[name] = row[it.node.sources[index]]
+	}
+	return result, nil
+}
+
+func (it *projectIterator) Close() {
+	it.rows.Close()
+}
+
+// computeNode works out the value of each expression for each row, and adds them to
+// the row under their names
+type computeNode struct {
+	child       planNode
+	names       []string
+	expressions []models.Expression
+}
+
+func (n *computeNode) open() (models.RowIterator, error) {
+	rows, err := n.child.open()
+	if err != nil {
+		return nil, err
+	}
+	return &computeIterator{rows: rows, node: n}, nil
+}
+
+func (n *computeNode) children() []planNode {
+	return []planNode{n.child}
+}
+
+func (n *computeNode) describe() []string {
+	var columns []string
+	for index, name := range n.names {
+		columns = append(columns, name+" = "+n.expressions[index].String())
+	}
+	return []string{"Compute " + strings.Join(columns, ", ")}
+}
+
+type computeIterator struct {
+	rows models.RowIterator
+	node *computeNode
+}
+
+func (it *computeIterator) Next() (map[string]string, error) {
+	row, err := it.rows.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	// Every expression sees the row as it was, even if one replaces a column
+	result := copyRow(row)
+	for index, name := range it.node.names {
+		result[name] = it.node.expressions[index].Evaluate(row)
+	}
+	return result, nil
+}
+
+func (it *computeIterator) Close() {
+	it.rows.Close()
+}
+
+// limitNode skips the offset, then stops once it has returned enough rows
+type limitNode struct {
+	child  planNode
+	limit  int // 0 if there's only an offset
+	offset int
+}
+
+func (n *limitNode) open() (models.RowIterator, error) {
+	rows, err := n.child.open()
+	if err != nil {
+		return nil, err
+	}
+	if n.offset > 0 {
+		rows = models.NewOffsetIterator(rows, n.offset)
+	}
+	if n.limit > 0 {
+		rows = models.NewLimitIterator(rows, n.limit)
+	}
+	return rows, nil
+}
+
+func (n *limitNode) children() []planNode {
+	return []planNode{n.child}
+}
+
+func (n *limitNode) describe() []string {
+	switch {
+	case n.offset == 0:
+		return []string{fmt.Sprintf("Limit %v", n.limit)}
+	case n.limit == 0:
+		return []string{fmt.Sprintf("Offset %v", n.offset)}
+	}
+	return []string{fmt.Sprintf("Limit %v offset %v", n.limit, n.offset)}
+}
+
+// distinctNode only passes on the first of each row, comparing the columns without
+// case (as filters do) unless they're case-sensitive
+type distinctNode struct {
+	child         planNode
+	columns       []string
+	caseSensitive []string
+}
+
+func (n *distinctNode) open() (models.RowIterator, error) {
+	rows, err := n.child.open()
+	if err != nil {
+		return nil, err
+	}
+	return &distinctIterator{rows: rows, node: n, seen: make(map[string]bool)}, nil
+}
+
+func (n *distinctNode) children() []planNode {
+	return []planNode{n.child}
+}
+
+func (n *distinctNode) describe() []string {
+	return []string{"Distinct " + strings.Join(n.columns, ", ")}
+}
+
+type distinctIterator struct {
+	rows models.RowIterator
+	node *distinctNode
+	seen map[string]bool
+}
+
+func (it *distinctIterator) Next() (map[string]string, error) {
+	for {
+		row, err := it.rows.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		key := joinKey(row, it.node.columns, it.node.caseSensitive)
+		if !it.seen[key] {
+			it.seen[key] = true
+			return row, nil
+		}
+	}
+}
+
+func (it *distinctIterator) Close() {
+	it.rows.Close()
+}
@@ -0,0 +1,587 @@
+package engine
+
+import (
+	"devopsdb/connectors"
+	"devopsdb/models"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// A table used in the query, and the name its columns are qualified with
+type planTable struct {
+	schema    string
+	table     string
+	name      string // The alias, or the table's name if it doesn't have one
+	connector connectors.Connector
+	columns   []string
+
+	// The columns that are compared with case unless the query says otherwise
+	caseSensitive []string
+
+	// The plan for a subquery used as a table, in which case there's no connector
+	subquery planNode
+}
+
+// plan turns the query in to a tree of plan nodes. The tree is built in the most
+// obvious way first (read every table in full, join them, filter the results etc.)
+// and then optimised, mostly by pushing work down towards the connectors. It returns the
+// names of the columns, and which of them are compared with case
+func (engine *QueryEngine) plan(query models.Query) (planNode, []string, []string, error) {
+	node, columns, caseSensitive, err := engine.planQuery(query)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	node, err = optimise(node)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return node, columns, caseSensitive, nil
+}
+
+// Builds the plan for the query before it's optimised. Subqueries in the 'from' are
+// planned the same way, and become part of the query's plan
+func (engine *QueryEngine) planQuery(query models.Query) (planNode, []string, []string, error) {
+	if len(query.With) > 0 {
+		return engine.planWith(query)
+	}
+
+	if len(query.SetOperations) > 0 {
+		return engine.planSetOperations(query)
+	}
+
+	tables, err := engine.planTables(query)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	resolver := columnResolver{tables: tables, qualified: len(tables) > 1}
+
+	var sources []planNode
+	for _, table := range tables {
+		if table.subquery != nil {
+			sources = append(sources, &subqueryNode{
+				child:   table.subquery,
+				alias:   table.name,
+				qualify: resolver.qualified,
+			})
+			continue
+		}
+
+		sources = append(sources, &scanNode{
+			engine:    engine,
+			connector: table.connector,
+			schema:    table.schema,
+			table:     table.table,
+			alias:     table.name,
+			qualify:   resolver.qualified,
+		})
+	}
+
+	var node planNode = sources[0]
+	var whereFilters []models.QueryFilter
+
+	// The subqueries in the filters run before the rest of the query
+	subqueries := &subqueriesNode{results: make(map[*models.Query]models.QueryFilter)}
+
+	for index, join := range query.Joins {
+		err = engine.planSubqueries(join.Filters, subqueries)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		joined, err := planJoin(node, sources[index+1], tables[index+1].name, join, resolver)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		node = joined.join
+
+		// Conditions in an inner join's 'on' that aren't just about the joined table
+		// work the same as if they were in the where clause
+		whereFilters = append(whereFilters, joined.filters...)
+	}
+
+	err = engine.planSubqueries(query.Filters, subqueries)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	filters, err := resolver.resolveFilters(query.Filters)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	whereFilters = append(whereFilters, filters...)
+
+	if len(whereFilters) > 0 {
+		node = &filterNode{child: node, filters: whereFilters}
+	}
+
+	node, columns, caseSensitive, err := planOutput(node, query, tables, resolver)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Duplicates are removed after sorting, which keeps the rows in order
+	if query.Distinct {
+		node = &distinctNode{child: node, columns: columns, caseSensitive: caseSensitive}
+	}
+
+	if query.Limit != 0 || query.Offset != 0 {
+		node = &limitNode{child: node, limit: query.Limit, offset: query.Offset}
+	}
+
+	if len(subqueries.subqueries) > 0 {
+		subqueries.child = node
+		node = subqueries
+	}
+
+	return node, columns, caseSensitive, nil
+}
+
+func (engine *QueryEngine) planTables(query models.Query) ([]planTable, error) {
+	sources := []models.Join{{SchemaName: query.SchemaName, Table: query.Table, Alias: query.Alias, Subquery: query.Subquery}}
+	sources = append(sources, query.Joins...)
+
+	var tables []planTable
+	for _, source := range sources {
+		name := source.Alias
+		if name == "" {
+			name = source.Table
+		}
+
+		for _, existing := range tables {
+			if existing.name == name {
+				return nil, fmt.Errorf("the table name '%v' is used more than once, give one of them an alias", name)
+			}
+		}
+
+		if source.Subquery != nil {
+			subquery, columns, caseSensitive, err := engine.planQuery(*source.Subquery)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, planTable{table: name, name: name, columns: columns, caseSensitive: caseSensitive, subquery: subquery})
+			continue
+		}
+
+		connector, found := engine.connectors[source.SchemaName]
+		if !found && source.SchemaName == withSchema {
+			return nil, fmt.Errorf("there's no table called '%v', tables need a schema (e.g. devops.%v) unless they're from a 'with' clause", source.Table, source.Table)
+		}
+		if !found {
+			return nil, fmt.Errorf("there is no connector for the schema '%v'", source.SchemaName)
+		}
+		columns, err := connector.GetSchemaForTable(source.Table)
+		if err != nil {
+			return nil, err
+		}
+		if source.SchemaName == withSchema && columns == nil {
+			return nil, fmt.Errorf("there's no table called '%v' in the 'with' clause", source.Table)
+		}
+
+		tables = append(tables, planTable{
+			schema:        source.SchemaName,
+			table:         source.Table,
+			name:          name,
+			connector:     connector,
+			columns:       columns,
+			caseSensitive: engine.caseSensitive[source.SchemaName][source.Table],
+		})
+	}
+
+	return tables, nil
+}
+
+type plannedJoin struct {
+	join    *joinNode
+	filters []models.QueryFilter // Conditions that have to be checked after the join
+}
+
+func planJoin(left planNode, right planNode, rightName string, join models.Join, resolver columnResolver) (plannedJoin, error) {
+	result := plannedJoin{join: &joinNode{left: left, joinType: join.Type}}
+
+	// Each condition compares a column of the joined table with one that's already
+	// been read, but they can be written either way round
+	for _, condition := range join.On {
+		leftKey, err := resolver.resolve(condition.LeftField)
+		if err != nil {
+			return result, err
+		}
+		rightKey, err := resolver.resolve(condition.RightField)
+		if err != nil {
+			return result, err
+		}
+
+		if provides(right, leftKey) {
+			leftKey, rightKey = rightKey, leftKey
+		}
+		if !provides(right, rightKey) || provides(right, leftKey) {
+			return result, fmt.Errorf("join conditions need to compare a column of '%v' with a column of an earlier table", rightName)
+		}
+
+		result.join.leftKeys = append(result.join.leftKeys, leftKey)
+		result.join.rightKeys = append(result.join.rightKeys, rightKey)
+		if resolver.isCaseSensitive(leftKey) || resolver.isCaseSensitive(rightKey) {
+			result.join.caseSensitive = append(result.join.caseSensitive, leftKey, rightKey)
+		}
+	}
+
+	filters, err := resolver.resolveFilters(join.Filters)
+	if err != nil {
+		return result, err
+	}
+
+	// Conditions on just the joined table decide which of its rows can be joined
+	var rightFilters []models.QueryFilter
+	for _, filter := range models.SplitConjuncts(filters) {
+		if providesAll(right, models.FieldNames([]models.QueryFilter{filter})) {
+			rightFilters = append(rightFilters, filter)
+		} else if join.Type == "inner" {
+			result.filters = append(result.filters, filter)
+		} else {
+			return result, fmt.Errorf("conditions in a left join's 'on' can only use columns of the joined table ('%v')", rightName)
+		}
+	}
+
+	result.join.right = right
+	if len(rightFilters) > 0 {
+		result.join.right = &filterNode{child: right, filters: rightFilters}
+	}
+
+	return result, nil
+}
+
+// Adds the nodes that decide what the results look like (aggregating, sorting and
+// picking the columns), and returns the names of the columns and the ones that are
+// compared with case
+func planOutput(node planNode, query models.Query, tables []planTable, resolver columnResolver) (planNode, []string, []string, error) {
+	aggregating := len(query.Aggregates) > 0 || len(query.GroupBy) > 0
+
+	// The columns of the rows that are compared with case, which is those of the tables
+	// plus any computed columns that are just one of them renamed
+	caseSensitive := resolver.caseSensitiveKeys()
+
+	// Once the rows have been aggregated, these are the only columns left
+	var groupKeys []string
+
+	if aggregating {
+		aggregate := &aggregateNode{child: node, caseSensitive: caseSensitive}
+
+		for _, column := range query.GroupBy {
+			key, err := resolver.resolve(column)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			aggregate.groupBy = append(aggregate.groupBy, key)
+		}
+		groupKeys = aggregate.groupBy
+
+		for _, queryAggregate := range query.Aggregates {
+			if queryAggregate.FieldName != "" {
+				key, err := resolver.resolve(queryAggregate.FieldName)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				queryAggregate.FieldName = key
+			}
+			aggregate.aggregates = append(aggregate.aggregates, queryAggregate)
+		}
+
+		node = aggregate
+	}
+
+	// Finds the column of the rows (after any aggregation) that a column refers to
+	columnKey := func(column string) (string, error) {
+		if aggregating {
+			for _, aggregate := range query.Aggregates {
+				if aggregate.Name == column {
+					return column, nil
+				}
+			}
+		}
+		for _, window := range query.Windows {
+			if window.Name == column {
+				return column, nil
+			}
+		}
+
+		key, err := resolver.resolve(column)
+		if err != nil {
+			return "", err
+		}
+
+		if aggregating && !slices.Contains(groupKeys, key) {
+			return "", fmt.Errorf("'%v' needs to be in the 'group by', or used in an aggregate function", column)
+		}
+		return key, nil
+	}
+
+	// Window functions see the rows after they've been filtered and aggregated
+	if len(query.Windows) > 0 {
+		window := &windowNode{child: node, caseSensitive: caseSensitive}
+		for _, queryWindow := range query.Windows {
+			resolved, err := resolveWindow(queryWindow, columnKey)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			window.windows = append(window.windows, resolved)
+		}
+		node = window
+	}
+
+	// Computed columns are added to the rows under their own names, so they can be
+	// sorted by as well as selected. Expressions that are only sorted by are worked out
+	// the same way, but aren't selected
+	if len(query.Expressions) > 0 {
+		names := slices.Clone(query.Columns)
+		for _, orderBy := range query.OrderBy {
+			if !slices.Contains(names, orderBy.FieldName) {
+				names = append(names, orderBy.FieldName)
+			}
+		}
+
+		compute := &computeNode{child: node}
+		for _, name := range names {
+			expression, isComputed := query.Expressions[name]
+			if !isComputed {
+				continue
+			}
+
+			expression, err := resolveExpression(expression, columnKey)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			compute.names = append(compute.names, name)
+			compute.expressions = append(compute.expressions, expression)
+			if expression.Type == "column" && slices.Contains(caseSensitive, expression.FieldName) {
+				caseSensitive = append(caseSensitive, name)
+			}
+		}
+		node = compute
+	}
+
+	// .. and a selected or sorted column
+	outputKey := func(column string) (string, error) {
+		if _, isComputed := query.Expressions[column]; isComputed {
+			return column, nil
+		}
+		return columnKey(column)
+	}
+
+	if len(query.OrderBy) > 0 {
+		sort := &sortNode{child: node, caseSensitive: caseSensitive}
+		for _, orderBy := range query.OrderBy {
+			key, err := outputKey(orderBy.FieldName)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			sort.orderBy = append(sort.orderBy, models.OrderBy{FieldName: key, Descending: orderBy.Descending})
+		}
+		node = sort
+	}
+
+	if len(query.Columns) == 0 {
+		columns := allColumns(query, tables, groupKeys, resolver)
+		var outputCaseSensitive []string
+		for _, column := range columns {
+			if slices.Contains(caseSensitive, column) {
+				outputCaseSensitive = append(outputCaseSensitive, column)
+			}
+		}
+		return node, columns, outputCaseSensitive, nil
+	}
+
+	project := &projectNode{child: node, names: query.Columns}
+	var outputCaseSensitive []string
+	for _, column := range query.Columns {
+		key, err := outputKey(column)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		project.sources = append(project.sources, key)
+		if slices.Contains(caseSensitive, key) {
+			outputCaseSensitive = append(outputCaseSensitive, column)
+		}
+	}
+
+	return project, query.Columns, outputCaseSensitive, nil
+}
+
+// Renames each column the window uses to the column of the rows it refers to
+func resolveWindow(window models.WindowFunction, resolve func(string) (string, error)) (models.WindowFunction, error) {
+	var err error
+	if window.FieldName != "" {
+		if window.FieldName, err = resolve(window.FieldName); err != nil {
+			return window, err
+		}
+	}
+
+	partitionBy := make([]string, len(window.PartitionBy))
+	for index, column := range window.PartitionBy {
+		if partitionBy[index], err = resolve(column); err != nil {
+			return window, err
+		}
+	}
+	window.PartitionBy = partitionBy
+
+	orderBy := make([]models.OrderBy, len(window.OrderBy))
+	for index, column := range window.OrderBy {
+		orderBy[index] = column
+		if orderBy[index].FieldName, err = resolve(column.FieldName); err != nil {
+			return window, err
+		}
+	}
+	window.OrderBy = orderBy
+
+	return window, nil
+}
+
+// The columns for 'select *'
+func allColumns(query models.Query, tables []planTable, groupKeys []string, resolver columnResolver) []string {
+	if len(query.Aggregates) > 0 || len(query.GroupBy) > 0 {
+		columns := slices.Clone(groupKeys)
+		for _, aggregate := range query.Aggregates {
+			columns = append(columns, aggregate.Name)
+		}
+		return columns
+	}
+
+	var columns []string
+	for _, table := range tables {
+		for _, column := range table.columns {
+			columns = append(columns, resolver.key(table, column))
+		}
+	}
+	return columns
+}
+
+// columnResolver works out which column of the rows a column in the query refers to.
+// With one table that's just the column's name, but once tables are joined the rows
+// have 'alias.column' for every column of every table
+type columnResolver struct {
+	tables    []planTable
+	qualified bool
+}
+
+func (r columnResolver) resolve(column string) (string, error) {
+	dot := strings.LastIndex(column, ".")
+
+	if dot >= 0 {
+		prefix, name := column[:dot], column[dot+1:]
+		for _, table := range r.tables {
+			if prefix == table.name || prefix == table.table || prefix == table.schema+"."+table.table {
+				return r.key(table, name), nil
+			}
+		}
+		return "", fmt.Errorf("unknown table '%v' in '%v'", prefix, column)
+	}
+
+	if !r.qualified {
+		return column, nil
+	}
+
+	var matches []planTable
+	for _, table := range r.tables {
+		if slices.Contains(table.columns, column) {
+			matches = append(matches, table)
+		}
+	}
+
+	if len(matches) == 0 {
+		return "", fmt.Errorf("unknown column '%v'", column)
+	}
+	if len(matches) > 1 {
+		return "", fmt.Errorf("'%v' is in more than one table, say which one you mean (e.g. %v.%v)", column, matches[0].name, column)
+	}
+
+	return r.key(matches[0], column), nil
+}
+
+func (r columnResolver) key(table planTable, column string) string {
+	if !r.qualified {
+		return column
+	}
+	return table.name + "." + column
+}
+
+func (r columnResolver) resolveFilters(filters []models.QueryFilter) ([]models.QueryFilter, error) {
+	var result []models.QueryFilter
+	for _, filter := range filters {
+		if filter.FieldName != "" {
+			key, err := r.resolve(filter.FieldName)
+			if err != nil {
+				return nil, err
+			}
+			filter.FieldName = key
+
+			if filter.Collation == "" && r.isCaseSensitive(key) {
+				filter.Collation = models.CaseSensitive
+			}
+		}
+
+		if filter.Expression != nil {
+			expression, err := resolveExpression(*filter.Expression, r.resolve)
+			if err != nil {
+				return nil, err
+			}
+			filter.Expression = &expression
+		}
+
+		if filter.ValueExpression != nil {
+			expression, err := resolveExpression(*filter.ValueExpression, r.resolve)
+			if err != nil {
+				return nil, err
+			}
+			filter.ValueExpression = &expression
+
+			// Comparing with a case-sensitive column, e.g. "a.branch = b.branch", takes its case into account
+			if filter.Collation == "" && expression.Type == "column" && r.isCaseSensitive(expression.FieldName) {
+				filter.Collation = models.CaseSensitive
+			}
+		}
+
+		children, err := r.resolveFilters(filter.Children)
+		if err != nil {
+			return nil, err
+		}
+		filter.Children = children
+
+		result = append(result, filter)
+	}
+	return result, nil
+}
+
+// Whether the column of the rows is configured to be compared with case
+func (r columnResolver) isCaseSensitive(key string) bool {
+	return slices.Contains(r.caseSensitiveKeys(), key)
+}
+
+// The columns of the rows that are configured to be compared with case
+func (r columnResolver) caseSensitiveKeys() []string {
+	var keys []string
+	for _, table := range r.tables {
+		for _, column := range table.caseSensitive {
+			keys = append(keys, r.key(table, column))
+		}
+	}
+	return keys
+}
+
+// Renames each column in the expression to the column of the rows it refers to
+func resolveExpression(expression models.Expression, resolve func(string) (string, error)) (models.Expression, error) {
+	keys := make(map[string]string)
+	for _, field := range expression.FieldNames() {
+		key, err := resolve(field)
+		if err != nil {
+			return expression, err
+		}
+		keys[field] = key
+	}
+
+	return expression.RenameFields(func(field string) string {
+		return keys[field]
+	}), nil
+}
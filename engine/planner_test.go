@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unreadableConnector can't read its tables' columns
+type unreadableConnector struct {
+	*tableConnector
+}
+
+func (c *unreadableConnector) GetSchemaForTable(table string) ([]string, error) {
+	return nil, fmt.Errorf("the columns of '%v' can't be read", table)
+}
+
+func TestReturnsErrorReadingTheColumnsOfATable(t *testing.T) {
+
+	engine := New()
+	engine.AddConnector("ci", &unreadableConnector{&tableConnector{}})
+
+	_, err := engine.Execute(models.Query{SchemaName: "ci", Table: "builds"})
+
+	assert.EqualError(t, err, "the columns of 'builds' can't be read")
+}
+
+func TestReturnsErrorForAmbiguousColumn(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	_, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id"},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "pipelines",
+			On: []models.JoinCondition{{LeftField: "builds.pipeline", RightField: "pipelines.id"}},
+		}},
+	})
+
+	assert.EqualError(t, err, "'id' is in more than one table, say which one you mean (e.g. builds.id)")
+}
+
+// e.g. "select id from ci.builds order by duration desc limit 2"
+func TestSortsBeforeLimiting(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, _ := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id"},
+		OrderBy: []models.OrderBy{{FieldName: "duration", Descending: true}},
+		Limit:   2,
+	})
+	results := resultsOf(result)
+
+	// The connector can't stop early, as the last row it finds might be the first one we return
+	assert.Equal(t, 0, connector.queryFor("builds").Top)
+	assert.Equal(t, models.ResultTable{{"id": "3"}, {"id": "2"}}, results)
+}
+
+func TestSelectDistinct(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "pipelines",
+		Columns:  []string{"folder"},
+		Distinct: true,
+		Limit:    5,
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"folder": "prod"}, {"folder": "dev"}}, results)
+
+	// The limit is for distinct rows, so the connector can't stop early
+	assert.Equal(t, 0, connector.queryFor("pipelines").Top)
+}
+
+// e.g. "select concat(p.name, '#', b.id) as build, b.duration * 60 as seconds from ... order by seconds desc limit 2"
+func TestComputedColumns(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds", Alias: "b",
+		Columns: []string{"build", "seconds"},
+		Expressions: map[string]models.Expression{
+			"build": {Type: "function", Function: "concat", Arguments: []models.Expression{
+				{Type: "column", FieldName: "p.name"},
+				{Type: "value", Value: "#"},
+				{Type: "column", FieldName: "b.id"},
+			}},
+			"seconds": {Type: "operator", Operator: "*", Arguments: []models.Expression{
+				{Type: "column", FieldName: "duration"},
+				{Type: "value", Value: "60"},
+			}},
+		},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "pipelines", Alias: "p",
+			On: []models.JoinCondition{{LeftField: "b.pipeline", RightField: "p.id"}},
+		}},
+		OrderBy: []models.OrderBy{{FieldName: "seconds", Descending: true}},
+		Limit:   2,
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"build", "seconds"}, result.Columns)
+	assert.Equal(t, models.ResultTable{
+		{"build": "test#3", "seconds": "600"},
+		{"build": "deploy#2", "seconds": "420"},
+	}, results)
+	assert.Equal(t, []string{"id", "duration", "pipeline"}, connector.queryFor("builds").ColumnNames)
+}
+
+// e.g. "select b.id from ci.builds b join ci.pipelines p on ... where lower(p.name) = 'deploy'"
+func TestFunctionsInFiltersCanBeSentToTheConnector(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds", Alias: "b",
+		Columns: []string{"b.id"},
+		Filters: []models.QueryFilter{
+			{Type: "eq", Value: "deploy", Expression: &models.Expression{
+				Type: "function", Function: "lower", Arguments: []models.Expression{{Type: "column", FieldName: "p.name"}},
+			}},
+			{Type: "ne", Value: "7", Expression: &models.Expression{
+				Type: "function", Function: "abs", Arguments: []models.Expression{{Type: "column", FieldName: "duration"}},
+			}},
+		},
+		Joins: []models.Join{{
+			Type: "inner", SchemaName: "ci", Table: "pipelines", Alias: "p",
+			On: []models.JoinCondition{{LeftField: "b.pipeline", RightField: "p.id"}},
+		}},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"b.id": "1"}}, results)
+	assert.Equal(t, []models.QueryFilter{{Type: "eq", Value: "deploy", Expression: &models.Expression{
+		Type: "function", Function: "lower", Arguments: []models.Expression{{Type: "column", FieldName: "name"}},
+	}}}, connector.queryFor("pipelines").Filters)
+	assert.Empty(t, connector.queryFor("builds").Filters)
+}
+
+// e.g. "select id, case when result = 'failed' then 'bad' else 'good' end as outcome from ci.builds order by -duration"
+func TestSortingByAnExpressionThatIsNotSelected(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	negated := models.Expression{Type: "operator", Operator: "-", Arguments: []models.Expression{{Type: "column", FieldName: "duration"}}}
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id", "outcome"},
+		Expressions: map[string]models.Expression{
+			"outcome": {
+				Type:       "case",
+				Conditions: []models.QueryFilter{{Type: "eq", FieldName: "result", Value: "failed"}},
+				Arguments:  []models.Expression{{Type: "value", Value: "bad"}, {Type: "value", Value: "good"}},
+			},
+			"-duration": negated,
+		},
+		OrderBy: []models.OrderBy{{FieldName: "-duration"}},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "outcome"}, result.Columns)
+	assert.Equal(t, models.ResultTable{
+		{"id": "3", "outcome": "good"},
+		{"id": "2", "outcome": "bad"},
+		{"id": "1", "outcome": "good"},
+	}, results)
+}
+
+func TestCaseSensitiveColumns(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+	engine.SetCaseSensitive("ci", "pipelines", []string{"name"})
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "pipelines", Alias: "p",
+		Columns: []string{"p.name"},
+		Filters: []models.QueryFilter{{Type: "in", FieldName: "name", Values: []string{"Deploy", "test"}}},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"p.name": "test"}}, resultsOf(result))
+
+	// The query can still ignore case
+	result, err = engine.Execute(models.Query{
+		SchemaName: "ci", Table: "pipelines",
+		Columns: []string{"name"},
+		Filters: []models.QueryFilter{{Type: "eq", FieldName: "name", Value: "Deploy", Collation: models.CaseInsensitive}},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"name": "deploy"}}, resultsOf(result))
+}
+
+func TestConnectorsThatIgnoreCaseStillFilterCaseSensitiveConditions(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "pipelines",
+		Columns: []string{"name"},
+		Filters: []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: "Prod", Collation: models.CaseSensitive}},
+	})
+
+	// The connector finds the pipelines in any case, and we check the case of what it returns
+	assert.Nil(t, err)
+	assert.Empty(t, resultsOf(result))
+	assert.Equal(t, []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: "Prod", Collation: models.CaseInsensitive}}, connector.queryFor("pipelines").Filters)
+}
+
+func TestOffsetSkipsRows(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id"},
+		Limit:   1,
+		Offset:  1,
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"id": "2"}}, results)
+
+	// The connector needs to find the skipped rows too, and the row after the page
+	assert.Equal(t, 3, connector.queryFor("builds").Top)
+}
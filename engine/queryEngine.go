@@ -3,17 +3,27 @@ package engine
 import (
 	"devopsdb/connectors"
 	"devopsdb/models"
-	"devopsdb/utils"
 )
 
 func New() *QueryEngine {
 	return &QueryEngine{
-		connectors: make(map[string]connectors.Connector, 0),
+		connectors:    make(map[string]connectors.Connector, 0),
+		concurrency:   make(map[string]int, 0),
+		slots:         &connectorSlots{slots: make(map[string]chan struct{})},
+		caseSensitive: make(map[string]map[string][]string, 0),
 	}
 }
 
 type QueryEngine struct {
 	connectors map[string]connectors.Connector
+
+	// How many calls we can make to each connector at the same time
+	concurrency map[string]int
+	slots       *connectorSlots
+
+	// The columns whose comparisons are case-sensitive unless the query says otherwise, by
+	// schema and then table
+	caseSensitive map[string]map[string][]string
 }
 
 func (engine *QueryEngine) AddConnector(schemaName string, conn connectors.Connector) {
@@ -21,33 +31,108 @@ func (engine *QueryEngine) AddConnector(schemaName string, conn connectors.Conne
 	engine.connectors[schemaName] = conn
 }
 
-func (engine *QueryEngine) Execute(query models.Query) *models.QueryResult {
-	// TODO: we need to combine any joins
+// SetConcurrency sets how many calls the engine will make to a connector at the same time
+// when a query needs more than one (e.g. one per project, or both sides of a join). The
+// limit covers every table of the connector that the query reads. The default is one at a time
+func (engine *QueryEngine) SetConcurrency(schemaName string, limit int) {
+	engine.concurrency[schemaName] = limit
+	engine.slots.reset(schemaName)
+}
 
-	connector := engine.connectors[query.SchemaName]
-	// TODO: what if it isn't found?
+// SetCaseSensitive makes comparisons with the table's columns tell 'Main' and 'main' apart,
+// unless the query says otherwise (e.g. with 'collate utf8mb4_general_ci'). By default
+// they ignore case
+func (engine *QueryEngine) SetCaseSensitive(schemaName string, table string, columns []string) {
+	if engine.caseSensitive[schemaName] == nil {
+		engine.caseSensitive[schemaName] = make(map[string][]string)
+	}
+	engine.caseSensitive[schemaName][table] = columns
+}
 
-	results := connector.Get(connectors.ConnectorQuery{
-		TableName:   query.Table,
-		ColumnNames: query.Columns,
-		Filters:     query.Filters, // TODO: only the ones that relate to this table
-	})
+func (engine *QueryEngine) Execute(query models.Query) (*models.QueryResult, error) {
+	result, _, err := engine.execute(query)
+	return result, err
+}
 
-	if query.Limit != 0 {
-		resultsToReturn := utils.Min(query.Limit, len(results))
-		results = results[:resultsToReturn]
+// Runs the query, and also returns which of its columns are compared with case
+func (engine *QueryEngine) execute(query models.Query) (*models.QueryResult, []string, error) {
+	query, start, err := continueQuery(query)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// We set the columns here, becuase when there are multiple providers
+	// We return the columns, becuase when there are multiple providers
 	// involved we'll be the only place that knows the full list of columns
 	// returned (plus we can remove aliases etc.)
-	returnedColumns := query.Columns
-	if len(query.Columns) == 0 {
-		returnedColumns = connector.GetSchemaForTable(query.Table)
+	// A page reads one row more than it returns, so it knows whether there's another page
+	planned := query
+	if planned.Limit != 0 && !planned.Explain && !planned.Analyze {
+		planned.Limit++
 	}
 
+	plan, columns, caseSensitive, err := engine.plan(planned)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if query.Analyze {
+		results, err := explainAnalyze(plan)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &models.QueryResult{
+			Columns: []string{"plan"},
+			Rows:    models.NewTableIterator(results),
+		}, nil, nil
+	}
+
+	if query.Explain {
+		return &models.QueryResult{
+			Columns: []string{"plan"},
+			Rows:    models.NewTableIterator(explain(plan)),
+		}, nil, nil
+	}
+
+	rows, err := plan.open()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if query.Limit == 0 {
+		return &models.QueryResult{
+			Columns: columns,
+			Rows:    rows,
+		}, caseSensitive, nil
+	}
+
+	page := newPageIterator(rows, query, start, caseSensitive)
 	return &models.QueryResult{
-		Columns: returnedColumns,
-		Results: results,
+		Columns:  columns,
+		Rows:     page,
+		NextPage: page.token,
+	}, caseSensitive, nil
+}
+
+// Splits the query's filters in to the ones the connector says it can apply itself, and the
+// ones we need to apply to the results. This works at the level of the individual
+// conditions that make up the top-level AND, so "a and b" can be split between the two
+func splitFilters(connector connectors.Connector, table string, filters []models.QueryFilter) ([]models.QueryFilter, []models.QueryFilter) {
+	var pushed []models.QueryFilter
+	var residual []models.QueryFilter
+
+	for _, filter := range models.SplitConjuncts(filters) {
+		if connector.SupportsFilter(table, filter) {
+			pushed = append(pushed, filter)
+			continue
+		}
+
+		// If the connector can only ignore case, it can still do most of the work of a
+		// case-sensitive filter, and we check the case of what it returns
+		if ignoringCase := filter.WithCollation(models.CaseInsensitive); filter.IsCaseSensitive() && connector.SupportsFilter(table, ignoringCase) {
+			pushed = append(pushed, ignoringCase)
+		}
+		residual = append(residual, filter)
 	}
+
+	return pushed, residual
 }
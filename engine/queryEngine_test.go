@@ -3,6 +3,7 @@ package engine
 import (
 	"devopsdb/connectors"
 	"devopsdb/models"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,14 +16,15 @@ func TestSelectAllFromSingleEntityReturnsEverything(t *testing.T) {
 	engine, _ := createEngine()
 
 	// Act
-	result := engine.Execute(
+	result, _ := engine.Execute(
 		models.Query{SchemaName: "azureDevOps", Table: "builds"},
 	)
+	results := resultsOf(result)
 
 	// Assert
-	assert.Equal(t, 2, len(result.Results))
-	assert.Equal(t, "bob", result.Results[0]["startedby"])
-	assert.Equal(t, "alice", result.Results[1]["startedby"])
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, "bob", results[0]["startedby"])
+	assert.Equal(t, "alice", results[1]["startedby"])
 }
 
 // e.g. "select started, ended from azureDevOps.builds"
@@ -31,15 +33,16 @@ func TestSelectSpecificColumnsFromSingleEntity(t *testing.T) {
 	engine, _ := createEngine()
 
 	// Act
-	result := engine.Execute(
+	result, _ := engine.Execute(
 		models.Query{
 			SchemaName: "azureDevOps",
 			Table:      "builds",
 			Columns:    []string{"started", "ended"}},
 	)
+	results := resultsOf(result)
 
 	// Assert
-	for _, result := range result.Results {
+	for _, result := range results {
 		if result["started"] == "" || result["ended"] == "" || result["startedby"] != "" {
 			t.Fatal("The column filters were not passed to the connector")
 		}
@@ -52,22 +55,100 @@ func TestSelectWithLimitFromSingleEntity(t *testing.T) {
 	engine, _ := createEngine()
 
 	// Act
-	result := engine.Execute(
+	result, _ := engine.Execute(
 		models.Query{
 			SchemaName: "azureDevOps",
 			Table:      "builds",
 			Limit:      1,
 		},
 	)
+	results := resultsOf(result)
 
-	assert.Equal(t, 1, len(result.Results))
-	assert.Equal(t, "bob", result.Results[0]["startedby"])
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "bob", results[0]["startedby"])
+}
+
+func TestPassesLimitToConnectorWhenItDoesAllTheFiltering(t *testing.T) {
+
+	engine, connector := createEngine()
+
+	result, _ := engine.Execute(
+		models.Query{
+			SchemaName: "azureDevOps",
+			Table:      "builds",
+			Limit:      1,
+			Filters: []models.QueryFilter{
+				{FieldName: "startedby", Type: "eq", Value: "bob"},
+			},
+		},
+	)
+	resultsOf(result)
+
+	// One more than the limit, to find out if there's another page
+	assert.Equal(t, 2, connector.PassedQueries[0].Top)
+}
+
+func TestDoesNotPassLimitToConnectorWhenFilteringResults(t *testing.T) {
+
+	engine, connector := createEngine()
+
+	result, _ := engine.Execute(
+		models.Query{
+			SchemaName: "azureDevOps",
+			Table:      "builds",
+			Limit:      1,
+			Filters: []models.QueryFilter{
+				{FieldName: "started", Type: "eq", Value: "thursday"},
+			},
+		},
+	)
+	results := resultsOf(result)
+
+	// The first row the connector finds might be filtered out, so it has to give us everything
+	assert.Equal(t, 0, connector.PassedQueries[0].Top)
+	assert.Equal(t, "alice", results[0]["startedby"])
+}
+
+// e.g. "select * from azureDevOps.pipelines limit 1"
+func TestStopsCallingConnectorOnceLimitIsReached(t *testing.T) {
+
+	engine, connector := createEngine()
+
+	result, _ := engine.Execute(
+		models.Query{SchemaName: "azureDevOps", Table: "pipelines", Limit: 1},
+	)
+	results := resultsOf(result)
+
+	// One call to find the projects, one for the first project, and one for the second to
+	// see if there's another page
+	assert.Equal(t, 3, len(connector.PassedQueries))
+	assert.Equal(t, 1, len(results))
+	assert.NotEqual(t, "", result.ContinuationToken())
+}
+
+// Rows are streamed, so we only call the connector when the caller reads from the results
+func TestOnlyCallsConnectorAsRowsAreRead(t *testing.T) {
+
+	engine, connector := createEngine()
+
+	result, _ := engine.Execute(
+		models.Query{SchemaName: "azureDevOps", Table: "pipelines"},
+	)
+
+	// Only the call to find the projects has happened
+	assert.Equal(t, 1, len(connector.PassedQueries))
+
+	result.Rows.Next()
+	assert.Equal(t, 2, len(connector.PassedQueries))
+
+	result.Rows.Next()
+	assert.Equal(t, 3, len(connector.PassedQueries))
 }
 
 func TestReturnsAllColumnsWithResultsWhenSelectAll(t *testing.T) {
 	engine, _ := createEngine()
 
-	result := engine.Execute(
+	result, _ := engine.Execute(
 		models.Query{
 			SchemaName: "azureDevOps",
 			Table:      "builds",
@@ -81,7 +162,7 @@ func TestReturnsSelectedColumnsInOrderWithResults(t *testing.T) {
 
 	engine, _ := createEngine()
 
-	result := engine.Execute(
+	result, _ := engine.Execute(
 		models.Query{
 			SchemaName: "azureDevOps",
 			Table:      "builds",
@@ -96,7 +177,7 @@ func TestPassesWhereClauseToConnector(t *testing.T) {
 
 	engine, connector := createEngine()
 
-	engine.Execute(
+	result, _ := engine.Execute(
 		models.Query{
 			SchemaName: "azureDevOps",
 			Table:      "builds",
@@ -106,10 +187,149 @@ func TestPassesWhereClauseToConnector(t *testing.T) {
 			},
 		},
 	)
+	resultsOf(result)
 
 	assert.Equal(t, []models.QueryFilter{{FieldName: "startedby", Type: "eq", Value: "bob"}}, connector.PassedQueryFilters)
 }
 
+func TestAppliesFiltersTheConnectorDoesNotSupport(t *testing.T) {
+
+	engine, connector := createEngine()
+
+	result, _ := engine.Execute(
+		models.Query{
+			SchemaName: "azureDevOps",
+			Table:      "builds",
+			Columns:    []string{"startedby"},
+			Filters: []models.QueryFilter{
+				{
+					Type: "and",
+					Children: []models.QueryFilter{
+						{FieldName: "startedby", Type: "ne", Value: "nobody"},
+						{FieldName: "started", Type: "eq", Value: "thursday"},
+					},
+				},
+			},
+		},
+	)
+	results := resultsOf(result)
+
+	// Only the supported half of the AND goes to the connector
+	assert.Equal(t, []models.QueryFilter{{FieldName: "startedby", Type: "ne", Value: "nobody"}}, connector.PassedQueryFilters)
+
+	// .. but we still need the column for the other half, even though it wasn't selected
+	assert.Equal(t, []string{"startedby", "started"}, connector.PassedQueries[0].ColumnNames)
+
+	assert.Equal(t, models.ResultTable{{"startedby": "alice"}}, results)
+}
+
+func TestReturnsErrorForUnknownSchema(t *testing.T) {
+
+	engine, _ := createEngine()
+
+	_, err := engine.Execute(
+		models.Query{SchemaName: "github", Table: "builds"},
+	)
+
+	assert.EqualError(t, err, "there is no connector for the schema 'github'")
+}
+
+// e.g. "select * from azureDevOps.pipelines where project in ('alpha', 'gamma')"
+func TestQueriesOncePerValueOfRequiredFilter(t *testing.T) {
+
+	engine, connector := createEngine()
+
+	result, err := engine.Execute(
+		models.Query{
+			SchemaName: "azureDevOps",
+			Table:      "pipelines",
+			Filters: []models.QueryFilter{
+				{
+					Type: "and",
+					Children: []models.QueryFilter{
+						{FieldName: "project", Type: "in", Values: []string{"alpha", "gamma"}},
+						{FieldName: "name", Type: "eq", Value: "build"},
+					},
+				},
+			},
+		},
+	)
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(connector.PassedQueries))
+	assert.Equal(t, map[string]string{"project": "alpha"}, connector.PassedQueries[0].RequiredFilters)
+	assert.Equal(t, map[string]string{"project": "gamma"}, connector.PassedQueries[1].RequiredFilters)
+	assert.Equal(t, 2, len(results))
+}
+
+// e.g. "select * from azureDevOps.pipelines"
+func TestFansOutOverSourceTableWhenRequiredFilterIsMissing(t *testing.T) {
+
+	engine, connector := createEngine()
+
+	result, err := engine.Execute(
+		models.Query{SchemaName: "azureDevOps", Table: "pipelines"},
+	)
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(connector.PassedQueries))
+	assert.Equal(t, "projects", connector.PassedQueries[0].TableName)
+	assert.Equal(t, map[string]string{"project": "alpha"}, connector.PassedQueries[1].RequiredFilters)
+	assert.Equal(t, map[string]string{"project": "beta"}, connector.PassedQueries[2].RequiredFilters)
+	assert.Equal(t, "alpha", results[0]["project"])
+	assert.Equal(t, "beta", results[1]["project"])
+}
+
+func TestCallsConnectorInParallelAndKeepsOrder(t *testing.T) {
+
+	engine, connector := createEngine()
+	engine.SetConcurrency("azureDevOps", 2)
+
+	result, _ := engine.Execute(
+		models.Query{
+			SchemaName: "azureDevOps",
+			Table:      "pipelines",
+			Filters: []models.QueryFilter{
+				{FieldName: "project", Type: "in", Values: []string{"a", "b", "c", "d"}},
+			},
+		},
+	)
+	results := resultsOf(result)
+
+	assert.Equal(t, 4, len(connector.PassedQueries))
+	assert.Equal(t, "a", results[0]["project"])
+	assert.Equal(t, "b", results[1]["project"])
+	assert.Equal(t, "c", results[2]["project"])
+	assert.Equal(t, "d", results[3]["project"])
+}
+
+// e.g. "select * from azureDevOps.stages where project = 'alpha' or name = 'build'"
+func TestReturnsErrorWhenRequiredFilterIsMissingAndCannotFanOut(t *testing.T) {
+
+	engine, connector := createEngine()
+
+	_, err := engine.Execute(
+		models.Query{
+			SchemaName: "azureDevOps",
+			Table:      "stages",
+			Filters: []models.QueryFilter{
+				{
+					Type: "or",
+					Children: []models.QueryFilter{
+						{FieldName: "project", Type: "eq", Value: "alpha"},
+						{FieldName: "name", Type: "eq", Value: "build"},
+					},
+				},
+			},
+		},
+	)
+
+	assert.EqualError(t, err, "cannot query 'azureDevOps.stages' without a filter on 'project' (e.g. where project = '...'), this is a restriction of the underlying API")
+	assert.Equal(t, 0, len(connector.PassedQueries))
+}
+
 func createEngine() (*QueryEngine, *FakeConnector) {
 	engine := New()
 	conn := &FakeConnector{}
@@ -119,15 +339,61 @@ func createEngine() (*QueryEngine, *FakeConnector) {
 
 type FakeConnector struct {
 	PassedQueryFilters []models.QueryFilter
+	PassedQueries      []connectors.ConnectorQuery
+
+	// The engine can call us from several goroutines at once
+	lock sync.Mutex
 }
 
-func (f *FakeConnector) GetSchemaForTable(table string) []string {
-	return []string{"startedby", "started", "ended"}
+func (f *FakeConnector) GetSchemaForTable(table string) ([]string, error) {
+	if table == "projects" {
+		return []string{"name"}, nil
+	}
+
+	if table == "pipelines" || table == "stages" {
+		return []string{"project", "name"}, nil
+	}
+
+	return []string{"startedby", "started", "ended"}, nil
 }
 
-func (f *FakeConnector) Get(query connectors.ConnectorQuery) models.ResultTable {
+func (f *FakeConnector) GetRequiredFiltersForTable(table string) []connectors.RequiredFilter {
+	// Pipelines can be found for every project, but stages need to be asked for
+	if table == "pipelines" {
+		return []connectors.RequiredFilter{{FieldName: "project", SourceTable: "projects", SourceColumn: "name"}}
+	}
+
+	if table == "stages" {
+		return []connectors.RequiredFilter{{FieldName: "project"}}
+	}
 
+	return []connectors.RequiredFilter(nil)
+}
+
+// The fake 'API' can only filter on who started a build
+func (f *FakeConnector) SupportsFilter(table string, filter models.QueryFilter) bool {
+	return filter.FieldName == "startedby"
+}
+
+func (f *FakeConnector) Get(query connectors.ConnectorQuery) models.RowIterator {
+
+	f.lock.Lock()
 	f.PassedQueryFilters = query.Filters
+	f.PassedQueries = append(f.PassedQueries, query)
+	f.lock.Unlock()
+
+	if query.TableName == "projects" {
+		return models.NewTableIterator(models.ResultTable{
+			{"name": "alpha"},
+			{"name": "beta"},
+		})
+	}
+
+	if query.TableName == "pipelines" || query.TableName == "stages" {
+		return models.NewTableIterator(models.ResultTable{
+			{"project": query.RequiredFilters["project"], "name": "build"},
+		})
+	}
 
 	r := models.ResultTable{
 		0: map[string]string{
@@ -152,5 +418,5 @@ func (f *FakeConnector) Get(query connectors.ConnectorQuery) models.ResultTable
 		}
 	}
 
-	return r
+	return models.NewTableIterator(r)
 }
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"devopsdb/connectors"
+	"devopsdb/middleware"
+	"devopsdb/models"
+	"fmt"
+)
+
+// requiredFilterPlan says where the values for one of a table's required filters come
+// from: either the query restricts the field to a set of values, or we'll need to read
+// every value from the source table
+type requiredFilterPlan struct {
+	connectors.RequiredFilter
+	values     []string
+	restricted bool
+
+	// The values come from a subquery that hasn't run yet
+	subquery bool
+}
+
+// Works out where the values for each of the table's required filters will come from,
+// failing if there's no way of finding them
+func planRequiredFilters(schemaName string, connector connectors.Connector, table string, filters []models.QueryFilter) ([]requiredFilterPlan, error) {
+	var plans []requiredFilterPlan
+
+	for _, required := range connector.GetRequiredFiltersForTable(table) {
+		values, restricted := models.ValuesForField(filters, required.FieldName)
+
+		if !restricted && required.SourceTable == "" {
+			return nil, fmt.Errorf(
+				"cannot query '%v.%v' without a filter on '%v' (e.g. where %v = '...'), this is a restriction of the underlying API",
+				schemaName, table, required.FieldName, required.FieldName,
+			)
+		}
+
+		plans = append(plans, requiredFilterPlan{
+			RequiredFilter: required,
+			values:         values,
+			restricted:     restricted,
+			subquery:       restricted && hasSubqueryFor(filters, required.FieldName),
+		})
+	}
+
+	return plans, nil
+}
+
+// Whether one of the filters is 'field in (select ...)'
+func hasSubqueryFor(filters []models.QueryFilter, fieldName string) bool {
+	for _, filter := range filters {
+		if filter.Subquery != nil && filter.FieldName == fieldName {
+			return true
+		}
+		if hasSubqueryFor(filter.Children, fieldName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Works out every combination of values for the table's required filters that we need to
+// ask the connector for. Each combination becomes one call to the connector, so a table
+// with no required filters needs a single call with no values. Any requests made to find
+// the values are counted in the stats
+func (engine *QueryEngine) resolveRequiredFilters(schemaName string, connector connectors.Connector, plans []requiredFilterPlan, stats *middleware.Stats) ([]map[string]string, error) {
+	combinations := []map[string]string{{}}
+
+	for _, required := range plans {
+		values := required.values
+
+		if !required.restricted {
+			// The query doesn't tell us which values to use, so use all of them
+			var err error
+			values, err = engine.allValuesOf(schemaName, connector, required.SourceTable, required.SourceColumn, stats)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		combinations = withValues(combinations, required.FieldName, values)
+	}
+
+	return combinations, nil
+}
+
+// Each of the combinations of values for required filters, with each of the values for
+// another one
+func withValues(combinations []map[string]string, field string, values []string) []map[string]string {
+	var expanded []map[string]string
+	for _, combination := range combinations {
+		for _, value := range values {
+			next := map[string]string{field: value}
+			for existingField, existingValue := range combination {
+				next[existingField] = existingValue
+			}
+			expanded = append(expanded, next)
+		}
+	}
+	return expanded
+}
+
+// Reads every value of a column from a table (e.g. the names of all projects)
+func (engine *QueryEngine) allValuesOf(schemaName string, connector connectors.Connector, table string, column string, stats *middleware.Stats) ([]string, error) {
+	plans, err := planRequiredFilters(schemaName, connector, table, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	requiredFilterSets, err := engine.resolveRequiredFilters(schemaName, connector, plans, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []func() models.RowIterator
+	for _, requiredFilters := range requiredFilterSets {
+		connectorQuery := connectors.ConnectorQuery{
+			TableName:       table,
+			ColumnNames:     []string{column},
+			RequiredFilters: requiredFilters,
+			Stats:           stats,
+		}
+		sources = append(sources, func() models.RowIterator {
+			return connector.Get(connectorQuery)
+		})
+	}
+
+	rows, err := models.Collect(engine.parallel(schemaName, sources))
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, row := range rows {
+		values = append(values, row[column])
+	}
+
+	return values, nil
+}
@@ -0,0 +1,270 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"fmt"
+	"io"
+
+	"golang.org/x/exp/slices"
+)
+
+// How each set operation is written in SQL
+var setOperationNames = map[string]string{
+	"union":     "union",
+	"unionall":  "union all",
+	"intersect": "intersect",
+	"except":    "except",
+}
+
+// Plans each of the combined queries on its own, then combines their results. Columns
+// are matched up by position, and named after the first query's. Every value is text, so
+// the only check is that each query has the same number of columns. A column is compared
+// with case if it is in any of the queries
+func (engine *QueryEngine) planSetOperations(query models.Query) (planNode, []string, []string, error) {
+	first := query
+	first.SetOperations, first.OrderBy, first.Limit, first.Offset = nil, nil, 0, 0
+
+	node, columns, caseSensitive, err := engine.planQuery(first)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// 'intersect' is done before 'union' and 'except', in the same way as '*' is done before
+	// '+' and '-', so 'a union b intersect c' is 'a union (b intersect c)'
+	terms := []planNode{node}
+	termColumns := [][]string{columns}
+	var operations []string
+	var combined []*setOperationNode
+
+	for index, operation := range query.SetOperations {
+		right, rightColumns, rightCaseSensitive, err := engine.planQuery(operation.Query)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if len(rightColumns) != len(columns) {
+			return nil, nil, nil, fmt.Errorf(
+				"queries combined with '%v' need the same number of columns, but the first has %v and query %v has %v",
+				setOperationNames[operation.Type], len(columns), index+2, len(rightColumns),
+			)
+		}
+
+		for position, column := range rightColumns {
+			if slices.Contains(rightCaseSensitive, column) && !slices.Contains(caseSensitive, columns[position]) {
+				caseSensitive = append(caseSensitive, columns[position])
+			}
+		}
+
+		last := len(terms) - 1
+		if operation.Type == "intersect" {
+			intersect := &setOperationNode{
+				left: terms[last], right: right, operation: operation.Type,
+				names: columns, leftColumns: termColumns[last], rightColumns: rightColumns,
+			}
+			terms[last] = intersect
+			termColumns[last] = columns
+			combined = append(combined, intersect)
+			continue
+		}
+
+		terms = append(terms, right)
+		termColumns = append(termColumns, rightColumns)
+		operations = append(operations, operation.Type)
+	}
+
+	node = terms[0]
+	for index, operation := range operations {
+		union := &setOperationNode{
+			left: node, right: terms[index+1], operation: operation,
+			names: columns, leftColumns: termColumns[0], rightColumns: termColumns[index+1],
+		}
+		node = union
+		termColumns[0] = columns
+		combined = append(combined, union)
+	}
+
+	// Every query has been planned, so it's now known which columns are compared with case
+	for _, operation := range combined {
+		operation.caseSensitive = caseSensitive
+	}
+
+	if len(query.OrderBy) > 0 {
+		for _, orderBy := range query.OrderBy {
+			if !slices.Contains(columns, orderBy.FieldName) {
+				return nil, nil, nil, fmt.Errorf("'%v' needs to be one of the columns of the combined queries to sort by it", orderBy.FieldName)
+			}
+		}
+		node = &sortNode{child: node, orderBy: query.OrderBy, caseSensitive: caseSensitive}
+	}
+
+	if query.Limit != 0 || query.Offset != 0 {
+		node = &limitNode{child: node, limit: query.Limit, offset: query.Offset}
+	}
+
+	return node, columns, caseSensitive, nil
+}
+
+// setOperationNode combines the rows of its children, which have the same number of
+// columns but not necessarily the same names
+type setOperationNode struct {
+	left      planNode
+	right     planNode
+	operation string // 'union', 'unionall', 'intersect' or 'except'
+
+	names        []string // The names of the columns in the results..
+	leftColumns  []string // .. and the columns of each child they come from
+	rightColumns []string
+
+	caseSensitive []string // The names of the columns that are compared with case
+}
+
+func (n *setOperationNode) open() (models.RowIterator, error) {
+	left, err := n.left.open()
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := n.right.open()
+	if err != nil {
+		left.Close()
+		return nil, err
+	}
+
+	return &setOperationIterator{
+		left:  &renameIterator{rows: left, from: n.leftColumns, to: n.names},
+		right: &renameIterator{rows: right, from: n.rightColumns, to: n.names},
+		node:  n,
+		seen:  make(map[string]bool),
+	}, nil
+}
+
+func (n *setOperationNode) children() []planNode {
+	return []planNode{n.left, n.right}
+}
+
+func (n *setOperationNode) describe() []string {
+	switch n.operation {
+	case "unionall":
+		return []string{"Union all"}
+	case "union":
+		return []string{"Union", "removes duplicate rows"}
+	case "intersect":
+		return []string{"Intersect", "only rows in both, without duplicates"}
+	}
+	return []string{"Except", "only rows on the left that aren't on the right, without duplicates"}
+}
+
+type setOperationIterator struct {
+	left  models.RowIterator
+	right models.RowIterator
+	node  *setOperationNode
+
+	// The rows we've returned, for removing duplicates, and the rows of the right
+	// side for 'intersect' and 'except'
+	seen     map[string]bool
+	rightSet map[string]bool
+	leftDone bool
+}
+
+func (it *setOperationIterator) Next() (map[string]string, error) {
+	if it.node.operation == "union" || it.node.operation == "unionall" {
+		return it.nextUnion()
+	}
+
+	if it.rightSet == nil {
+		err := it.readRight()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		row, err := it.left.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		// 'intersect' wants the rows that are on the right, and 'except' the ones that aren't
+		key := joinKey(row, it.node.names, it.node.caseSensitive)
+		if it.seen[key] || it.rightSet[key] != (it.node.operation == "intersect") {
+			continue
+		}
+		it.seen[key] = true
+		return row, nil
+	}
+}
+
+// Every row of the left, then every row of the right
+func (it *setOperationIterator) nextUnion() (map[string]string, error) {
+	for {
+		rows := it.right
+		if !it.leftDone {
+			rows = it.left
+		}
+
+		row, err := rows.Next()
+		if err == io.EOF && !it.leftDone {
+			it.leftDone = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if it.node.operation == "unionall" {
+			return row, nil
+		}
+
+		key := joinKey(row, it.node.names, it.node.caseSensitive)
+		if !it.seen[key] {
+			it.seen[key] = true
+			return row, nil
+		}
+	}
+}
+
+func (it *setOperationIterator) readRight() error {
+	it.rightSet = make(map[string]bool)
+	defer it.right.Close()
+
+	for {
+		row, err := it.right.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		it.rightSet[joinKey(row, it.node.names, it.node.caseSensitive)] = true
+	}
+}
+
+func (it *setOperationIterator) Close() {
+	it.left.Close()
+	it.right.Close()
+}
+
+// renameIterator renames each column in 'from' to the column in the same place in 'to',
+// and drops any others
+type renameIterator struct {
+	rows models.RowIterator
+	from []string
+	to   []string
+}
+
+func (it *renameIterator) Next() (map[string]string, error) {
+	row, err := it.rows.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(it.to))
+	for index, column := range it.from {
+		result[it.to[index]] = row[column]
+	}
+	return result, nil
+}
+
+func (it *renameIterator) Close() {
+	it.rows.Close()
+}
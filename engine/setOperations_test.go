@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetOperations(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	// Every build's result, combined with the results of the failed builds
+	combine := func(operations ...string) models.Query {
+		query := models.Query{
+			SchemaName: "ci", Table: "builds", Columns: []string{"result"},
+			OrderBy: []models.OrderBy{{FieldName: "result"}},
+		}
+		for _, operation := range operations {
+			query.SetOperations = append(query.SetOperations, models.SetOperation{
+				Type:  operation,
+				Query: models.Query{SchemaName: "ci", Table: "builds", Columns: []string{"result"}, Filters: []models.QueryFilter{{Type: "eq", FieldName: "result", Value: "failed"}}},
+			})
+		}
+		return query
+	}
+
+	values := func(query models.Query) []string {
+		result, err := engine.Execute(query)
+		assert.Nil(t, err)
+
+		var values []string
+		for _, row := range resultsOf(result) {
+			values = append(values, row["result"])
+		}
+		return values
+	}
+
+	assert.Equal(t, []string{"failed", "failed", "succeeded", "succeeded"}, values(combine("unionall")))
+	assert.Equal(t, []string{"failed", "succeeded"}, values(combine("union")))
+	assert.Equal(t, []string{"failed"}, values(combine("intersect")))
+	assert.Equal(t, []string{"succeeded"}, values(combine("except")))
+
+	// 'intersect' goes first, so this is 'builds union (failed intersect failed)'
+	assert.Equal(t, []string{"failed", "succeeded"}, values(combine("union", "intersect")))
+}
+
+func TestSetOperationsNameColumnsAfterTheFirstQuery(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "pipelines", Columns: []string{"id", "name"},
+		Filters: []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: "prod"}},
+		SetOperations: []models.SetOperation{{
+			Type:  "unionall",
+			Query: models.Query{SchemaName: "ci", Table: "builds", Columns: []string{"id", "result"}, Limit: 1},
+		}},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "name"}, result.Columns)
+	assert.Equal(t, models.ResultTable{
+		{"id": "10", "name": "deploy"},
+		{"id": "1", "name": "succeeded"},
+	}, results)
+	assert.Equal(t, []string{"id", "result"}, connector.queryFor("builds").ColumnNames)
+}
+
+func TestSetOperationsNeedTheSameNumberOfColumns(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	_, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "pipelines", Columns: []string{"id", "name"},
+		SetOperations: []models.SetOperation{{
+			Type:  "union",
+			Query: models.Query{SchemaName: "ci", Table: "builds", Columns: []string{"id"}},
+		}},
+	})
+
+	assert.EqualError(t, err, "queries combined with 'union' need the same number of columns, but the first has 2 and query 2 has 1")
+}
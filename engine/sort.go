@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"sort"
+	"strings"
+)
+
+// sortNode reads every row of its child, then returns them in order
+type sortNode struct {
+	child         planNode
+	orderBy       []models.OrderBy
+	caseSensitive []string
+}
+
+func (n *sortNode) open() (models.RowIterator, error) {
+	rows, err := n.child.open()
+	if err != nil {
+		return nil, err
+	}
+	return &sortIterator{rows: rows, node: n}, nil
+}
+
+func (n *sortNode) children() []planNode {
+	return []planNode{n.child}
+}
+
+func (n *sortNode) describe() []string {
+	var columns []string
+	for _, orderBy := range n.orderBy {
+		if orderBy.Descending {
+			columns = append(columns, orderBy.FieldName+" desc")
+		} else {
+			columns = append(columns, orderBy.FieldName)
+		}
+	}
+	return []string{"Sort " + strings.Join(columns, ", ")}
+}
+
+type sortIterator struct {
+	rows   models.RowIterator
+	node   *sortNode
+	sorted models.RowIterator
+}
+
+func (it *sortIterator) Next() (map[string]string, error) {
+	if it.sorted == nil {
+		rows, err := models.Collect(it.rows)
+		if err != nil {
+			return nil, err
+		}
+
+		// Stable, so rows that are equal stay in the order the connector returned them
+		sort.SliceStable(rows, func(i, j int) bool {
+			return compareRows(rows[i], rows[j], it.node.orderBy, it.node.caseSensitive) < 0
+		})
+		it.sorted = models.NewTableIterator(rows)
+	}
+	return it.sorted.Next()
+}
+
+func (it *sortIterator) Close() {
+	it.rows.Close()
+}
@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// subqueryNode is a query in the 'from' clause, which is used like a table. Its rows
+// are the subquery's results
+type subqueryNode struct {
+	child planNode
+
+	// As with scans, when there's more than one table the columns are named 'alias.column'
+	alias   string
+	qualify bool
+}
+
+func (n *subqueryNode) provides(field string) bool {
+	return !n.qualify || strings.HasPrefix(field, n.alias+".")
+}
+
+// The column's name in the subquery's results
+func (n *subqueryNode) localName(field string) string {
+	if !n.qualify {
+		return field
+	}
+	return strings.TrimPrefix(field, n.alias+".")
+}
+
+func (n *subqueryNode) open() (models.RowIterator, error) {
+	rows, err := n.child.open()
+	if err != nil {
+		return nil, err
+	}
+
+	if n.qualify {
+		rows = &qualifyIterator{rows: rows, prefix: n.alias + "."}
+	}
+	return rows, nil
+}
+
+func (n *subqueryNode) children() []planNode {
+	return []planNode{n.child}
+}
+
+func (n *subqueryNode) describe() []string {
+	return []string{"Subquery as " + n.alias}
+}
+
+// subqueriesNode runs the subqueries in the filters below it (which don't depend on the
+// rows being filtered, so only need running once) before opening its child. Until then
+// the filters have the subquery in place of its results
+type subqueriesNode struct {
+	subqueries []planNode
+	child      planNode
+
+	// What each subquery's filter becomes once it has run
+	results map[*models.Query]models.QueryFilter
+}
+
+// Plans the subqueries in the filters, which will run when the node is opened
+func (engine *QueryEngine) planSubqueries(filters []models.QueryFilter, node *subqueriesNode) error {
+	for _, filter := range filters {
+		err := engine.planSubqueries(filter.Children, node)
+		if err != nil {
+			return err
+		}
+
+		if filter.Subquery == nil {
+			continue
+		}
+
+		subquery := *filter.Subquery
+		if filter.Type == "exists" || filter.Type == "notexists" {
+			// We only need to know if there's a row
+			subquery.Limit = 1
+		}
+
+		plan, columns, _, err := engine.planQuery(subquery)
+		if err != nil {
+			return fmt.Errorf("in subquery: %v", err)
+		}
+
+		if (filter.Type == "in" || filter.Type == "notin") && len(columns) != 1 {
+			return fmt.Errorf("a subquery used with 'in' needs to select a single column")
+		}
+
+		node.subqueries = append(node.subqueries, &subqueryFilterNode{
+			child:   plan,
+			filter:  filter,
+			columns: columns,
+			results: node.results,
+		})
+	}
+	return nil
+}
+
+func (n *subqueriesNode) open() (models.RowIterator, error) {
+	for _, subquery := range n.subqueries {
+		rows, err := subquery.open()
+		if err != nil {
+			return nil, err
+		}
+
+		// The results are kept by the node, so this just reads to the end of them
+		_, err = models.Collect(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := withSubqueryResults(n.child, n.results)
+	if err != nil {
+		return nil, err
+	}
+	return n.child.open()
+}
+
+func (n *subqueriesNode) children() []planNode {
+	return append(slices.Clone(n.subqueries), n.child)
+}
+
+func (n *subqueriesNode) describe() []string {
+	return []string{"Run the subqueries, then the query"}
+}
+
+// subqueryFilterNode runs the subquery in a filter, and works out what the filter becomes.
+// 'x in (select ...)' becomes a list of values, so it can be sent to the connector like
+// any other, and 'exists (select ...)' becomes always true or always false
+type subqueryFilterNode struct {
+	child   planNode
+	filter  models.QueryFilter
+	columns []string
+	results map[*models.Query]models.QueryFilter
+}
+
+func (n *subqueryFilterNode) open() (models.RowIterator, error) {
+	rows, err := n.child.open()
+	if err != nil {
+		return nil, fmt.Errorf("in subquery: %v", err)
+	}
+
+	results, err := models.Collect(rows)
+	if err != nil {
+		return nil, fmt.Errorf("in subquery: %v", err)
+	}
+
+	switch n.filter.Type {
+	case "exists":
+		n.results[n.filter.Subquery] = alwaysTrueOrFalse(len(results) > 0)
+	case "notexists":
+		n.results[n.filter.Subquery] = alwaysTrueOrFalse(len(results) == 0)
+	default:
+		values := []string{}
+		for _, row := range results {
+			values = append(values, row[n.columns[0]])
+		}
+		n.results[n.filter.Subquery] = models.QueryFilter{Type: n.filter.Type, Values: values}
+	}
+
+	return models.NewTableIterator(results), nil
+}
+
+func (n *subqueryFilterNode) children() []planNode {
+	return []planNode{n.child}
+}
+
+func (n *subqueryFilterNode) describe() []string {
+	return []string{"Subquery for " + n.filter.String()}
+}
+
+// Puts the results of the subqueries in to the filters of the node and the nodes below it
+func withSubqueryResults(node planNode, results map[*models.Query]models.QueryFilter) error {
+	if analyzed, isAnalyzed := node.(*analyzedNode); isAnalyzed {
+		node = analyzed.planNode
+	}
+
+	switch n := node.(type) {
+	case *scanNode:
+		n.filters = filtersWithSubqueryResults(n.filters, results)
+		n.pushed = filtersWithSubqueryResults(n.pushed, results)
+
+		// The results might be the values of a required filter
+		return n.planRequiredFilters()
+	case *filterNode:
+		n.filters = filtersWithSubqueryResults(n.filters, results)
+	}
+
+	for _, child := range node.children() {
+		err := withSubqueryResults(child, results)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replaces the filters with subqueries that have run. The filter keeps its column (which
+// might have been renamed for the connector) and takes the values from the subquery
+func filtersWithSubqueryResults(filters []models.QueryFilter, results map[*models.Query]models.QueryFilter) []models.QueryFilter {
+	var replaced []models.QueryFilter
+	for _, filter := range filters {
+		if len(filter.Children) > 0 {
+			filter.Children = filtersWithSubqueryResults(filter.Children, results)
+		}
+
+		if result, found := results[filter.Subquery]; filter.Subquery != nil && found {
+			if filter.Type == "in" || filter.Type == "notin" {
+				filter.Values = result.Values
+				filter.Subquery = nil
+			} else {
+				filter = result
+			}
+		}
+
+		replaced = append(replaced, filter)
+	}
+	return replaced
+}
+
+// An 'and' with no conditions is always true, and an 'or' with none is always false
+func alwaysTrueOrFalse(value bool) models.QueryFilter {
+	if value {
+		return models.QueryFilter{Type: "and"}
+	}
+	return models.QueryFilter{Type: "or"}
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// e.g. "select id from ci.builds where pipeline in (select id from ci.pipelines where folder = 'prod')"
+func TestInSubqueryIsRunFirstAndSentToTheConnector(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id"},
+		Filters: []models.QueryFilter{{Type: "in", FieldName: "pipeline", Subquery: &models.Query{
+			SchemaName: "ci", Table: "pipelines",
+			Columns: []string{"id"},
+			Filters: []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: "prod"}},
+		}}},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"id": "1"}, {"id": "2"}}, results)
+	assert.Equal(t, "pipelines", connector.queries[0].TableName)
+	assert.Equal(t,
+		[]models.QueryFilter{{Type: "in", FieldName: "pipeline", Values: []string{"10"}}},
+		connector.queryFor("builds").Filters,
+	)
+}
+
+func TestExistsSubqueries(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	existsQuery := func(filterType string, folder string) models.Query {
+		return models.Query{
+			SchemaName: "ci", Table: "builds",
+			Columns: []string{"id"},
+			Filters: []models.QueryFilter{{Type: filterType, Subquery: &models.Query{
+				SchemaName: "ci", Table: "pipelines",
+				Filters: []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: folder}},
+			}}},
+		}
+	}
+
+	result, err := engine.Execute(existsQuery("exists", "prod"))
+	exists := resultsOf(result)
+	assert.Nil(t, err)
+
+	result, err = engine.Execute(existsQuery("exists", "archive"))
+	doesNotExist := resultsOf(result)
+	assert.Nil(t, err)
+
+	result, err = engine.Execute(existsQuery("notexists", "archive"))
+	notExists := resultsOf(result)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 3, len(exists))
+	assert.Equal(t, 0, len(doesNotExist))
+	assert.Equal(t, 3, len(notExists))
+}
+
+func TestInSubqueryNeedsOneColumn(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	_, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Filters: []models.QueryFilter{{Type: "in", FieldName: "pipeline", Subquery: &models.Query{
+			SchemaName: "ci", Table: "pipelines", Columns: []string{"id", "name"},
+		}}},
+	})
+
+	assert.EqualError(t, err, "a subquery used with 'in' needs to select a single column")
+}
+
+// e.g. "... inner join (select pipeline, count(*) from ci.builds group by pipeline) c on c.pipeline = p.id"
+func TestJoinsToSubqueryInFrom(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "pipelines", Alias: "p",
+		Columns: []string{"p.name", "c.count(*)"},
+		Joins: []models.Join{{
+			Type: "inner", Alias: "c",
+			Subquery: &models.Query{
+				SchemaName: "ci", Table: "builds",
+				Columns:    []string{"pipeline", "count(*)"},
+				GroupBy:    []string{"pipeline"},
+				Aggregates: []models.Aggregate{{Function: "count", Name: "count(*)"}},
+			},
+			On: []models.JoinCondition{{LeftField: "c.pipeline", RightField: "p.id"}},
+		}},
+		OrderBy: []models.OrderBy{{FieldName: "p.name"}},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"p.name": "deploy", "c.count(*)": "2"},
+		{"p.name": "test", "c.count(*)": "1"},
+	}, results)
+	assert.Equal(t, []string{"pipeline"}, connector.queryFor("builds").ColumnNames)
+}
+
+func TestSelectsEverythingFromSubqueryInFrom(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		Alias: "prod",
+		Subquery: &models.Query{
+			SchemaName: "ci", Table: "pipelines",
+			Columns: []string{"name"},
+			Filters: []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: "prod"}},
+		},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"name"}, result.Columns)
+	assert.Equal(t, models.ResultTable{{"name": "deploy"}}, results)
+}
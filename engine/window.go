@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// windowNode works out each window function for every row, from the other rows in the
+// same partition. It needs all of the rows first, so it comes after any filtering and
+// aggregating, and returns the rows in the order it read them
+type windowNode struct {
+	child         planNode
+	windows       []models.WindowFunction
+	caseSensitive []string
+}
+
+func (n *windowNode) open() (models.RowIterator, error) {
+	rows, err := n.child.open()
+	if err != nil {
+		return nil, err
+	}
+	return &windowIterator{rows: rows, node: n}, nil
+}
+
+func (n *windowNode) children() []planNode {
+	return []planNode{n.child}
+}
+
+func (n *windowNode) describe() []string {
+	var names []string
+	for _, window := range n.windows {
+		names = append(names, window.Name)
+	}
+	return []string{"Window " + strings.Join(names, ", ")}
+}
+
+type windowIterator struct {
+	rows    models.RowIterator
+	node    *windowNode
+	results models.RowIterator
+}
+
+func (it *windowIterator) Next() (map[string]string, error) {
+	if it.results == nil {
+		rows, err := models.Collect(it.rows)
+		if err != nil {
+			return nil, err
+		}
+
+		results := make(models.ResultTable, len(rows))
+		for index, row := range rows {
+			results[index] = copyRow(row)
+		}
+		for _, window := range it.node.windows {
+			applyWindow(window, results, it.node.caseSensitive)
+		}
+		it.results = models.NewTableIterator(results)
+	}
+	return it.results.Next()
+}
+
+func (it *windowIterator) Close() {
+	it.rows.Close()
+}
+
+// Adds the window function's column to each of the rows
+func applyWindow(window models.WindowFunction, rows models.ResultTable, caseSensitive []string) {
+	partitions := make(map[string][]map[string]string)
+	var order []string
+	for _, row := range rows {
+		key := joinKey(row, window.PartitionBy, caseSensitive)
+		if _, found := partitions[key]; !found {
+			order = append(order, key)
+		}
+		partitions[key] = append(partitions[key], row)
+	}
+
+	for _, key := range order {
+		partition := partitions[key]
+		sort.SliceStable(partition, func(i, j int) bool {
+			return compareRows(partition[i], partition[j], window.OrderBy, caseSensitive) < 0
+		})
+
+		for index, value := range windowValues(window, partition, caseSensitive) {
+			partition[index][window.Name] = value
+		}
+	}
+}
+
+// The value of the window function for each row of the (sorted) partition
+func windowValues(window models.WindowFunction, partition []map[string]string, caseSensitive []string) []string {
+	values := make([]string, len(partition))
+
+	// Rows that sort the same as the one before are its 'peers', as there's nothing to
+	// say which comes first
+	isPeer := func(index int) bool {
+		return index > 0 && compareRows(partition[index-1], partition[index], window.OrderBy, caseSensitive) == 0
+	}
+
+	switch window.Function {
+
+	case "row_number":
+		for index := range partition {
+			values[index] = strconv.Itoa(index + 1)
+		}
+
+	case "rank", "dense_rank":
+		// Peers have the same rank. After them, 'rank' skips ahead and 'dense_rank' doesn't
+		rank, denseRank := 0, 0
+		for index := range partition {
+			if !isPeer(index) {
+				rank = index + 1
+				denseRank++
+			}
+			values[index] = strconv.Itoa(rank)
+			if window.Function == "dense_rank" {
+				values[index] = strconv.Itoa(denseRank)
+			}
+		}
+
+	case "lag", "lead":
+		for index := range partition {
+			other := index - window.Offset
+			if window.Function == "lead" {
+				other = index + window.Offset
+			}
+			values[index] = window.Default
+			if other >= 0 && other < len(partition) {
+				values[index] = partition[other][window.FieldName]
+			}
+		}
+
+	default:
+		// Aggregates use the whole partition, or are running totals if it's ordered (in
+		// which case peers are counted together)
+		aggregate := models.Aggregate{Function: window.Function, FieldName: window.FieldName}
+		var state aggregateState
+		for index, row := range partition {
+			state.add(aggregate, row, slices.Contains(caseSensitive, window.FieldName))
+			values[index] = state.result(aggregate)
+		}
+
+		for index := len(partition) - 2; index >= 0; index-- {
+			if len(window.OrderBy) == 0 || isPeer(index+1) {
+				values[index] = values[index+1]
+			}
+		}
+	}
+
+	return values
+}
+
+func windowIsUsed(windows []models.WindowFunction, name string) bool {
+	for _, window := range windows {
+		if window.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// e.g. "select * from (select id, pipeline, row_number() over (partition by pipeline order by id desc) as n
+// from ci.builds) latest where n = 1"
+func TestWindowFunctionsInSubqueries(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	rowNumber := models.WindowFunction{
+		Function:    "row_number",
+		PartitionBy: []string{"pipeline"},
+		OrderBy:     []models.OrderBy{{FieldName: "id", Descending: true}},
+		Name:        "row_number() over (partition by pipeline order by id desc)",
+	}
+	result, err := engine.Execute(models.Query{
+		Alias: "latest",
+		Subquery: &models.Query{
+			SchemaName: "ci", Table: "builds",
+			Columns:     []string{"id", "pipeline", "n"},
+			Expressions: map[string]models.Expression{"n": {Type: "column", FieldName: rowNumber.Name}},
+			Windows:     []models.WindowFunction{rowNumber},
+		},
+		Filters: []models.QueryFilter{{Type: "eq", FieldName: "n", Value: "1"}},
+		OrderBy: []models.OrderBy{{FieldName: "id"}},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"id": "2", "pipeline": "10", "n": "1"},
+		{"id": "3", "pipeline": "20", "n": "1"},
+	}, results)
+}
+
+func TestWindowFunctions(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	windows := []models.WindowFunction{
+		{Function: "lag", FieldName: "id", Offset: 1, Default: "none", OrderBy: []models.OrderBy{{FieldName: "id"}}, Name: "previous"},
+		{Function: "lead", FieldName: "id", Offset: 2, OrderBy: []models.OrderBy{{FieldName: "id"}}, Name: "after next"},
+		{Function: "rank", OrderBy: []models.OrderBy{{FieldName: "pipeline"}}, Name: "rank"},
+		{Function: "dense_rank", OrderBy: []models.OrderBy{{FieldName: "pipeline"}}, Name: "dense rank"},
+		{Function: "sum", FieldName: "duration", OrderBy: []models.OrderBy{{FieldName: "pipeline"}}, Name: "running"},
+		{Function: "sum", FieldName: "duration", PartitionBy: []string{"pipeline"}, Name: "total"},
+	}
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id", "previous", "after next", "rank", "dense rank", "running", "total"},
+		Windows: windows,
+		Limit:   3,
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{
+		{"id": "1", "previous": "none", "after next": "3", "rank": "1", "dense rank": "1", "running": "12", "total": "12"},
+		{"id": "2", "previous": "1", "after next": "", "rank": "1", "dense rank": "1", "running": "12", "total": "12"},
+		{"id": "3", "previous": "2", "after next": "", "rank": "3", "dense rank": "2", "running": "22", "total": "10"},
+	}, results)
+
+	// The windows need every row, so the limit can't be sent to the connector
+	assert.Equal(t, 0, connector.queryFor("builds").Top)
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"devopsdb/connectors"
+	"devopsdb/models"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Tables from a 'with' clause don't have a schema
+const withSchema = ""
+
+// Plans each query in the 'with' clause, in order, and then the rest of the query with an
+// engine that can also read their results as tables. Each query can use the ones before it,
+// and any subqueries in the rest of the query can use all of them. The queries are only
+// run when the plan is opened, once each
+func (engine *QueryEngine) planWith(query models.Query) (planNode, []string, []string, error) {
+	tables := &memoryConnector{tables: make(map[string]models.ResultTable), columns: make(map[string][]string)}
+
+	// Any 'with' tables from further out can still be used
+	if outer, found := engine.connectors[withSchema].(*memoryConnector); found {
+		tables.outer = outer
+	}
+
+	scoped := &QueryEngine{
+		connectors:    make(map[string]connectors.Connector, len(engine.connectors)+1),
+		concurrency:   engine.concurrency,
+		slots:         engine.slots,
+		caseSensitive: make(map[string]map[string][]string, len(engine.caseSensitive)+1),
+	}
+	for schema, connector := range engine.connectors {
+		scoped.connectors[schema] = connector
+	}
+	scoped.connectors[withSchema] = tables
+
+	// The 'with' tables' columns are compared with case if the columns they come from are
+	for schema, columns := range engine.caseSensitive {
+		scoped.caseSensitive[schema] = columns
+	}
+	scoped.caseSensitive[withSchema] = make(map[string][]string)
+	for name, columns := range engine.caseSensitive[withSchema] {
+		scoped.caseSensitive[withSchema][name] = columns
+	}
+
+	node := &withNode{}
+	for _, expression := range query.With {
+		plan, columns, caseSensitive, err := scoped.planQuery(expression.Query)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("in '%v': %v", expression.Name, err)
+		}
+		scoped.caseSensitive[withSchema][expression.Name] = caseSensitive
+		tables.columns[expression.Name] = columns
+
+		node.expressions = append(node.expressions, &commonTableNode{
+			child:   plan,
+			name:    expression.Name,
+			columns: columns,
+			tables:  tables,
+		})
+	}
+
+	query.With = nil
+	child, columns, caseSensitive, err := scoped.planQuery(query)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	node.child = child
+
+	return node, columns, caseSensitive, nil
+}
+
+// withNode runs the queries in the 'with' clause, in order, before the query that uses them
+type withNode struct {
+	expressions []planNode
+	child       planNode
+}
+
+func (n *withNode) open() (models.RowIterator, error) {
+	for _, expression := range n.expressions {
+		rows, err := expression.open()
+		if err != nil {
+			return nil, err
+		}
+
+		// The rows are kept by the node, so this just reads to the end of them
+		_, err = models.Collect(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n.child.open()
+}
+
+func (n *withNode) children() []planNode {
+	return append(slices.Clone(n.expressions), n.child)
+}
+
+func (n *withNode) describe() []string {
+	return []string{"Run the 'with' clause, then the query"}
+}
+
+// commonTableNode is one of the queries in the 'with' clause. It keeps its rows, so the
+// rest of the query can read them as a table
+type commonTableNode struct {
+	child   planNode
+	name    string
+	columns []string
+	tables  *memoryConnector
+}
+
+func (n *commonTableNode) open() (models.RowIterator, error) {
+	rows, err := n.child.open()
+	if err != nil {
+		return nil, fmt.Errorf("in '%v': %v", n.name, err)
+	}
+
+	results, err := models.Collect(rows)
+	if err != nil {
+		return nil, fmt.Errorf("in '%v': %v", n.name, err)
+	}
+
+	n.tables.tables[n.name] = results
+	return models.NewTableIterator(results), nil
+}
+
+func (n *commonTableNode) children() []planNode {
+	return []planNode{n.child}
+}
+
+func (n *commonTableNode) describe() []string {
+	return []string{"'" + n.name + "' from the 'with' clause", "columns: " + strings.Join(n.columns, ", ")}
+}
+
+// memoryConnector serves the results of the queries in a 'with' clause
+type memoryConnector struct {
+	tables  map[string]models.ResultTable
+	columns map[string][]string
+
+	// The tables of the 'with' clause further out, if there is one
+	outer *memoryConnector
+}
+
+func (c *memoryConnector) GetSchemaForTable(table string) ([]string, error) {
+	if columns, found := c.columns[table]; found || c.outer == nil {
+		return columns, nil
+	}
+	return c.outer.GetSchemaForTable(table)
+}
+
+func (c *memoryConnector) GetRequiredFiltersForTable(table string) []connectors.RequiredFilter {
+	return nil
+}
+
+func (c *memoryConnector) SupportsFilter(table string, filter models.QueryFilter) bool {
+	return false
+}
+
+// The table's rows, which are only there once its query has run
+func (c *memoryConnector) rows(table string) (models.ResultTable, bool) {
+	if _, found := c.columns[table]; found || c.outer == nil {
+		rows, found := c.tables[table]
+		return rows, found
+	}
+	return c.outer.rows(table)
+}
+
+func (c *memoryConnector) Get(query connectors.ConnectorQuery) models.RowIterator {
+	rows, found := c.rows(query.TableName)
+	if !found {
+		return models.NewErrorIterator(fmt.Errorf("there's no table called '%v'", query.TableName))
+	}
+
+	// The same rows can be read more than once, so they're copied rather than changed
+	var result models.ResultTable
+	for _, row := range rows {
+		copied := make(map[string]string, len(row))
+		for column, value := range row {
+			if len(query.ColumnNames) == 0 || slices.Contains(query.ColumnNames, column) {
+				copied[column] = value
+			}
+		}
+		result = append(result, copied)
+	}
+
+	return models.NewTableIterator(result)
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// e.g. "with passed as (select id, pipeline from ci.builds where result = 'succeeded'),
+// deployed as (select id from passed where pipeline = '10')
+// select d.id, p.id from deployed d inner join passed p on p.id = d.id"
+func TestCommonTableExpressionsAreRunOnce(t *testing.T) {
+
+	engine, connector := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		Table: "deployed", Alias: "d",
+		Columns: []string{"d.id", "p.pipeline"},
+		Joins: []models.Join{{
+			Type: "inner", Table: "passed", Alias: "p",
+			On: []models.JoinCondition{{LeftField: "p.id", RightField: "d.id"}},
+		}},
+		With: []models.CommonTableExpression{
+			{Name: "passed", Query: models.Query{
+				SchemaName: "ci", Table: "builds",
+				Columns: []string{"id", "pipeline"},
+				Filters: []models.QueryFilter{{Type: "eq", FieldName: "result", Value: "succeeded"}},
+			}},
+			{Name: "deployed", Query: models.Query{
+				Table:   "passed",
+				Columns: []string{"id"},
+				Filters: []models.QueryFilter{{Type: "eq", FieldName: "pipeline", Value: "10"}},
+			}},
+		},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"d.id": "1", "p.pipeline": "10"}}, results)
+	assert.Equal(t, 1, len(connector.queries))
+}
+
+func TestCommonTableExpressionsCanBeUsedInSubqueries(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	result, err := engine.Execute(models.Query{
+		SchemaName: "ci", Table: "builds",
+		Columns: []string{"id"},
+		Filters: []models.QueryFilter{{Type: "in", FieldName: "pipeline", Subquery: &models.Query{Table: "prod", Columns: []string{"id"}}}},
+		With: []models.CommonTableExpression{
+			{Name: "prod", Query: models.Query{
+				SchemaName: "ci", Table: "pipelines",
+				Filters: []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: "prod"}},
+			}},
+		},
+	})
+	results := resultsOf(result)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"id": "1"}, {"id": "2"}}, results)
+}
+
+func TestUnknownTablesWithoutSchema(t *testing.T) {
+
+	engine, _ := createPlannerEngine()
+
+	_, err := engine.Execute(models.Query{Table: "builds"})
+	assert.EqualError(t, err, "there's no table called 'builds', tables need a schema (e.g. devops.builds) unless they're from a 'with' clause")
+
+	_, err = engine.Execute(models.Query{
+		Table: "builds",
+		With:  []models.CommonTableExpression{{Name: "recent", Query: models.Query{SchemaName: "ci", Table: "builds"}}},
+	})
+	assert.EqualError(t, err, "there's no table called 'builds' in the 'with' clause")
+}
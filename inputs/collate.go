@@ -0,0 +1,118 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blastrain/vitess-sqlparser/tidbparser/ast"
+	"golang.org/x/exp/slices"
+)
+
+// The parser reads 'collate' but throws it away, and doesn't know 'ilike', so before the
+// query is parsed "x collate utf8mb4_bin" is swapped for a call to this, e.g.
+// "collated(x, 'utf8mb4_bin')", and "x ilike y" for "collated(x, 'ci') like y"
+const collatedPlaceholder = "collated"
+
+var collatePattern = regexp.MustCompile(`(?i)^collate\s+(\w+)`)
+var ilikePattern = regexp.MustCompile(`(?i)^(not\s+)?ilike\b`)
+
+func replaceCollations(query string) (string, error) {
+	for {
+		replaced, found, err := replaceCollation(query)
+		if err != nil || !found {
+			return query, err
+		}
+		query = replaced
+	}
+}
+
+// Replaces the first 'collate' or 'ilike' that isn't in quotes
+func replaceCollation(query string) (string, bool, error) {
+	scanner := newQueryScanner(query)
+
+	for scanner.next() {
+		if !scanner.atWordStart() {
+			continue
+		}
+		index := scanner.position
+
+		if match := collatePattern.FindStringSubmatch(query[index:]); match != nil {
+			start, found := operandBefore(query, index, scanner.openedAt, scanner.quotedFrom)
+			if !found {
+				return "", false, fmt.Errorf("'collate' needs to come after a column or value, e.g. name collate utf8mb4_bin = 'Main'")
+			}
+			operand := strings.TrimSpace(query[start:index])
+			return query[:start] + collatedPlaceholder + "(" + operand + ", " + quoted(match[1]) + ")" + query[index+len(match[0]):], true, nil
+		}
+
+		if match := ilikePattern.FindStringSubmatch(query[index:]); match != nil {
+			start, found := operandBefore(query, index, scanner.openedAt, scanner.quotedFrom)
+			if !found {
+				return "", false, fmt.Errorf("'ilike' needs to come after a column, e.g. name ilike 'main%%'")
+			}
+			operand := strings.TrimSpace(query[start:index])
+			like := " like"
+			if match[1] != "" {
+				like = " not like"
+			}
+			return query[:start] + collatedPlaceholder + "(" + operand + ", 'ci')" + like + query[index+len(match[0]):], true, nil
+		}
+	}
+
+	return query, false, nil
+}
+
+// Finds the start of the column, value or function call that comes before the index
+func operandBefore(query string, index int, openedAt map[int]int, quotedFrom map[int]int) (int, bool) {
+	end := len(strings.TrimRight(query[:index], " \t\r\n")) - 1
+	if end < 0 {
+		return 0, false
+	}
+	if start, isQuoted := quotedFrom[end]; isQuoted {
+		return start, true
+	}
+
+	start := end
+	if query[end] == ')' {
+		opened, isBracket := openedAt[end]
+		if !isBracket {
+			return 0, false
+		}
+		start = opened
+	} else if !isWordCharacter(query[end]) {
+		return 0, false
+	}
+
+	// The name of a column or function
+	for start > 0 && isWordCharacter(query[start-1]) {
+		start--
+	}
+	if slices.Contains(keywordsBeforeOperands, strings.ToLower(query[start:end+1])) {
+		return 0, false
+	}
+	return start, true
+}
+
+// The words that can come before a column or value, rather than being one
+var keywordsBeforeOperands = []string{"select", "where", "on", "and", "or", "not", "when", "then", "else", "by"}
+
+// Reads the name of a collation, which only matters for whether it ignores case, e.g.
+// 'utf8mb4_general_ci' does and 'utf8mb4_bin' doesn't
+func readCollation(name string) (string, error) {
+	name = strings.ToLower(name)
+	switch {
+	case name == "ci" || strings.HasSuffix(name, "_ci"):
+		return models.CaseInsensitive, nil
+	case name == "cs" || name == "binary" || strings.HasSuffix(name, "_cs") || strings.HasSuffix(name, "_bin"):
+		return models.CaseSensitive, nil
+	}
+	return "", fmt.Errorf("unknown collation '%v', use one that ends in _ci to ignore case (e.g. utf8mb4_general_ci) or _bin to match it exactly (e.g. utf8mb4_bin)", name)
+}
+
+// Reads the collation from one of the placeholders for 'collate'
+func readCollatedPlaceholder(node *ast.FuncCallExpr) (string, error) {
+	name, _ := node.Args[1].(*ast.ValueExpr).GetDatum().ToString()
+	return readCollation(name)
+}
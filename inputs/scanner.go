@@ -0,0 +1,91 @@
+package inputs
+
+// queryScanner steps through the text of a query for the parts of it we read before the
+// parser does. It skips over quoted text, including quotes inside it that are escaped with a
+// backslash or doubled (e.g. 'it\'s'), and keeps track of the brackets it's in
+type queryScanner struct {
+	text     string
+	position int // The character we're at, which is never in quotes
+	depth    int // How many brackets we're in, counting one we're at
+
+	unclosed   []int
+	openedAt   map[int]int // The opening bracket for each closing one
+	quotedFrom map[int]int // The opening quote for each closing one
+}
+
+func newQueryScanner(text string) *queryScanner {
+	return &queryScanner{text: text, position: -1, openedAt: make(map[int]int), quotedFrom: make(map[int]int)}
+}
+
+// Moves on to the next character that isn't in quotes, or returns false if there isn't one
+func (s *queryScanner) next() bool {
+	for s.position++; s.position < len(s.text); s.position++ {
+		switch s.text[s.position] {
+		case '\'', '"', '`':
+			s.skipQuoted()
+			continue
+		case '(':
+			s.depth++
+			s.unclosed = append(s.unclosed, s.position)
+		case ')':
+			s.depth--
+			if len(s.unclosed) > 0 {
+				s.openedAt[s.position] = s.unclosed[len(s.unclosed)-1]
+				s.unclosed = s.unclosed[:len(s.unclosed)-1]
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Moves from an opening quote to the one that closes it. A doubled quote is part of the
+// text, and so is anything after a backslash, except in the `quotes` around names
+func (s *queryScanner) skipQuoted() {
+	quote := s.text[s.position]
+	start := s.position
+
+	for s.position++; s.position < len(s.text); s.position++ {
+		char := s.text[s.position]
+		switch {
+		case char == '\\' && quote != '`':
+			s.position++
+		case char == quote && s.position+1 < len(s.text) && s.text[s.position+1] == quote:
+			s.position++
+		case char == quote:
+			s.quotedFrom[s.position] = start
+			return
+		}
+	}
+}
+
+func (s *queryScanner) char() byte {
+	return s.text[s.position]
+}
+
+// The text from the character we're at onwards
+func (s *queryScanner) rest() string {
+	return s.text[s.position:]
+}
+
+// Whether we're at the start of a word, rather than part way through one
+func (s *queryScanner) atWordStart() bool {
+	return s.position == 0 || !isWordCharacter(s.text[s.position-1])
+}
+
+// Finds the bracket that closes the one at 'start', skipping over any quoted text
+func closingBracket(text string, start int) (int, bool) {
+	scanner := newQueryScanner(text)
+	scanner.position = start - 1
+
+	for scanner.next() {
+		if scanner.char() == ')' && scanner.depth == 0 {
+			return scanner.position, true
+		}
+	}
+	return 0, false
+}
+
+func isWordCharacter(char byte) bool {
+	return char == '_' || char == '.' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+}
@@ -0,0 +1,44 @@
+package inputs
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The parser doesn't know about 'intersect' or 'except', so queries are split on all of
+// the set operations before they're parsed
+var setOperationPattern = regexp.MustCompile(`(?i)^(union\s+all|union\s+distinct|union|intersect|except)\b`)
+
+// Splits 'select ... union select ...' in to each select, and the operations between them.
+// Anything in brackets (e.g. a subquery) or quotes is left alone
+func splitSetOperations(query string) ([]string, []string) {
+	var parts []string
+	var operations []string
+
+	scanner := newQueryScanner(query)
+	start := 0
+
+	for scanner.next() {
+		// Operations are whole words, outside of any brackets
+		if scanner.depth != 0 || !scanner.atWordStart() {
+			continue
+		}
+
+		match := setOperationPattern.FindStringSubmatch(scanner.rest())
+		if match == nil {
+			continue
+		}
+
+		operation := strings.ToLower(strings.Join(strings.Fields(match[1]), ""))
+		if operation == "uniondistinct" {
+			operation = "union"
+		}
+
+		parts = append(parts, query[start:scanner.position])
+		operations = append(operations, operation)
+		scanner.position += len(match[0]) - 1
+		start = scanner.position + 1
+	}
+
+	return append(parts, query[start:]), operations
+}
@@ -2,89 +2,826 @@ package inputs
 
 import (
 	"devopsdb/models"
-	"log"
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/blastrain/vitess-sqlparser/tidbparser/ast"
+	"github.com/blastrain/vitess-sqlparser/tidbparser/dependency/mysql"
+	"github.com/blastrain/vitess-sqlparser/tidbparser/dependency/types"
 	"github.com/blastrain/vitess-sqlparser/tidbparser/parser"
 	"github.com/blastrain/vitess-sqlparser/tidbparser/parser/opcode"
+	"golang.org/x/exp/slices"
 )
 
+// The parser doesn't know about 'explain analyze', so we take the 'analyze' out first
+var explainAnalyzePattern = regexp.MustCompile(`(?i)^\s*explain\s+analyze\s`)
+
 func SqlToQuery(query string) (models.Query, error) {
+	query, err := replaceWindowFunctions(query)
+	if err != nil {
+		return models.Query{}, err
+	}
+
+	query, err = replaceCollations(query)
+	if err != nil {
+		return models.Query{}, err
+	}
+
+	query, with, err := readWith(query)
+	if err != nil {
+		return models.Query{}, err
+	}
+
+	result, err := statementToQuery(query)
+	result.With = with
+	return result, err
+}
+
+// Reads a statement, which can be several selects combined with 'union' etc.
+func statementToQuery(query string) (models.Query, error) {
+	parts, operations := splitSetOperations(query)
+
+	result, err := selectStatementToQuery(parts[0])
+	if err != nil || len(operations) == 0 {
+		return result, err
+	}
+
+	for index, operation := range operations {
+		combined, err := selectStatementToQuery(parts[index+1])
+		if err != nil {
+			return result, err
+		}
+		if combined.Explain {
+			return result, fmt.Errorf("'explain' needs to go at the start of the query")
+		}
+		result.SetOperations = append(result.SetOperations, models.SetOperation{Type: operation, Query: combined})
+	}
+
+	// The parser thinks the 'order by' and 'limit' at the end belong to the last select,
+	// but they're for the combined results
+	last := &result.SetOperations[len(result.SetOperations)-1].Query
+	if len(result.OrderBy) > 0 || result.Limit != 0 || result.Offset != 0 {
+		return result, fmt.Errorf("'order by' and 'limit' can only go at the end of queries combined with '%v'", operations[0])
+	}
+	result.OrderBy, result.Limit, result.Offset = last.OrderBy, last.Limit, last.Offset
+	last.OrderBy, last.Limit, last.Offset = nil, 0, 0
+
+	return result, nil
+}
+
+func selectStatementToQuery(query string) (models.Query, error) {
 	p := parser.New()
 
+	analyze := explainAnalyzePattern.MatchString(query)
+	if analyze {
+		query = "explain " + explainAnalyzePattern.ReplaceAllString(query, "")
+	}
+
 	stmtNodes, err := p.Parse(query, "", "")
 	if err != nil {
-		log.Fatal(err)
+		return models.Query{}, err
+	}
+
+	switch stmt := stmtNodes[0].(type) {
+
+	case *ast.SelectStmt:
+		return selectToQuery(stmt)
+
+	case *ast.ExplainStmt:
+		selectStmt, isSelect := stmt.Stmt.(*ast.SelectStmt)
+		if !isSelect {
+			return models.Query{}, fmt.Errorf("only select statements can be explained")
+		}
+		result, err := selectToQuery(selectStmt)
+		result.Explain = true
+		result.Analyze = analyze
+		return result, err
+	}
+
+	return models.Query{}, fmt.Errorf("only select statements are supported")
+}
+
+// The parts of a select statement are read separately, as the same node types (e.g.
+// column names) mean different things in different clauses
+func selectToQuery(stmt *ast.SelectStmt) (models.Query, error) {
+	result := models.Query{}
+
+	if stmt.From == nil {
+		return result, fmt.Errorf("the query needs a 'from' clause")
+	}
+
+	err := readFrom(stmt.From.TableRefs, &result)
+	if err != nil {
+		return result, err
+	}
+
+	for _, field := range stmt.Fields.Fields {
+		err = readSelectField(field, &result)
+		if err != nil {
+			return result, err
+		}
+	}
+	result.Distinct = stmt.Distinct
+
+	result.Filters, err = readFilters(stmt.Where)
+	if err != nil {
+		return result, err
+	}
+
+	if stmt.GroupBy != nil {
+		for _, item := range stmt.GroupBy.Items {
+			column, isColumn := item.Expr.(*ast.ColumnNameExpr)
+			if !isColumn {
+				return result, fmt.Errorf("only columns can be used in 'group by'")
+			}
+			result.GroupBy = append(result.GroupBy, columnName(column.Name))
+		}
+	}
+
+	if stmt.OrderBy != nil {
+		for _, item := range stmt.OrderBy.Items {
+			fieldName, err := readOrderByItem(item, &result)
+			if err != nil {
+				return result, err
+			}
+			result.OrderBy = append(result.OrderBy, models.OrderBy{FieldName: fieldName, Descending: item.Desc})
+		}
+	}
+
+	readLimit(stmt.Limit, &result)
+
+	return result, nil
+}
+
+func readLimit(limit *ast.Limit, result *models.Query) {
+	if limit == nil {
+		return
+	}
+	result.Limit = int(limit.Count.GetDatum().GetInt64())
+	if limit.Offset != nil {
+		result.Offset = int(limit.Offset.GetDatum().GetInt64())
+	}
+}
+
+// Reads a select, or selects combined with 'union', in brackets (e.g. a subquery)
+func resultSetToQuery(node ast.ResultSetNode) (models.Query, error) {
+	switch stmt := node.(type) {
+	case *ast.SelectStmt:
+		return selectToQuery(stmt)
+	case *ast.UnionStmt:
+		return unionToQuery(stmt)
+	}
+	return models.Query{}, fmt.Errorf("only select statements can be used as subqueries")
+}
+
+// The parser only keeps one 'distinct' for all of the unions in brackets, so they're
+// either all 'union' or all 'union all'
+func unionToQuery(stmt *ast.UnionStmt) (models.Query, error) {
+	operation := "unionall"
+	if stmt.Distinct {
+		operation = "union"
+	}
+
+	var result models.Query
+	for index, selectStmt := range stmt.SelectList.Selects {
+		query, err := selectToQuery(selectStmt)
+		if err != nil {
+			return result, err
+		}
+
+		if index == 0 {
+			result = query
+		} else {
+			result.SetOperations = append(result.SetOperations, models.SetOperation{Type: operation, Query: query})
+		}
+	}
+
+	if stmt.OrderBy != nil {
+		for _, item := range stmt.OrderBy.Items {
+			column, isColumn := item.Expr.(*ast.ColumnNameExpr)
+			if !isColumn {
+				return result, fmt.Errorf("only columns can be used in the 'order by' of a union")
+			}
+			result.OrderBy = append(result.OrderBy, models.OrderBy{FieldName: columnName(column.Name), Descending: item.Desc})
+		}
+	}
+
+	readLimit(stmt.Limit, &result)
+
+	return result, nil
+}
+
+// The first table goes in the query itself, and every other one is a join. Joins are
+// nested with the earliest on the left, e.g. '(a join b) join c'
+func readFrom(join *ast.Join, result *models.Query) error {
+	switch left := join.Left.(type) {
+	case *ast.Join:
+		err := readFrom(left, result)
+		if err != nil {
+			return err
+		}
+	case *ast.TableSource:
+		source, err := readTableSource(left)
+		if err != nil {
+			return err
+		}
+		result.SchemaName, result.Table, result.Alias, result.Subquery = source.SchemaName, source.Table, source.Alias, source.Subquery
+	}
+
+	if join.Right == nil {
+		return nil
+	}
+
+	right, isTable := join.Right.(*ast.TableSource)
+	if !isTable {
+		return fmt.Errorf("only tables can be joined")
+	}
+
+	joined, err := readTableSource(right)
+	if err != nil {
+		return err
+	}
+
+	joinType := "inner"
+	if join.Tp == ast.LeftJoin {
+		joinType = "left"
+	}
+	if join.Tp == ast.RightJoin {
+		return fmt.Errorf("right joins aren't supported, swap the tables around and use a left join")
+	}
+
+	joined.Type = joinType
+
+	if join.On != nil {
+		for _, condition := range splitAnd(join.On.Expr) {
+			if left, right, isEquality := columnEquality(condition); isEquality {
+				joined.On = append(joined.On, models.JoinCondition{LeftField: left, RightField: right})
+				continue
+			}
+
+			filters, err := readFilters(condition)
+			if err != nil {
+				return err
+			}
+			joined.Filters = append(joined.Filters, filters...)
+		}
+	}
+
+	result.Joins = append(result.Joins, joined)
+	return nil
+}
+
+// Reads a table, or a query used as a table, in to the parts of a join that say where
+// the rows come from
+func readTableSource(source *ast.TableSource) (models.Join, error) {
+	switch table := source.Source.(type) {
+
+	case *ast.TableName:
+		return models.Join{SchemaName: table.Schema.L, Table: table.Name.L, Alias: source.AsName.L}, nil
+
+	case *ast.SelectStmt, *ast.UnionStmt:
+		if source.AsName.L == "" {
+			return models.Join{}, fmt.Errorf("subqueries in 'from' need a name, e.g. 'from (select ...) as recent'")
+		}
+		subquery, err := resultSetToQuery(table)
+		if err != nil {
+			return models.Join{}, err
+		}
+		return models.Join{Alias: source.AsName.L, Subquery: &subquery}, nil
+	}
+
+	return models.Join{}, fmt.Errorf("only tables and subqueries are supported in 'from'")
+}
+
+// Breaks 'a and (b and c)' in to [a, b, c]
+func splitAnd(expr ast.ExprNode) []ast.ExprNode {
+	if binary, isBinary := expr.(*ast.BinaryOperationExpr); isBinary && binary.Op == opcode.LogicAnd {
+		return append(splitAnd(binary.L), splitAnd(binary.R)...)
+	}
+	if paren, isParen := expr.(*ast.ParenthesesExpr); isParen {
+		return splitAnd(paren.Expr)
+	}
+	return []ast.ExprNode{expr}
+}
+
+// Whether the expression is 'column = column'
+func columnEquality(expr ast.ExprNode) (string, string, bool) {
+	binary, isBinary := expr.(*ast.BinaryOperationExpr)
+	if !isBinary || binary.Op != opcode.EQ {
+		return "", "", false
+	}
+
+	left, leftIsColumn := binary.L.(*ast.ColumnNameExpr)
+	right, rightIsColumn := binary.R.(*ast.ColumnNameExpr)
+	if !leftIsColumn || !rightIsColumn {
+		return "", "", false
+	}
+
+	return columnName(left.Name), columnName(right.Name), true
+}
+
+func readSelectField(field *ast.SelectField, result *models.Query) error {
+	// 'select *' is represented by not listing any columns
+	if field.WildCard != nil {
+		return nil
+	}
+
+	alias := field.AsName.L
+
+	switch expr := field.Expr.(type) {
+	case *ast.ColumnNameExpr:
+		if alias == "" {
+			result.Columns = append(result.Columns, columnName(expr.Name))
+			return nil
+		}
+
+	case *ast.AggregateFuncExpr:
+		if alias == "" {
+			aggregate, err := readAggregate(expr)
+			if err != nil {
+				return err
+			}
+			addAggregate(result, aggregate)
+			result.Columns = append(result.Columns, aggregate.Name)
+			return nil
+		}
+	}
+
+	// Anything else is worked out from the columns, and named after its alias (or how
+	// it's written if it doesn't have one)
+	expression, err := readExpression(field.Expr, result)
+	if err != nil {
+		return err
+	}
+
+	// e.g. a window function, which is already a column of the rows
+	if alias == "" && expression.Type == "column" {
+		result.Columns = append(result.Columns, expression.FieldName)
+		return nil
+	}
+
+	name := alias
+	if name == "" {
+		name = expression.String()
+	}
+
+	if slices.Contains(result.Columns, name) {
+		return fmt.Errorf("there's more than one column called '%v', give one of them a different name with 'as'", name)
+	}
+
+	if result.Expressions == nil {
+		result.Expressions = make(map[string]models.Expression)
+	}
+	result.Expressions[name] = expression
+	result.Columns = append(result.Columns, name)
+	return nil
+}
+
+// The operators that can be used in expressions
+var expressionOperators = map[opcode.Op]string{
+	opcode.Plus:  "+",
+	opcode.Minus: "-",
+	opcode.Mul:   "*",
+	opcode.Div:   "/",
+	opcode.Mod:   "%",
+}
+
+// Reads a value that's worked out from each row, e.g. 'duration * 60'. Any aggregates
+// are added to the query, and the expression uses their results. There's no query in
+// a 'where' clause, as aggregates can't be used there
+func readExpression(expr ast.ExprNode, result *models.Query) (models.Expression, error) {
+	switch node := expr.(type) {
+
+	case *ast.ColumnNameExpr:
+		return models.Expression{Type: "column", FieldName: columnName(node.Name)}, nil
+
+	case *ast.ValueExpr:
+		value, err := node.GetDatum().ToString()
+		if err != nil {
+			return models.Expression{}, err
+		}
+		return models.Expression{Type: "value", Value: value}, nil
+
+	case *ast.ParenthesesExpr:
+		return readExpression(node.Expr, result)
+
+	case *ast.AggregateFuncExpr:
+		if result == nil {
+			return models.Expression{}, fmt.Errorf("aggregate functions can't be used in 'where', only in the selected columns and 'order by'")
+		}
+		aggregate, err := readAggregate(node)
+		if err != nil {
+			return models.Expression{}, err
+		}
+		addAggregate(result, aggregate)
+		return models.Expression{Type: "column", FieldName: aggregate.Name}, nil
+
+	case *ast.CaseExpr:
+		return readCase(node, result)
+
+	case *ast.UnaryOperationExpr:
+		if node.Op == opcode.Minus {
+			operand, err := readExpression(node.V, result)
+			if err != nil {
+				return models.Expression{}, err
+			}
+			return models.Expression{Type: "operator", Operator: "-", Arguments: []models.Expression{operand}}, nil
+		}
+
+	case *ast.BinaryOperationExpr:
+		operator, found := expressionOperators[node.Op]
+		if !found {
+			break
+		}
+
+		left, err := readExpression(node.L, result)
+		if err != nil {
+			return models.Expression{}, err
+		}
+		right, err := readExpression(node.R, result)
+		if err != nil {
+			return models.Expression{}, err
+		}
+		return models.Expression{Type: "operator", Operator: operator, Arguments: []models.Expression{left, right}}, nil
+
+	case *ast.FuncCallExpr:
+		function := node.FnName.L
+		if function == windowFunctionPlaceholder {
+			return readWindowPlaceholder(node, result)
+		}
+		if function == collatedPlaceholder {
+			return models.Expression{}, fmt.Errorf("'collate' and 'binary' can only be used in comparisons, e.g. where name collate utf8mb4_bin = 'Main'")
+		}
+
+		if err := models.CheckFunction(function, len(node.Args)); err != nil {
+			return models.Expression{}, err
+		}
+
+		var arguments []models.Expression
+		for _, arg := range node.Args {
+			argument, err := readExpression(arg, result)
+			if err != nil {
+				return models.Expression{}, err
+			}
+			arguments = append(arguments, argument)
+		}
+		expression := models.Expression{Type: "function", Function: function, Arguments: arguments}
+
+		// 'date' and 'timestamp' literals are read as functions
+		if (function == "dateliteral" || function == "timestampliteral") && expression.Evaluate(nil) == "" {
+			return expression, fmt.Errorf("%v isn't a valid date", expression)
+		}
+		return expression, nil
+	}
+
+	return models.Expression{}, fmt.Errorf("only columns, values, aggregates, functions, 'case' and arithmetic (+, -, *, / and %%) can be used in expressions")
+}
+
+// Reads "case when a = 'x' then ... else ... end", or "case a when 'x' then ... end", which
+// is the same as comparing 'a' with each value
+func readCase(node *ast.CaseExpr, result *models.Query) (models.Expression, error) {
+	expression := models.Expression{Type: "case"}
+
+	var value models.Expression
+	if node.Value != nil {
+		var err error
+		if value, err = readExpression(node.Value, result); err != nil {
+			return expression, err
+		}
+	}
+
+	for _, when := range node.WhenClauses {
+		var condition models.QueryFilter
+
+		if node.Value != nil {
+			compareWith, err := readExpression(when.Expr, result)
+			if err != nil {
+				return expression, err
+			}
+
+			// 'case name when folder ...' compares with the other column of each row
+			condition = models.QueryFilter{Type: "eq", Value: compareWith.Evaluate(nil)}
+			if len(compareWith.FieldNames()) > 0 {
+				condition = models.QueryFilter{Type: "eq", ValueExpression: &compareWith}
+			}
+
+			if value.Type == "column" {
+				condition.FieldName = value.FieldName
+			} else {
+				condition.Expression = &value
+			}
+		} else {
+			filters, err := readFilters(when.Expr)
+			if err != nil {
+				return expression, err
+			}
+			if len(filters) == 0 {
+				return expression, fmt.Errorf("each 'when' needs a condition, e.g. case when result = 'failed' then ...")
+			}
+
+			condition = allOf(filters)
+		}
+
+		then, err := readExpression(when.Result, result)
+		if err != nil {
+			return expression, err
+		}
+
+		expression.Conditions = append(expression.Conditions, condition)
+		expression.Arguments = append(expression.Arguments, then)
+	}
+
+	if node.ElseClause != nil {
+		otherwise, err := readExpression(node.ElseClause, result)
+		if err != nil {
+			return expression, err
+		}
+		expression.Arguments = append(expression.Arguments, otherwise)
+	}
+
+	return expression, nil
+}
+
+// Queries can be sorted by a column, an aggregate (e.g. 'order by count(*) desc') or
+// an expression, which is worked out for each row as if it was selected
+func readOrderByItem(item *ast.ByItem, result *models.Query) (string, error) {
+	switch expr := item.Expr.(type) {
+	case *ast.ColumnNameExpr:
+		return columnName(expr.Name), nil
+
+	case *ast.AggregateFuncExpr:
+		aggregate, err := readAggregate(expr)
+		if err != nil {
+			return "", err
+		}
+		addAggregate(result, aggregate)
+		return aggregate.Name, nil
+	}
+
+	expression, err := readExpression(item.Expr, result)
+	if err != nil {
+		return "", err
+	}
+	if expression.Type == "column" {
+		return expression.FieldName, nil
+	}
+
+	name := expression.String()
+	if result.Expressions == nil {
+		result.Expressions = make(map[string]models.Expression)
+	}
+	result.Expressions[name] = expression
+	return name, nil
+}
+
+var aggregateFunctions = []string{"count", "sum", "min", "max", "avg"}
+
+func readAggregate(expr *ast.AggregateFuncExpr) (models.Aggregate, error) {
+	function := strings.ToLower(expr.F)
+	if !slices.Contains(aggregateFunctions, function) {
+		return models.Aggregate{}, fmt.Errorf("unknown aggregate function '%v'", function)
 	}
 
-	visitor := &queryVisitor{}
-	stmtNodes[0].Accept(visitor)
+	fieldName := ""
+	if column, isColumn := expr.Args[0].(*ast.ColumnNameExpr); isColumn {
+		fieldName = columnName(column.Name)
+	} else if function != "count" {
+		return models.Aggregate{}, fmt.Errorf("'%v' needs a column, e.g. %v(duration)", function, function)
+	}
+
+	// count(*) is parsed as count(1)
+	argument := fieldName
+	if argument == "" {
+		argument = "*"
+	}
 
-	return visitor.resultingQuery, nil
+	if expr.Distinct {
+		if fieldName == "" {
+			return models.Aggregate{}, fmt.Errorf("'distinct' needs a column, e.g. %v(distinct result)", function)
+		}
+		argument = "distinct " + argument
+	}
+
+	return models.Aggregate{
+		Function:  function,
+		FieldName: fieldName,
+		Distinct:  expr.Distinct,
+		Name:      function + "(" + argument + ")",
+	}, nil
 }
 
-type queryVisitor struct {
-	resultingQuery models.Query
+// The same aggregate can be used more than once (e.g. selected and sorted by), but
+// only needs working out once
+func addAggregate(result *models.Query, aggregate models.Aggregate) {
+	if !slices.Contains(result.Aggregates, aggregate) {
+		result.Aggregates = append(result.Aggregates, aggregate)
+	}
+}
+
+// Columns are named as they're written, with the table (or alias) if there is one,
+// e.g. 'name' or 'p.name'
+func columnName(column *ast.ColumnName) string {
+	if column.Table.L != "" {
+		return column.Table.L + "." + column.Name.L
+	}
+	return column.Name.L
+}
+
+// Turns a where clause (or part of one) in to filters
+func readFilters(expr ast.ExprNode) ([]models.QueryFilter, error) {
+	if expr == nil {
+		return nil, nil
+	}
+
+	visitor := &filterVisitor{}
+	expr.Accept(visitor)
+
+	// e.g. "'a' = 'a'", which doesn't have a column or function to filter by
+	if visitor.inBinaryExpression {
+		visitor.fail(fmt.Errorf("conditions need to compare a column or function with something, e.g. name = 'main'"))
+	}
+	return visitor.filters, visitor.err
+}
+
+// How the operator is written, e.g. '<=>'
+func operatorText(op opcode.Op) string {
+	var text strings.Builder
+	op.Format(&text)
+	return text.String()
+}
+
+// One filter that needs all the filters to pass
+func allOf(filters []models.QueryFilter) models.QueryFilter {
+	if len(filters) == 1 {
+		return filters[0]
+	}
+	return models.QueryFilter{Type: "and", Children: filters}
+}
+
+type filterVisitor struct {
+	filters []models.QueryFilter
+
+	// The first thing we found that we can't turn in to a filter
+	err error
 
 	// Tracks whether we're in a binary expression (e.g. columnA='foo')
 	// because we'll visit both sides separately
 	inBinaryExpression bool
 	binaryExpression   models.QueryFilter
+	seenValue          bool // Whether we've seen the value side, which can be ''
+
+	// The character that escapes '%' and '_' in the 'like' we're in
+	likeEscape byte
 
 	// This stack keeps track of the current nesting of and/ors
 	binaryExpressionStack []models.QueryFilter
 }
 
-func (v *queryVisitor) Enter(in ast.Node) (ast.Node, bool) {
+func (v *filterVisitor) Enter(in ast.Node) (ast.Node, bool) {
 
 	switch node := in.(type) {
 
 	case *ast.ColumnName:
 		v.enterColumnNameNode(node)
-	case *ast.TableName:
-		v.enterTableNameNode(node)
-	case *ast.Limit:
-		v.enterLimitNode(node)
 	case *ast.BinaryOperationExpr:
+		if _, isArithmetic := expressionOperators[node.Op]; isArithmetic {
+			v.enterExpressionNode(node)
+			return in, true
+		}
 		v.enterBinaryExpressionNode(node)
 	case *ast.PatternLikeExpr:
 		v.enterLikeNode(node)
+	case *ast.PatternRegexpExpr:
+		v.enterRegexpNode(node)
+	case *ast.PatternInExpr:
+		v.enterInNode(node)
 	case *ast.ValueExpr:
 		v.enterValueNode(node)
 
+	// Subqueries are read separately, so we don't visit their columns and values
+	case *ast.SubqueryExpr:
+		v.enterSubqueryNode(node)
+		return in, true
+	case *ast.ExistsSubqueryExpr:
+		v.enterExistsNode(node, false)
+		return in, true
+	case *ast.UnaryOperationExpr:
+		if exists, isExists := node.V.(*ast.ExistsSubqueryExpr); isExists && node.Op == opcode.Not {
+			v.enterExistsNode(exists, true)
+			return in, true
+		}
+		if node.Op == opcode.Minus {
+			v.enterExpressionNode(node)
+			return in, true
+		}
+		if node.Op == opcode.Not {
+			v.enterNotNode(node)
+			return in, true
+		}
+		v.fail(fmt.Errorf("the '%v' operator isn't supported", operatorText(node.Op)))
+		return in, true
+
+	// 'between' and 'is null' are read as the comparisons they stand for
+	case *ast.BetweenExpr:
+		v.enterBetweenNode(node)
+		return in, true
+	case *ast.IsNullExpr:
+		v.enterIsNullNode(node)
+		return in, true
+	case *ast.IsTruthExpr:
+		v.fail(fmt.Errorf("'is true' and 'is false' aren't supported, use '= true' or '= false' instead"))
+		return in, true
+	case *ast.CompareSubqueryExpr:
+		v.fail(fmt.Errorf("'any' and 'all' aren't supported, use 'in' or 'exists' instead"))
+		return in, true
+	case *ast.RowExpr:
+		v.fail(fmt.Errorf("lists of columns (e.g. '(a, b) = (1, 2)') aren't supported"))
+		return in, true
+	case *ast.DefaultExpr, *ast.ParamMarkerExpr, *ast.PositionExpr, *ast.ValuesExpr, *ast.VariableExpr:
+		v.fail(fmt.Errorf("variables, parameters and 'default' aren't supported in 'where'"))
+		return in, true
+
+	// 'collate' and 'binary' say how the comparison they're in treats case
+	case *ast.FuncCastExpr:
+		if node.FunctionType == ast.CastBinaryOperator {
+			v.enterCollation(models.CaseSensitive)
+			return in, false
+		}
+		v.fail(fmt.Errorf("'cast' and 'convert' aren't supported"))
+		return in, true
+
+	// Functions etc. are read as a whole, rather than visiting their arguments
+	case *ast.FuncCallExpr:
+		if node.FnName.L == collatedPlaceholder {
+			collation, err := readCollatedPlaceholder(node)
+			if err != nil {
+				v.fail(err)
+				return in, true
+			}
+			v.enterCollation(collation)
+			node.Args[0].Accept(v)
+			return in, true
+		}
+		v.enterExpressionNode(node)
+		return in, true
+	case *ast.CaseExpr:
+		v.enterExpressionNode(node)
+		return in, true
+	case *ast.AggregateFuncExpr:
+		v.enterExpressionNode(node)
+		return in, true
+
 	}
 
 	return in, false
 }
 
-func (v *queryVisitor) enterColumnNameNode(node *ast.ColumnName) {
-	if v.inBinaryExpression {
-		// We're mid-where clause, so this is a column in an expression
-		// (e.g. where x='foo')
-		v.binaryExpression.FieldName = node.Name.L
-		v.completeWhereClause()
-	} else {
-		// Otherwise, this must be a column name (e.g. select X from )
-		v.resultingQuery.Columns = append(v.resultingQuery.Columns, node.Name.L)
+func (v *filterVisitor) enterColumnNameNode(node *ast.ColumnName) {
+	// A column on its own isn't a condition (e.g. "where name")
+	if !v.inBinaryExpression {
+		v.fail(fmt.Errorf("'%v' needs to be compared with something, e.g. %v = 'main'", columnName(node), columnName(node)))
+		return
 	}
-}
 
-func (v *queryVisitor) enterTableNameNode(node *ast.TableName) {
-	v.resultingQuery.SchemaName = node.Schema.L
-	v.resultingQuery.Table = node.Name.L
+	// A second column is what the first is compared with (e.g. where finishtime > queuetime)
+	if v.binaryExpression.FieldName != "" || v.binaryExpression.Expression != nil {
+		v.enterValueExpression(models.Expression{Type: "column", FieldName: columnName(node)})
+		return
+	}
+
+	// We're mid-where clause, so this is a column in an expression
+	// (e.g. where x='foo')
+	v.binaryExpression.FieldName = columnName(node)
+	v.completeWhereClause()
 }
 
-func (v *queryVisitor) enterLimitNode(node *ast.Limit) {
-	v.resultingQuery.Limit = int(node.Count.GetDatum().GetInt64())
+// The other side of a comparison when it uses columns too, e.g. "name = lower(folder)",
+// so it's worked out for each row rather than being a value
+func (v *filterVisitor) enterValueExpression(expression models.Expression) {
+	switch v.binaryExpression.Type {
+	case "in", "notin":
+		v.fail(fmt.Errorf("the values in an 'in' list can't use columns, use a subquery instead"))
+		return
+	case "like", "notlike":
+		if v.likeEscape != '\\' {
+			v.fail(fmt.Errorf("'escape' can only be used with a fixed pattern, e.g. name like '100!%%' escape '!'"))
+			return
+		}
+	}
+
+	v.binaryExpression.ValueExpression = &expression
+	v.seenValue = true
+	v.completeWhereClause()
 }
 
-func (v *queryVisitor) enterBinaryExpressionNode(node *ast.BinaryOperationExpr) {
+func (v *filterVisitor) enterBinaryExpressionNode(node *ast.BinaryOperationExpr) {
 
-	//  A normal node (e.g. x = 'foo' or x != 'foo')
-	if node.Op == opcode.EQ || node.Op == opcode.NE {
-		v.inBinaryExpression = true
-		v.binaryExpression = models.QueryFilter{Type: node.Op.String()}
+	//  A normal node (e.g. x = 'foo', x != 'foo' or x >= '2022-01-01')
+	if isComparison(node.Op) {
+		v.enterComparison(node.Op.String())
+		return
 	}
 
 	// A node that will nest other expressions (e.g 'A and B' or '(A or B) and C')
@@ -103,50 +840,354 @@ func (v *queryVisitor) enterBinaryExpressionNode(node *ast.BinaryOperationExpr)
 				Children: make([]models.QueryFilter, 0),
 			},
 		)
+		return
+	}
+
+	// e.g. 'xor' or '<=>'
+	v.fail(fmt.Errorf("the '%v' operator isn't supported", operatorText(node.Op)))
+}
+
+// 'not (...)' is read as the condition inside it, which is then negated, e.g.
+// "not (a = 1 or b like 'x%')" becomes "a != 1 and b not like 'x%'"
+func (v *filterVisitor) enterNotNode(node *ast.UnaryOperationExpr) {
+	if v.inBinaryExpression {
+		v.failNestedCondition()
+		return
+	}
+
+	filters, err := readFilters(node.V)
+	if err != nil {
+		v.fail(err)
+		return
+	}
+	if len(filters) == 0 {
+		v.fail(fmt.Errorf("'not' needs a condition, e.g. not (name = 'main')"))
+		return
 	}
+
+	v.addFilter(allOf(filters).Negated())
 }
 
-func (v *queryVisitor) enterLikeNode(node *ast.PatternLikeExpr) {
+// 'x between a and b' is read as 'x >= a and x <= b' (and 'not between' as 'x < a or x > b')
+func (v *filterVisitor) enterBetweenNode(node *ast.BetweenExpr) {
+	if v.inBinaryExpression {
+		v.failNestedCondition()
+		return
+	}
+
+	condition := &ast.BinaryOperationExpr{
+		Op: opcode.LogicAnd,
+		L:  &ast.BinaryOperationExpr{Op: opcode.GE, L: node.Expr, R: node.Left},
+		R:  &ast.BinaryOperationExpr{Op: opcode.LE, L: node.Expr, R: node.Right},
+	}
+	if node.Not {
+		condition = &ast.BinaryOperationExpr{
+			Op: opcode.LogicOr,
+			L:  &ast.BinaryOperationExpr{Op: opcode.LT, L: node.Expr, R: node.Left},
+			R:  &ast.BinaryOperationExpr{Op: opcode.GT, L: node.Expr, R: node.Right},
+		}
+	}
+	condition.Accept(v)
+}
+
+// Every value is text, and missing ones are empty, so 'x is null' is read as 'x = (empty text)'
+func (v *filterVisitor) enterIsNullNode(node *ast.IsNullExpr) {
+	if v.inBinaryExpression {
+		v.failNestedCondition()
+		return
+	}
+
+	opType := "eq"
+	if node.Not {
+		opType = "ne"
+	}
+
+	v.enterComparison(opType)
+	node.Expr.Accept(v)
+	v.enterValue("", "")
+}
+
+func (v *filterVisitor) enterComparison(opType string) {
+	if v.inBinaryExpression {
+		v.failNestedCondition()
+	}
+
+	v.inBinaryExpression = true
+	v.binaryExpression = models.QueryFilter{Type: opType}
+	v.seenValue = false
+}
+
+func (v *filterVisitor) enterLikeNode(node *ast.PatternLikeExpr) {
 
 	// We're entering a binary expression, but we'll get both sides
 	// as individual visits to other nodes later
-	v.inBinaryExpression = true
-	v.binaryExpression = models.QueryFilter{Type: "regex"}
+	opType := "like"
+	if node.Not {
+		opType = "notlike"
+	}
+
+	v.enterComparison(opType)
+	v.likeEscape = node.Escape
+}
+
+// 'regexp' and 'rlike' are read like 'like', but the pattern is a regular expression
+func (v *filterVisitor) enterRegexpNode(node *ast.PatternRegexpExpr) {
+	opType := "regex"
+	if node.Not {
+		opType = "notregex"
+	}
+
+	v.enterComparison(opType)
+}
+
+func (v *filterVisitor) enterInNode(node *ast.PatternInExpr) {
+
+	// As with 'like', we'll see the column and each item in the list
+	// as separate nodes. The expression is completed when we leave this node
+	opType := "in"
+	if node.Not {
+		opType = "notin"
+	}
+
+	v.enterComparison(opType)
+}
+
+// A subquery gives the list of values for 'in' (e.g. "id in (select ...)")
+func (v *filterVisitor) enterSubqueryNode(node *ast.SubqueryExpr) {
+	if !v.inBinaryExpression || (v.binaryExpression.Type != "in" && v.binaryExpression.Type != "notin") {
+		v.fail(fmt.Errorf("subqueries can only be used with 'in' or 'exists'"))
+		return
+	}
+
+	v.binaryExpression.Subquery = v.readSubquery(node)
+}
+
+// 'exists (select ...)' doesn't need a column, so it's complete straight away
+func (v *filterVisitor) enterExistsNode(node *ast.ExistsSubqueryExpr, not bool) {
+	subquery, isSubquery := node.Sel.(*ast.SubqueryExpr)
+	if !isSubquery {
+		v.fail(fmt.Errorf("'exists' needs a subquery"))
+		return
+	}
+
+	filterType := "exists"
+	if not {
+		filterType = "notexists"
+	}
+
+	v.addFilter(models.QueryFilter{Type: filterType, Subquery: v.readSubquery(subquery)})
 }
 
-func (v *queryVisitor) enterValueNode(node *ast.ValueExpr) {
+func (v *filterVisitor) readSubquery(node *ast.SubqueryExpr) *models.Query {
+	subquery, err := resultSetToQuery(node.Query)
+	if err != nil {
+		v.fail(err)
+		return nil
+	}
+	return &subquery
+}
 
-	// If we get a value and we're not in a expression
-	// then I have no idea what to do!
+// A condition on one side of a comparison, e.g. "(a = 1) = true"
+func (v *filterVisitor) failNestedCondition() {
+	v.fail(fmt.Errorf("conditions can't be compared with something, e.g. use 'a = 1' rather than '(a = 1) = true'"))
+}
+
+func (v *filterVisitor) fail(err error) {
+	if v.err == nil {
+		v.err = err
+	}
+}
+
+func (v *filterVisitor) enterCollation(collation string) {
 	if !v.inBinaryExpression {
+		v.fail(fmt.Errorf("'collate' and 'binary' can only be used in comparisons, e.g. where name collate utf8mb4_bin = 'Main'"))
 		return
 	}
+	v.binaryExpression.Collation = collation
+}
 
-	v.binaryExpression.Value = node.GetDatum().GetString()
+// A function, 'case' or arithmetic on one side of a comparison, e.g. "lower(name) = 'main'"
+func (v *filterVisitor) enterExpressionNode(node ast.ExprNode) {
+	if !v.inBinaryExpression {
+		v.fail(fmt.Errorf("functions in 'where' need to be compared with something, e.g. lower(name) = 'main'"))
+		return
+	}
 
-	// If we're in a 'like' then convert the wildcard string in to a regex
-	// by replacing % with .* to make something like /^.*foo.*$/
-	if v.binaryExpression.Type == "regex" {
-		var regex = strings.Replace(v.binaryExpression.Value, "%", ".*", -1)
-		v.binaryExpression.Value = "^" + regex + "$"
+	expression, err := readExpression(node, nil)
+	if err != nil {
+		v.fail(err)
+		return
+	}
+
+	// If it doesn't use any columns (e.g. 'date_sub(now(), interval 7 day)') it's the same
+	// for every row, so it's worked out now and used like any other value
+	if len(expression.FieldNames()) == 0 {
+		value := expression.Evaluate(nil)
+
+		// Arithmetic on numbers gives a number, e.g. '-1' or '60 * 60'
+		valueType := ""
+		switch node.(type) {
+		case *ast.BinaryOperationExpr, *ast.UnaryOperationExpr:
+			if _, err := strconv.ParseFloat(value, 64); err == nil {
+				valueType = models.NumberValue
+			}
+		}
+		v.enterValue(value, valueType)
+		return
+	}
+
+	if v.binaryExpression.FieldName != "" || v.binaryExpression.Expression != nil {
+		v.enterValueExpression(expression)
+		return
 	}
 
+	v.binaryExpression.Expression = &expression
 	v.completeWhereClause()
 }
 
-func (v *queryVisitor) completeWhereClause() {
+func (v *filterVisitor) enterValueNode(node *ast.ValueExpr) {
+	if node.Kind() == types.KindNull {
+		if v.inBinaryExpression {
+			v.fail(fmt.Errorf("comparisons with null are never true, use 'is null' instead, e.g. where folder is null"))
+			return
+		}
+		v.fail(fmt.Errorf("'null' needs to be compared with something, e.g. where folder is null"))
+		return
+	}
+
+	value, err := node.GetDatum().ToString()
+	if err != nil {
+		v.fail(err)
+		return
+	}
+
+	switch node.Kind() {
+	case types.KindInt64:
+		// 'true' and 'false' are read as 1 and 0
+		if mysql.HasIsBooleanFlag(node.Type.Flag) {
+			v.enterValue(strconv.FormatBool(node.GetInt64() != 0), models.BoolValue)
+			return
+		}
+		v.enterValue(value, models.NumberValue)
+	case types.KindUint64, types.KindFloat32, types.KindFloat64, types.KindMysqlDecimal:
+		v.enterValue(value, models.NumberValue)
+	default:
+		v.enterValue(value, "")
+	}
+}
+
+func (v *filterVisitor) enterValue(value string, valueType string) {
+
+	// A value on its own isn't a condition (e.g. "where 1" or "where true")
+	if !v.inBinaryExpression {
+		v.fail(fmt.Errorf("'%v' needs to be compared with something, e.g. where name = '%v'", value, value))
+		return
+	}
+
+	// Lists of values keep collecting until we leave the 'in' node
+	if v.binaryExpression.Type == "in" || v.binaryExpression.Type == "notin" {
+		// A list that mixes types (e.g. "in (1, 'one')") is compared as text
+		if len(v.binaryExpression.Values) == 0 || v.binaryExpression.ValueType == valueType {
+			v.binaryExpression.ValueType = valueType
+		} else {
+			v.binaryExpression.ValueType = ""
+		}
+		v.binaryExpression.Values = append(v.binaryExpression.Values, value)
+		return
+	}
+
+	v.binaryExpression.Value = value
+	v.seenValue = true
+
+	// If the value comes first (e.g. '2022-01-01' < x) then flip the comparison
+	// around, so it always reads as 'field <op> value'
+	if v.binaryExpression.FieldName == "" && v.binaryExpression.Expression == nil {
+		flipped, canFlip := flippedComparisons[v.binaryExpression.Type]
+		if !canFlip {
+			v.fail(fmt.Errorf("the column needs to come before 'like' or 'regexp', e.g. name like 'main%%'"))
+			return
+		}
+		v.binaryExpression.Type = flipped
+	}
+
+	// Patterns are always text
+	switch v.binaryExpression.Type {
+	case "like", "notlike":
+		v.binaryExpression.Value = withBackslashEscapes(value, v.likeEscape)
+	case "regex", "notregex":
+		if _, err := regexp.Compile(value); err != nil {
+			v.fail(fmt.Errorf("'%v' isn't a valid regular expression: %v", value, err))
+			return
+		}
+	default:
+		v.binaryExpression.ValueType = valueType
+	}
+
+	v.completeWhereClause()
+}
+
+func isComparison(op opcode.Op) bool {
+	return op == opcode.EQ || op == opcode.NE ||
+		op == opcode.GT || op == opcode.GE || op == opcode.LT || op == opcode.LE
+}
+
+// What each comparison becomes when the two sides are swapped over
+var flippedComparisons = map[string]string{
+	"eq": "eq",
+	"ne": "ne",
+	"gt": "lt",
+	"ge": "le",
+	"lt": "gt",
+	"le": "ge",
+}
+
+// Rewrites a 'like' pattern that uses another escape character (e.g. "like '50!%' escape '!'")
+// to use a backslash, so every pattern is matched the same way
+func withBackslashEscapes(pattern string, escape byte) string {
+	if escape == '\\' {
+		return pattern
+	}
+
+	var result strings.Builder
+	for index := 0; index < len(pattern); index++ {
+		switch {
+		case pattern[index] == escape && index+1 < len(pattern):
+			index++
+			// Only these need a backslash to match themselves
+			if pattern[index] == '%' || pattern[index] == '_' || pattern[index] == '\\' {
+				result.WriteByte('\\')
+			}
+			result.WriteByte(pattern[index])
+		case pattern[index] == '\\':
+			// Backslashes aren't special in this pattern
+			result.WriteString(`\\`)
+		default:
+			result.WriteByte(pattern[index])
+		}
+	}
+	return result.String()
+}
+
+func (v *filterVisitor) completeWhereClause() {
 
 	// If either side of the expression is empty, we haven't seen both
 	// nodes yet
-	if v.binaryExpression.FieldName == "" || v.binaryExpression.Value == "" {
+	if (v.binaryExpression.FieldName == "" && v.binaryExpression.Expression == nil) ||
+		(!v.seenValue && len(v.binaryExpression.Values) == 0 && v.binaryExpression.Subquery == nil) {
 		return
 	}
 
+	v.addFilter(v.binaryExpression)
+	v.inBinaryExpression = false
+}
+
+func (v *filterVisitor) addFilter(filter models.QueryFilter) {
+
 	// We're not in an AND/OR etc., so we can just add the condition to
 	// the list of filters
 	if len(v.binaryExpressionStack) == 0 {
 		// otherwise, add us to the normal filters
-		v.resultingQuery.Filters = append(v.resultingQuery.Filters, v.binaryExpression)
+		v.filters = append(v.filters, filter)
 	}
 
 	// We're in an AND/OR, so we need to add our expression to the item at the top of the stack
@@ -154,14 +1195,18 @@ func (v *queryVisitor) completeWhereClause() {
 	if len(v.binaryExpressionStack) > 0 {
 		v.binaryExpressionStack[len(v.binaryExpressionStack)-1].Children = append(
 			v.binaryExpressionStack[len(v.binaryExpressionStack)-1].Children,
-			v.binaryExpression,
+			filter,
 		)
 	}
-
-	v.inBinaryExpression = false
 }
 
-func (v *queryVisitor) Leave(in ast.Node) (ast.Node, bool) {
+func (v *filterVisitor) Leave(in ast.Node) (ast.Node, bool) {
+
+	// We've now seen everything in the 'in' list
+	if _, isIn := in.(*ast.PatternInExpr); isIn && v.inBinaryExpression {
+		v.completeWhereClause()
+		return in, true
+	}
 
 	binaryOp, isBinaryOperator := in.(*ast.BinaryOperationExpr)
 
@@ -194,7 +1239,7 @@ func (v *queryVisitor) Leave(in ast.Node) (ast.Node, bool) {
 	} else {
 		// This is the last item in the stack, so we're the outer expression
 		// .. add our filter to the top-level filter list
-		v.resultingQuery.Filters = append(v.resultingQuery.Filters, v.binaryExpressionStack[len(v.binaryExpressionStack)-1])
+		v.filters = append(v.filters, v.binaryExpressionStack[len(v.binaryExpressionStack)-1])
 	}
 
 	// Pop off the stack
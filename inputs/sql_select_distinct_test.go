@@ -0,0 +1,45 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistinct(t *testing.T) {
+
+	tests := []SqlTest{
+		{
+			"select distinct",
+			"select distinct folder from devops.pipelines",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "pipelines",
+				Columns:    []string{"folder"},
+				Distinct:   true,
+			},
+		},
+		{
+			"count distinct",
+			"select project, count(distinct requestedfor) from devops.builds group by project",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Columns:    []string{"project", "count(distinct requestedfor)"},
+				GroupBy:    []string{"project"},
+				Aggregates: []models.Aggregate{
+					{Function: "count", FieldName: "requestedfor", Distinct: true, Name: "count(distinct requestedfor)"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query: %v", err)
+		}
+		assert.Equal(t, test.result, r, "Query '"+test.name+"' failed")
+	}
+}
@@ -46,6 +46,28 @@ func TestSimpleSelects(t *testing.T) {
 				Limit:      10,
 			},
 		},
+		{
+			"select all from one table with limit and offset",
+			"select * from devops.builds limit 10 offset 20",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Columns:    []string(nil),
+				Limit:      10,
+				Offset:     20,
+			},
+		},
+		{
+			"select all from one table with the offset before the limit",
+			"select * from devops.builds limit 20, 10",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Columns:    []string(nil),
+				Limit:      10,
+				Offset:     20,
+			},
+		},
 	}
 
 	for _, test := range tests {
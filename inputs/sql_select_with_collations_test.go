@@ -0,0 +1,73 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollations(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		query   string
+		filters []models.QueryFilter
+	}{
+		{
+			"collate on the column",
+			"select * from devops.refs where name collate utf8mb4_bin = 'Main'",
+			[]models.QueryFilter{{Type: "eq", FieldName: "name", Value: "Main", Collation: models.CaseSensitive}},
+		},
+		{
+			"collate on the value",
+			"select * from devops.refs where name = 'it''s (Main)' COLLATE utf8mb4_general_ci",
+			[]models.QueryFilter{{Type: "eq", FieldName: "name", Value: "it's (Main)", Collation: models.CaseInsensitive}},
+		},
+		{
+			"collate on a function",
+			"select * from devops.refs where split_part(name, '/', 3) collate utf8mb4_bin in ('Main', 'Release')",
+			[]models.QueryFilter{{Type: "in", Values: []string{"Main", "Release"}, Collation: models.CaseSensitive, Expression: &models.Expression{
+				Type: "function", Function: "split_part", Arguments: []models.Expression{
+					{Type: "column", FieldName: "name"}, {Type: "value", Value: "/"}, {Type: "value", Value: "3"},
+				},
+			}}},
+		},
+		{
+			"binary",
+			"select * from devops.refs where binary name = 'Main' or name like binary 'Release%'",
+			[]models.QueryFilter{{Type: "or", Children: []models.QueryFilter{
+				{Type: "eq", FieldName: "name", Value: "Main", Collation: models.CaseSensitive},
+				{Type: "like", FieldName: "name", Value: "Release%", Collation: models.CaseSensitive},
+			}}},
+		},
+		{
+			"ilike",
+			"select * from devops.refs where r.name ILIKE 'main%' and creator = 'ilike'",
+			[]models.QueryFilter{{Type: "and", Children: []models.QueryFilter{
+				{Type: "like", FieldName: "r.name", Value: "main%", Collation: models.CaseInsensitive},
+				{Type: "eq", FieldName: "creator", Value: "ilike"},
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query '%v': %v", test.name, err)
+		}
+		assert.Equal(t, test.filters, r.Filters, "Query '"+test.name+"' failed")
+	}
+}
+
+func TestCollationErrors(t *testing.T) {
+
+	_, err := SqlToQuery("select * from devops.refs where name collate latin1_general = 'Main'")
+	assert.EqualError(t, err, "unknown collation 'latin1_general', use one that ends in _ci to ignore case (e.g. utf8mb4_general_ci) or _bin to match it exactly (e.g. utf8mb4_bin)")
+
+	_, err = SqlToQuery("select name collate utf8mb4_bin from devops.refs")
+	assert.EqualError(t, err, "'collate' and 'binary' can only be used in comparisons, e.g. where name collate utf8mb4_bin = 'Main'")
+
+	_, err = SqlToQuery("select * from devops.refs where collate utf8mb4_bin = 'Main'")
+	assert.EqualError(t, err, "'collate' needs to come after a column or value, e.g. name collate utf8mb4_bin = 'Main'")
+}
@@ -0,0 +1,88 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnComparisons(t *testing.T) {
+
+	queuetime := &models.Expression{Type: "column", FieldName: "queuetime"}
+
+	tests := []struct {
+		name    string
+		query   string
+		filters []models.QueryFilter
+	}{
+		{
+			"two columns",
+			"select * from devops.builds where finishtime > queuetime",
+			[]models.QueryFilter{{Type: "gt", FieldName: "finishtime", ValueExpression: queuetime}},
+		},
+		{
+			"a column and a function",
+			"select * from devops.builds where starttime < coalesce(finishtime, queuetime)",
+			[]models.QueryFilter{{Type: "lt", FieldName: "starttime", ValueExpression: &models.Expression{
+				Type: "function", Function: "coalesce", Arguments: []models.Expression{
+					{Type: "column", FieldName: "finishtime"},
+					{Type: "column", FieldName: "queuetime"},
+				},
+			}}},
+		},
+		{
+			"two functions",
+			"select * from devops.pipelines where lower(name) = lower(folder)",
+			[]models.QueryFilter{{
+				Type:            "eq",
+				Expression:      &models.Expression{Type: "function", Function: "lower", Arguments: []models.Expression{{Type: "column", FieldName: "name"}}},
+				ValueExpression: &models.Expression{Type: "function", Function: "lower", Arguments: []models.Expression{{Type: "column", FieldName: "folder"}}},
+			}},
+		},
+		{
+			"columns of joined tables",
+			"select b.id from devops.builds b join devops.pipelines p on b.definition = p.id where b.sourcebranch != p.name and b.result = 'failed'",
+			[]models.QueryFilter{{Type: "and", Children: []models.QueryFilter{
+				{Type: "ne", FieldName: "b.sourcebranch", ValueExpression: &models.Expression{Type: "column", FieldName: "p.name"}},
+				{Type: "eq", FieldName: "b.result", Value: "failed"},
+			}}},
+		},
+		{
+			"a column as the pattern",
+			"select * from devops.pipelines where name not like folder",
+			[]models.QueryFilter{{Type: "notlike", FieldName: "name", ValueExpression: &models.Expression{Type: "column", FieldName: "folder"}}},
+		},
+		{
+			"binary",
+			"select * from devops.pipelines where binary name = folder",
+			[]models.QueryFilter{{Type: "eq", FieldName: "name", ValueExpression: &models.Expression{Type: "column", FieldName: "folder"}, Collation: models.CaseSensitive}},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query '%v': %v", test.name, err)
+			continue
+		}
+		assert.Equal(t, test.filters, r.Filters, "Query '"+test.name+"' failed")
+	}
+}
+
+func TestColumnComparisonsInCaseAndJoins(t *testing.T) {
+
+	r, err := SqlToQuery("select case name when folder then 'same' end as x from devops.pipelines")
+	assert.Nil(t, err)
+	assert.Equal(t, []models.QueryFilter{{Type: "eq", FieldName: "name", ValueExpression: &models.Expression{Type: "column", FieldName: "folder"}}}, r.Expressions["x"].Conditions)
+
+	r, err = SqlToQuery("select b.id from devops.builds b join devops.builds n on b.definition = n.definition and n.queuetime > b.finishtime")
+	assert.Nil(t, err)
+	assert.Equal(t, []models.QueryFilter{{Type: "gt", FieldName: "n.queuetime", ValueExpression: &models.Expression{Type: "column", FieldName: "b.finishtime"}}}, r.Joins[0].Filters)
+}
+
+func TestColumnComparisonErrors(t *testing.T) {
+
+	_, err := SqlToQuery("select * from devops.pipelines where name like folder escape '!'")
+	assert.EqualError(t, err, "'escape' can only be used with a fixed pattern, e.g. name like '100!%' escape '!'")
+}
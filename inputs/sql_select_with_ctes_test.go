@@ -0,0 +1,95 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommonTableExpressions(t *testing.T) {
+
+	tests := []SqlTest{
+		{
+			"with",
+			"with recent as (select id, result from devops.builds where finishtime > '2022-01-01') select id from recent where result = 'failed'",
+			models.Query{
+				Table:   "recent",
+				Columns: []string{"id"},
+				Filters: []models.QueryFilter{{Type: "eq", FieldName: "result", Value: "failed"}},
+				With: []models.CommonTableExpression{{
+					Name: "recent",
+					Query: models.Query{
+						SchemaName: "devops",
+						Table:      "builds",
+						Columns:    []string{"id", "result"},
+						Filters:    []models.QueryFilter{{Type: "gt", FieldName: "finishtime", Value: "2022-01-01"}},
+					},
+				}},
+			},
+		},
+		{
+			"several, using each other, with brackets in strings",
+			"explain WITH Prod AS (select name from devops.pipelines where folder = 'prod (old)'), named as (select name from prod) select * from named",
+			models.Query{
+				Table:   "named",
+				Explain: true,
+				With: []models.CommonTableExpression{
+					{
+						Name: "prod",
+						Query: models.Query{
+							SchemaName: "devops",
+							Table:      "pipelines",
+							Columns:    []string{"name"},
+							Filters:    []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: "prod (old)"}},
+						},
+					},
+					{
+						Name:  "named",
+						Query: models.Query{Table: "prod", Columns: []string{"name"}},
+					},
+				},
+			},
+		},
+		{
+			"escaped quotes",
+			`with quoted as (select name from devops.pipelines where folder = 'it\'s) ' or folder = 'isn''t (') select name from quoted`,
+			models.Query{
+				Table:   "quoted",
+				Columns: []string{"name"},
+				With: []models.CommonTableExpression{{
+					Name: "quoted",
+					Query: models.Query{
+						SchemaName: "devops",
+						Table:      "pipelines",
+						Columns:    []string{"name"},
+						Filters: []models.QueryFilter{{Type: "or", Children: []models.QueryFilter{
+							{Type: "eq", FieldName: "folder", Value: "it's) "},
+							{Type: "eq", FieldName: "folder", Value: "isn't ("},
+						}}},
+					},
+				}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query: %v", err)
+		}
+		assert.Equal(t, test.result, r, "Query '"+test.name+"' failed")
+	}
+}
+
+func TestCommonTableExpressionErrors(t *testing.T) {
+
+	_, err := SqlToQuery("with recent (select * from devops.builds) select * from recent")
+	assert.EqualError(t, err, "each query in a 'with' clause needs to look like 'name as (select ...)'")
+
+	_, err = SqlToQuery("with recent as (select * from devops.builds select * from recent")
+	assert.EqualError(t, err, "a bracket in the 'with' clause isn't closed")
+
+	_, err = SqlToQuery("with a as (select * from devops.builds), a as (select * from devops.builds) select * from a")
+	assert.EqualError(t, err, "'a' is defined more than once in the 'with' clause")
+}
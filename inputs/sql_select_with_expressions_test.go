@@ -0,0 +1,76 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpressions(t *testing.T) {
+
+	tests := []SqlTest{
+		{
+			"aliases",
+			"select name as pipeline, id, count(*) as builds from devops.pipelines group by name, id order by builds",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "pipelines",
+				Columns:    []string{"pipeline", "id", "builds"},
+				Expressions: map[string]models.Expression{
+					"pipeline": {Type: "column", FieldName: "name"},
+					"builds":   {Type: "column", FieldName: "count(*)"},
+				},
+				GroupBy:    []string{"name", "id"},
+				Aggregates: []models.Aggregate{{Function: "count", Name: "count(*)"}},
+				OrderBy:    []models.OrderBy{{FieldName: "builds"}},
+			},
+		},
+		{
+			"arithmetic and functions",
+			"select id * 1, -(id + 2) / 4 as x, concat(project, '/', name) from devops.pipelines",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "pipelines",
+				Columns:    []string{"id * 1", "x", "concat(project, '/', name)"},
+				Expressions: map[string]models.Expression{
+					"id * 1": {Type: "operator", Operator: "*", Arguments: []models.Expression{
+						{Type: "column", FieldName: "id"},
+						{Type: "value", Value: "1"},
+					}},
+					"x": {Type: "operator", Operator: "/", Arguments: []models.Expression{
+						{Type: "operator", Operator: "-", Arguments: []models.Expression{
+							{Type: "operator", Operator: "+", Arguments: []models.Expression{
+								{Type: "column", FieldName: "id"},
+								{Type: "value", Value: "2"},
+							}},
+						}},
+						{Type: "value", Value: "4"},
+					}},
+					"concat(project, '/', name)": {Type: "function", Function: "concat", Arguments: []models.Expression{
+						{Type: "column", FieldName: "project"},
+						{Type: "value", Value: "/"},
+						{Type: "column", FieldName: "name"},
+					}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query: %v", err)
+		}
+		assert.Equal(t, test.result, r, "Query '"+test.name+"' failed")
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+
+	_, err := SqlToQuery("select nope(name) from devops.pipelines")
+	assert.EqualError(t, err, "unknown function 'nope'")
+
+	_, err = SqlToQuery("select name as x, id as x from devops.pipelines")
+	assert.EqualError(t, err, "there's more than one column called 'x', give one of them a different name with 'as'")
+}
@@ -0,0 +1,124 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFunctions(t *testing.T) {
+
+	lowerName := models.Expression{Type: "function", Function: "lower", Arguments: []models.Expression{{Type: "column", FieldName: "name"}}}
+
+	tests := []SqlTest{
+		{
+			"in 'where' and 'order by'",
+			"select name from devops.pipelines where lower(name) = 'deploy' and upper(folder) like 'PROD%' order by lower(name) desc",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "pipelines",
+				Columns:    []string{"name"},
+				Filters: []models.QueryFilter{{Type: "and", Children: []models.QueryFilter{
+					{Type: "eq", Value: "deploy", Expression: &lowerName},
+					{Type: "like", Value: "PROD%", Expression: &models.Expression{
+						Type: "function", Function: "upper", Arguments: []models.Expression{{Type: "column", FieldName: "folder"}},
+					}},
+				}}},
+				Expressions: map[string]models.Expression{"lower(name)": lowerName},
+				OrderBy:     []models.OrderBy{{FieldName: "lower(name)", Descending: true}},
+			},
+		},
+		{
+			"values worked out when the query is read",
+			"select id from devops.builds where finishtime > date_sub('2022-03-15', interval 7 day) and 'deploy' = lower(name)",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Columns:    []string{"id"},
+				Filters: []models.QueryFilter{{Type: "and", Children: []models.QueryFilter{
+					{Type: "gt", FieldName: "finishtime", Value: "2022-03-08T00:00:00Z"},
+					{Type: "eq", Value: "deploy", Expression: &lowerName},
+				}}},
+			},
+		},
+		{
+			"datediff, as in MySQL",
+			"select datediff(finishtime, queuetime) as days from devops.builds",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Columns:    []string{"days"},
+				Expressions: map[string]models.Expression{
+					"days": {Type: "function", Function: "datediff", Arguments: []models.Expression{
+						{Type: "column", FieldName: "finishtime"},
+						{Type: "column", FieldName: "queuetime"},
+					}},
+				},
+			},
+		},
+		{
+			"case",
+			"select case when result = 'failed' or result = 'canceled' then 'bad' else 'good' end as outcome, case result when 'failed' then 1 end from devops.builds",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Columns:    []string{"outcome", "case when result = 'failed' then 1 end"},
+				Expressions: map[string]models.Expression{
+					"outcome": {
+						Type: "case",
+						Conditions: []models.QueryFilter{{Type: "or", Children: []models.QueryFilter{
+							{Type: "eq", FieldName: "result", Value: "failed"},
+							{Type: "eq", FieldName: "result", Value: "canceled"},
+						}}},
+						Arguments: []models.Expression{{Type: "value", Value: "bad"}, {Type: "value", Value: "good"}},
+					},
+					"case when result = 'failed' then 1 end": {
+						Type:       "case",
+						Conditions: []models.QueryFilter{{Type: "eq", FieldName: "result", Value: "failed"}},
+						Arguments:  []models.Expression{{Type: "value", Value: "1"}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query: %v", err)
+		}
+		assert.Equal(t, test.result, r, "Query '"+test.name+"' failed")
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+
+	_, err := SqlToQuery("select split_part(name, '/') from devops.pipelines")
+	assert.EqualError(t, err, "'split_part' needs 3 arguments")
+
+	_, err = SqlToQuery("select name from devops.pipelines where count(*) > 1")
+	assert.EqualError(t, err, "aggregate functions can't be used in 'where', only in the selected columns and 'order by'")
+
+	_, err = SqlToQuery("select name from devops.pipelines where name in (folder, 'main')")
+	assert.EqualError(t, err, "the values in an 'in' list can't use columns, use a subquery instead")
+}
+
+func TestDateLiteralsAndIntervals(t *testing.T) {
+
+	r, err := SqlToQuery("select id, finishtime + interval 1 hour as due from devops.builds where finishtime >= date '2022-03-01' and finishtime < timestamp '2022-03-01 12:00:00' - interval '1' week")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.QueryFilter{{Type: "and", Children: []models.QueryFilter{
+		{Type: "ge", FieldName: "finishtime", Value: "2022-03-01T00:00:00Z"},
+		{Type: "lt", FieldName: "finishtime", Value: "2022-02-22T12:00:00Z"},
+	}}}, r.Filters)
+	assert.Equal(t, models.Expression{Type: "function", Function: "date_add", Arguments: []models.Expression{
+		{Type: "column", FieldName: "finishtime"},
+		{Type: "value", Value: "1"},
+		{Type: "value", Value: "HOUR"},
+	}}, r.Expressions["due"])
+
+	_, err = SqlToQuery("select date '2022-13-01' as d from devops.builds")
+	assert.EqualError(t, err, "date '2022-13-01' isn't a valid date")
+}
@@ -0,0 +1,81 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupAndOrder(t *testing.T) {
+
+	tests := []SqlTest{
+		{
+			"group by with aggregates",
+			"select result, count(*), avg(duration) from devops.builds group by result",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Columns:    []string{"result", "count(*)", "avg(duration)"},
+				GroupBy:    []string{"result"},
+				Aggregates: []models.Aggregate{
+					{Function: "count", Name: "count(*)"},
+					{Function: "avg", FieldName: "duration", Name: "avg(duration)"},
+				},
+			},
+		},
+		{
+			"order by",
+			"select name from devops.pipelines order by folder desc, name",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "pipelines",
+				Columns:    []string{"name"},
+				OrderBy: []models.OrderBy{
+					{FieldName: "folder", Descending: true},
+					{FieldName: "name"},
+				},
+			},
+		},
+		{
+			"order by an aggregate that isn't selected",
+			"select project from devops.pipelines group by project order by count(*) desc limit 3",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "pipelines",
+				Columns:    []string{"project"},
+				Limit:      3,
+				GroupBy:    []string{"project"},
+				Aggregates: []models.Aggregate{{Function: "count", Name: "count(*)"}},
+				OrderBy:    []models.OrderBy{{FieldName: "count(*)", Descending: true}},
+			},
+		},
+		{
+			"explain",
+			"explain select * from devops.builds",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Explain:    true,
+			},
+		},
+		{
+			"explain analyze",
+			"EXPLAIN ANALYZE select * from devops.builds",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Explain:    true,
+				Analyze:    true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query: %v", err)
+		}
+		assert.Equal(t, test.result, r, "Query '"+test.name+"' failed")
+	}
+}
@@ -0,0 +1,78 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoins(t *testing.T) {
+
+	tests := []SqlTest{
+		{
+			"inner join with aliases",
+			"select b.id, p.name from devops.builds b inner join devops.pipelines as p on p.id = b.pipelineid",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Alias:      "b",
+				Columns:    []string{"b.id", "p.name"},
+				Joins: []models.Join{
+					{
+						Type:       "inner",
+						SchemaName: "devops",
+						Table:      "pipelines",
+						Alias:      "p",
+						On:         []models.JoinCondition{{LeftField: "p.id", RightField: "b.pipelineid"}},
+					},
+				},
+			},
+		},
+		{
+			"left join with extra conditions",
+			"select * from devops.pipelines left join devops.builds on builds.pipelineid = pipelines.id and builds.result = 'failed'",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "pipelines",
+				Joins: []models.Join{
+					{
+						Type:       "left",
+						SchemaName: "devops",
+						Table:      "builds",
+						On:         []models.JoinCondition{{LeftField: "builds.pipelineid", RightField: "pipelines.id"}},
+						Filters:    []models.QueryFilter{{Type: "eq", FieldName: "builds.result", Value: "failed"}},
+					},
+				},
+			},
+		},
+		{
+			"more than one join",
+			"select * from devops.a join devops.b on a.x = b.x join devops.c on c.y = b.y where a.z = '1'",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "a",
+				Filters:    []models.QueryFilter{{Type: "eq", FieldName: "a.z", Value: "1"}},
+				Joins: []models.Join{
+					{Type: "inner", SchemaName: "devops", Table: "b", On: []models.JoinCondition{{LeftField: "a.x", RightField: "b.x"}}},
+					{Type: "inner", SchemaName: "devops", Table: "c", On: []models.JoinCondition{{LeftField: "c.y", RightField: "b.y"}}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query: %v", err)
+		}
+		assert.Equal(t, test.result, r, "Query '"+test.name+"' failed")
+	}
+}
+
+func TestRightJoinsAreNotSupported(t *testing.T) {
+
+	_, err := SqlToQuery("select * from devops.a right join devops.b on a.x = b.x")
+
+	assert.EqualError(t, err, "right joins aren't supported, swap the tables around and use a left join")
+}
@@ -0,0 +1,81 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiterals(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		query   string
+		filters []models.QueryFilter
+	}{
+		{
+			"a number",
+			"select * from devops.builds where id = 42",
+			[]models.QueryFilter{{Type: "eq", FieldName: "id", Value: "42", ValueType: models.NumberValue}},
+		},
+		{
+			"a decimal before the column",
+			"select * from devops.builds where 1.5 < duration",
+			[]models.QueryFilter{{Type: "gt", FieldName: "duration", Value: "1.5", ValueType: models.NumberValue}},
+		},
+		{
+			"a negative number",
+			"select * from devops.builds where priority > -1",
+			[]models.QueryFilter{{Type: "gt", FieldName: "priority", Value: "-1", ValueType: models.NumberValue}},
+		},
+		{
+			"a bool",
+			"select * from devops.branchpolicies where enabled = true and blocking != FALSE",
+			[]models.QueryFilter{{Type: "and", Children: []models.QueryFilter{
+				{Type: "eq", FieldName: "enabled", Value: "true", ValueType: models.BoolValue},
+				{Type: "ne", FieldName: "blocking", Value: "false", ValueType: models.BoolValue},
+			}}},
+		},
+		{
+			"a list of numbers",
+			"select * from devops.builds where id in (1, 2, 3)",
+			[]models.QueryFilter{{Type: "in", FieldName: "id", Values: []string{"1", "2", "3"}, ValueType: models.NumberValue}},
+		},
+		{
+			"a list of numbers and text",
+			"select * from devops.builds where id in (1, 'two')",
+			[]models.QueryFilter{{Type: "in", FieldName: "id", Values: []string{"1", "two"}}},
+		},
+		{
+			"empty text",
+			"select * from devops.pipelines where folder = ''",
+			[]models.QueryFilter{{Type: "eq", FieldName: "folder", Value: ""}},
+		},
+		{
+			"empty text before the column",
+			"select * from devops.pipelines where '' != folder",
+			[]models.QueryFilter{{Type: "ne", FieldName: "folder", Value: ""}},
+		},
+		{
+			"a number in a 'like'",
+			"select * from devops.builds where number like 2022",
+			[]models.QueryFilter{{Type: "like", FieldName: "number", Value: "2022"}},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query '%v': %v", test.name, err)
+			continue
+		}
+		assert.Equal(t, test.filters, r.Filters, "Query '"+test.name+"' failed")
+	}
+}
+
+func TestComparisonsWithNull(t *testing.T) {
+
+	_, err := SqlToQuery("select * from devops.pipelines where folder = null")
+	assert.EqualError(t, err, "comparisons with null are never true, use 'is null' instead, e.g. where folder is null")
+}
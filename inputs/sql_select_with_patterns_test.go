@@ -0,0 +1,76 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatterns(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		query   string
+		filters []models.QueryFilter
+	}{
+		{
+			"like with both wildcards",
+			"select * from devops.pipelines where name like 'deploy_%'",
+			[]models.QueryFilter{{Type: "like", FieldName: "name", Value: "deploy_%"}},
+		},
+		{
+			"not like",
+			"select * from devops.pipelines where name not like '%(test)'",
+			[]models.QueryFilter{{Type: "notlike", FieldName: "name", Value: "%(test)"}},
+		},
+		{
+			"like with backslash escapes",
+			`select * from devops.pipelines where name like 'deploy\_prod\%'`,
+			[]models.QueryFilter{{Type: "like", FieldName: "name", Value: `deploy\_prod\%`}},
+		},
+		{
+			"like with a folder",
+			`select * from devops.pipelines where folder like '\\prod%'`,
+			[]models.QueryFilter{{Type: "like", FieldName: "folder", Value: `\prod%`}},
+		},
+		{
+			"like with another escape character",
+			`select * from devops.pipelines where name like 'a!_b\\c!!' escape '!'`,
+			[]models.QueryFilter{{Type: "like", FieldName: "name", Value: `a\_b\\c!`}},
+		},
+		{
+			"regexp",
+			"select * from devops.pipelines where name regexp '^deploy-(dev|prod)$'",
+			[]models.QueryFilter{{Type: "regex", FieldName: "name", Value: "^deploy-(dev|prod)$"}},
+		},
+		{
+			"not rlike",
+			"select * from devops.pipelines where name not rlike 'test'",
+			[]models.QueryFilter{{Type: "notregex", FieldName: "name", Value: "test"}},
+		},
+		{
+			"regexp with binary",
+			"select * from devops.pipelines where binary name regexp '^Deploy'",
+			[]models.QueryFilter{{Type: "regex", FieldName: "name", Value: "^Deploy", Collation: models.CaseSensitive}},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query '%v': %v", test.name, err)
+			continue
+		}
+		assert.Equal(t, test.filters, r.Filters, "Query '"+test.name+"' failed")
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+
+	_, err := SqlToQuery("select * from devops.pipelines where 'deploy%' like name")
+	assert.EqualError(t, err, "the column needs to come before 'like' or 'regexp', e.g. name like 'main%'")
+
+	_, err = SqlToQuery("select * from devops.pipelines where name regexp '(deploy'")
+	assert.EqualError(t, err, "'(deploy' isn't a valid regular expression: error parsing regexp: missing closing ): `(deploy`")
+}
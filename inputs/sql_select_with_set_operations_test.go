@@ -0,0 +1,77 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetOperations(t *testing.T) {
+
+	tests := []SqlTest{
+		{
+			"union",
+			"select name from devops.repositories union select name from github.repositories",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "repositories",
+				Columns:    []string{"name"},
+				SetOperations: []models.SetOperation{
+					{Type: "union", Query: models.Query{SchemaName: "github", Table: "repositories", Columns: []string{"name"}}},
+				},
+			},
+		},
+		{
+			"several, with 'order by' and 'limit' for all of them",
+			"select name from a.t UNION ALL select name from b.t where x = 'union' intersect select name from c.t except select name from d.t where x in (select y from e.t union select y from f.t) order by name limit 5",
+			models.Query{
+				SchemaName: "a",
+				Table:      "t",
+				Columns:    []string{"name"},
+				OrderBy:    []models.OrderBy{{FieldName: "name"}},
+				Limit:      5,
+				SetOperations: []models.SetOperation{
+					{Type: "unionall", Query: models.Query{
+						SchemaName: "b", Table: "t", Columns: []string{"name"},
+						Filters: []models.QueryFilter{{Type: "eq", FieldName: "x", Value: "union"}},
+					}},
+					{Type: "intersect", Query: models.Query{SchemaName: "c", Table: "t", Columns: []string{"name"}}},
+					{Type: "except", Query: models.Query{
+						SchemaName: "d", Table: "t", Columns: []string{"name"},
+						Filters: []models.QueryFilter{{Type: "in", FieldName: "x", Subquery: &models.Query{
+							SchemaName: "e", Table: "t", Columns: []string{"y"},
+							SetOperations: []models.SetOperation{
+								{Type: "union", Query: models.Query{SchemaName: "f", Table: "t", Columns: []string{"y"}}},
+							},
+						}}},
+					}},
+				},
+			},
+		},
+		{
+			"escaped quotes",
+			`select name from devops.projects where name = 'it\'s' union select name from devops.projects where name = 'don''t union'`,
+			models.Query{
+				SchemaName: "devops",
+				Table:      "projects",
+				Columns:    []string{"name"},
+				Filters:    []models.QueryFilter{{Type: "eq", FieldName: "name", Value: "it's"}},
+				SetOperations: []models.SetOperation{
+					{Type: "union", Query: models.Query{
+						SchemaName: "devops", Table: "projects", Columns: []string{"name"},
+						Filters: []models.QueryFilter{{Type: "eq", FieldName: "name", Value: "don't union"}},
+					}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query: %v", err)
+		}
+		assert.Equal(t, test.result, r, "Query '"+test.name+"' failed")
+	}
+}
@@ -0,0 +1,80 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubqueries(t *testing.T) {
+
+	tests := []SqlTest{
+		{
+			"in a subquery",
+			"select id from devops.builds where pipelineid in (select id from devops.pipelines where folder = 'prod')",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Columns:    []string{"id"},
+				Filters: []models.QueryFilter{
+					{Type: "in", FieldName: "pipelineid", Subquery: &models.Query{
+						SchemaName: "devops",
+						Table:      "pipelines",
+						Columns:    []string{"id"},
+						Filters:    []models.QueryFilter{{Type: "eq", FieldName: "folder", Value: "prod"}},
+					}},
+				},
+			},
+		},
+		{
+			"exists and not exists",
+			"select name from devops.projects where result = 'failed' and not exists (select id from devops.pipelines) or exists (select id from devops.builds)",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "projects",
+				Columns:    []string{"name"},
+				Filters: []models.QueryFilter{
+					{Type: "or", Children: []models.QueryFilter{
+						{Type: "and", Children: []models.QueryFilter{
+							{Type: "eq", FieldName: "result", Value: "failed"},
+							{Type: "notexists", Subquery: &models.Query{SchemaName: "devops", Table: "pipelines", Columns: []string{"id"}}},
+						}},
+						{Type: "exists", Subquery: &models.Query{SchemaName: "devops", Table: "builds", Columns: []string{"id"}}},
+					}},
+				},
+			},
+		},
+		{
+			"subquery in from",
+			"select r.name from (select name from devops.repositories where project = 'a') r",
+			models.Query{
+				Alias: "r",
+				Subquery: &models.Query{
+					SchemaName: "devops",
+					Table:      "repositories",
+					Columns:    []string{"name"},
+					Filters:    []models.QueryFilter{{Type: "eq", FieldName: "project", Value: "a"}},
+				},
+				Columns: []string{"r.name"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query: %v", err)
+		}
+		assert.Equal(t, test.result, r, "Query '"+test.name+"' failed")
+	}
+}
+
+func TestSubqueryErrors(t *testing.T) {
+
+	_, err := SqlToQuery("select name from (select name from devops.repositories)")
+	assert.NotNil(t, err)
+
+	_, err = SqlToQuery("select name from devops.repositories where name = (select name from devops.projects)")
+	assert.EqualError(t, err, "subqueries can only be used with 'in' or 'exists'")
+}
@@ -0,0 +1,69 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhereComparison(t *testing.T) {
+
+	tests := []SqlTest{
+		{
+			"greater than or equal",
+			"select * from devops.builds where finishtime >= '2022-01-01'",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Filters: []models.QueryFilter{
+					{Type: "ge", FieldName: "finishtime", Value: "2022-01-01"},
+				},
+			},
+		},
+		{
+			"less than",
+			"select * from devops.builds where finishtime < '2022-01-01'",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Filters: []models.QueryFilter{
+					{Type: "lt", FieldName: "finishtime", Value: "2022-01-01"},
+				},
+			},
+		},
+		{
+			"value on the left flips the comparison",
+			"select * from devops.builds where '2022-01-01' > finishtime",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Filters: []models.QueryFilter{
+					{Type: "lt", FieldName: "finishtime", Value: "2022-01-01"},
+				},
+			},
+		},
+		{
+			"range",
+			"select * from devops.builds where finishtime > '2022-01-01' and finishtime <= '2022-02-01'",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Filters: []models.QueryFilter{
+					{Type: "and", Children: []models.QueryFilter{
+						{Type: "gt", FieldName: "finishtime", Value: "2022-01-01"},
+						{Type: "le", FieldName: "finishtime", Value: "2022-02-01"},
+					}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query: %v", err)
+		}
+		assert.Equal(t, test.result, r, "Query '"+test.name+"' failed")
+	}
+}
@@ -0,0 +1,67 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhereIn(t *testing.T) {
+
+	tests := []SqlTest{
+		{
+			"where in list",
+			"select * from devops.pipelines where project in ('foo', 'bar')",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "pipelines",
+				Columns:    []string(nil),
+				Limit:      0,
+				Filters: []models.QueryFilter{
+					{Type: "in", FieldName: "project", Values: []string{"foo", "bar"}},
+				},
+			},
+		},
+		{
+			"where not in list",
+			"select * from devops.pipelines where project not in ('foo', 'bar')",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "pipelines",
+				Columns:    []string(nil),
+				Limit:      0,
+				Filters: []models.QueryFilter{
+					{Type: "notin", FieldName: "project", Values: []string{"foo", "bar"}},
+				},
+			},
+		},
+		{
+			"where in list inside an AND",
+			"select * from devops.pipelines where project in ('foo', 'bar') and name = 'baz'",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "pipelines",
+				Columns:    []string(nil),
+				Limit:      0,
+				Filters: []models.QueryFilter{
+					{
+						Type: "and",
+						Children: []models.QueryFilter{
+							{Type: "in", FieldName: "project", Values: []string{"foo", "bar"}},
+							{Type: "eq", FieldName: "name", Value: "baz"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query: %v", err)
+		}
+		assert.Equal(t, test.result, r, "Query '"+test.name+"' failed")
+	}
+}
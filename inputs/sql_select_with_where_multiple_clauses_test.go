@@ -123,7 +123,7 @@ func TestWhereWithAnd(t *testing.T) {
 						Type: "and",
 						Children: []models.QueryFilter{
 							{Type: "eq", FieldName: "name", Value: "foo"},
-							{Type: "regex", FieldName: "colour", Value: "^red.*$"},
+							{Type: "like", FieldName: "colour", Value: "red%"},
 						},
 					},
 				},
@@ -0,0 +1,108 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotBetweenAndIsNull(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		query   string
+		filters []models.QueryFilter
+	}{
+		{
+			"not",
+			"select * from devops.builds where not (id = 1)",
+			[]models.QueryFilter{{Type: "ne", FieldName: "id", Value: "1", ValueType: models.NumberValue}},
+		},
+		{
+			"not of and/or",
+			"select * from devops.builds where not (result = 'failed' or (id > 1 and name like 'a%'))",
+			[]models.QueryFilter{{Type: "and", Children: []models.QueryFilter{
+				{Type: "ne", FieldName: "result", Value: "failed"},
+				{Type: "or", Children: []models.QueryFilter{
+					{Type: "le", FieldName: "id", Value: "1", ValueType: models.NumberValue},
+					{Type: "notlike", FieldName: "name", Value: "a%"},
+				}},
+			}}},
+		},
+		{
+			"not in an and",
+			"select * from devops.builds where project = 'a' and not id in (1, 2)",
+			[]models.QueryFilter{{Type: "and", Children: []models.QueryFilter{
+				{Type: "eq", FieldName: "project", Value: "a"},
+				{Type: "notin", FieldName: "id", Values: []string{"1", "2"}, ValueType: models.NumberValue},
+			}}},
+		},
+		{
+			"double negative",
+			"select * from devops.builds where not (name not regexp '^a')",
+			[]models.QueryFilter{{Type: "regex", FieldName: "name", Value: "^a"}},
+		},
+		{
+			"between",
+			"select * from devops.builds where id between 1 and 10",
+			[]models.QueryFilter{{Type: "and", Children: []models.QueryFilter{
+				{Type: "ge", FieldName: "id", Value: "1", ValueType: models.NumberValue},
+				{Type: "le", FieldName: "id", Value: "10", ValueType: models.NumberValue},
+			}}},
+		},
+		{
+			"not between",
+			"select * from devops.builds where finishtime not between '2022-01-01' and '2022-02-01'",
+			[]models.QueryFilter{{Type: "or", Children: []models.QueryFilter{
+				{Type: "lt", FieldName: "finishtime", Value: "2022-01-01"},
+				{Type: "gt", FieldName: "finishtime", Value: "2022-02-01"},
+			}}},
+		},
+		{
+			"is null",
+			"select * from devops.pipelines where folder is null",
+			[]models.QueryFilter{{Type: "eq", FieldName: "folder", Value: ""}},
+		},
+		{
+			"is not null",
+			"select * from devops.pipelines where project = 'a' and folder is not null",
+			[]models.QueryFilter{{Type: "and", Children: []models.QueryFilter{
+				{Type: "eq", FieldName: "project", Value: "a"},
+				{Type: "ne", FieldName: "folder", Value: ""},
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query '%v': %v", test.name, err)
+			continue
+		}
+		assert.Equal(t, test.filters, r.Filters, "Query '"+test.name+"' failed")
+	}
+}
+
+func TestConditionsThatCantBeReadAreErrors(t *testing.T) {
+
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"select * from devops.builds where name", "'name' needs to be compared with something, e.g. name = 'main'"},
+		{"select * from devops.builds where true", "'true' needs to be compared with something, e.g. where name = 'true'"},
+		{"select * from devops.builds where null", "'null' needs to be compared with something, e.g. where folder is null"},
+		{"select * from devops.builds where 'a' = 'a'", "conditions need to compare a column or function with something, e.g. name = 'main'"},
+		{"select * from devops.builds where (id = 1) = true", "conditions can't be compared with something, e.g. use 'a = 1' rather than '(a = 1) = true'"},
+		{"select * from devops.builds where id = 1 xor id = 2", "the '^' operator isn't supported"},
+		{"select * from devops.builds where name <=> 'a'", "the '<=>' operator isn't supported"},
+		{"select * from devops.builds where enabled is true", "'is true' and 'is false' aren't supported, use '= true' or '= false' instead"},
+		{"select * from devops.builds where (id, name) = (1, 'a')", "lists of columns (e.g. '(a, b) = (1, 2)') aren't supported"},
+	}
+
+	for _, test := range tests {
+		_, err := SqlToQuery(test.query)
+		assert.EqualError(t, err, test.err, test.query)
+	}
+}
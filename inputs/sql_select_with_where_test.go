@@ -58,7 +58,7 @@ func TestSimpleWhere(t *testing.T) {
 				Columns:    []string{"name", "age"},
 				Limit:      0,
 				Filters: []models.QueryFilter{
-					{Type: "regex", FieldName: "name", Value: "^foo.*$"},
+					{Type: "like", FieldName: "name", Value: "foo%"},
 				},
 			},
 		},
@@ -71,7 +71,7 @@ func TestSimpleWhere(t *testing.T) {
 				Columns:    []string{"name", "age"},
 				Limit:      0,
 				Filters: []models.QueryFilter{
-					{Type: "regex", FieldName: "name", Value: "^.*foo$"},
+					{Type: "like", FieldName: "name", Value: "%foo"},
 				},
 			},
 		},
@@ -84,7 +84,7 @@ func TestSimpleWhere(t *testing.T) {
 				Columns:    []string{"name", "age"},
 				Limit:      0,
 				Filters: []models.QueryFilter{
-					{Type: "regex", FieldName: "name", Value: "^.*foo.*$"},
+					{Type: "like", FieldName: "name", Value: "%foo%"},
 				},
 			},
 		},
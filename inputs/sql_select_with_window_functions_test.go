@@ -0,0 +1,114 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowFunctions(t *testing.T) {
+
+	tests := []SqlTest{
+		{
+			"ranking",
+			"select id, row_number() over (partition by pipeline, project order by finishtime desc, id) as n, rank() OVER(order by result) from devops.builds",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Columns:    []string{"id", "n", "rank() over (order by result)"},
+				Expressions: map[string]models.Expression{
+					"n": {Type: "column", FieldName: "row_number() over (partition by pipeline, project order by finishtime desc, id)"},
+				},
+				Windows: []models.WindowFunction{
+					{
+						Function:    "row_number",
+						PartitionBy: []string{"pipeline", "project"},
+						OrderBy:     []models.OrderBy{{FieldName: "finishtime", Descending: true}, {FieldName: "id"}},
+						Name:        "row_number() over (partition by pipeline, project order by finishtime desc, id)",
+					},
+					{
+						Function: "rank",
+						OrderBy:  []models.OrderBy{{FieldName: "result"}},
+						Name:     "rank() over (order by result)",
+					},
+				},
+			},
+		},
+		{
+			"lag, lead and running totals",
+			"select datediff('hour', lag(finishtime, 1, '') over (order by finishtime), finishtime) as gap, sum(duration) over (partition by pipeline) from devops.builds where result = 'succeeded' order by lead(id) over (order by id)",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Columns:    []string{"gap", "sum(duration) over (partition by pipeline)"},
+				Filters:    []models.QueryFilter{{Type: "eq", FieldName: "result", Value: "succeeded"}},
+				Expressions: map[string]models.Expression{
+					"gap": {Type: "function", Function: "datediff", Arguments: []models.Expression{
+						{Type: "value", Value: "hour"},
+						{Type: "column", FieldName: "lag(finishtime, 1, '') over (order by finishtime)"},
+						{Type: "column", FieldName: "finishtime"},
+					}},
+				},
+				Windows: []models.WindowFunction{
+					{Function: "lag", FieldName: "finishtime", Offset: 1, OrderBy: []models.OrderBy{{FieldName: "finishtime"}}, Name: "lag(finishtime, 1, '') over (order by finishtime)"},
+					{Function: "sum", FieldName: "duration", PartitionBy: []string{"pipeline"}, Name: "sum(duration) over (partition by pipeline)"},
+					{Function: "lead", FieldName: "id", Offset: 1, OrderBy: []models.OrderBy{{FieldName: "id"}}, Name: "lead(id) over (order by id)"},
+				},
+				OrderBy: []models.OrderBy{{FieldName: "lead(id) over (order by id)"}},
+			},
+		},
+		{
+			"'over' in quotes",
+			"select name from devops.pipelines where name = 'game over (again)'",
+			models.Query{
+				SchemaName: "devops",
+				Table:      "pipelines",
+				Columns:    []string{"name"},
+				Filters:    []models.QueryFilter{{Type: "eq", FieldName: "name", Value: "game over (again)"}},
+			},
+		},
+		{
+			"escaped quotes",
+			`select id, row_number() over (order by id) from devops.builds where name = 'it\'s over (' or name = 'isn''t over ('`,
+			models.Query{
+				SchemaName: "devops",
+				Table:      "builds",
+				Columns:    []string{"id", "row_number() over (order by id)"},
+				Filters: []models.QueryFilter{{Type: "or", Children: []models.QueryFilter{
+					{Type: "eq", FieldName: "name", Value: "it's over ("},
+					{Type: "eq", FieldName: "name", Value: "isn't over ("},
+				}}},
+				Windows: []models.WindowFunction{
+					{Function: "row_number", OrderBy: []models.OrderBy{{FieldName: "id"}}, Name: "row_number() over (order by id)"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := SqlToQuery(test.query)
+		if err != nil {
+			t.Errorf("Error parsing the query: %v", err)
+		}
+		assert.Equal(t, test.result, r, "Query '"+test.name+"' failed")
+	}
+}
+
+func TestWindowFunctionErrors(t *testing.T) {
+
+	_, err := SqlToQuery("select id from devops.builds where row_number() over (order by id) = 1")
+	assert.EqualError(t, err, "window functions can't be used in 'where', but their results can be filtered from a subquery, e.g. select * from (select ..., row_number() over (...) as n from ...) s where n = 1")
+
+	_, err = SqlToQuery("select ntile(4) over (order by id) from devops.builds")
+	assert.EqualError(t, err, "unknown window function 'ntile'")
+
+	_, err = SqlToQuery("select sum(duration) over (order by id rows between unbounded preceding and current row) from devops.builds")
+	assert.EqualError(t, err, "a window can only have 'partition by' and 'order by', e.g. over (partition by pipeline order by id)")
+
+	_, err = SqlToQuery("select id over (order by id) from devops.builds")
+	assert.EqualError(t, err, "'over' needs to come after a function, e.g. row_number() over (order by id)")
+
+	_, err = SqlToQuery("select lag(id, 'x') over (order by id) from devops.builds")
+	assert.EqualError(t, err, "how many rows 'lag' looks away needs to be a whole number")
+}
@@ -0,0 +1,263 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blastrain/vitess-sqlparser/tidbparser/ast"
+	"github.com/blastrain/vitess-sqlparser/tidbparser/parser"
+	"golang.org/x/exp/slices"
+)
+
+// The parser doesn't know about 'over', so each window function is swapped for a call
+// to this before the query is parsed, with the function and its window as text
+const windowFunctionPlaceholder = "window_function"
+
+var overPattern = regexp.MustCompile(`(?i)^over\s*\(`)
+
+// Swaps "rank() over (partition by a order by b)" for "window_function('rank()', 'partition by a order by b')"
+func replaceWindowFunctions(query string) (string, error) {
+	for {
+		window, found, err := findWindowFunction(query)
+		if err != nil || !found {
+			return query, err
+		}
+
+		placeholder := windowFunctionPlaceholder + "(" + quoted(window.call) + ", " + quoted(window.over) + ")"
+		query = query[:window.start] + placeholder + query[window.end+1:]
+	}
+}
+
+// Where a window function is in the query
+type windowText struct {
+	start int    // The start of the function's name
+	end   int    // The bracket that closes the window
+	call  string // e.g. 'rank()'
+	over  string // What's in the brackets after 'over'
+}
+
+// Finds the first 'over' that isn't in quotes, and the function before it
+func findWindowFunction(query string) (windowText, bool, error) {
+	scanner := newQueryScanner(query)
+
+	for scanner.next() {
+		if !scanner.atWordStart() || !overPattern.MatchString(scanner.rest()) {
+			continue
+		}
+		index := scanner.position
+
+		// 'over' comes straight after the function's closing bracket
+		callEnd := len(strings.TrimRight(query[:index], " \t\r\n")) - 1
+		callStart, isCall := scanner.openedAt[callEnd]
+		for isCall && callStart > 0 && isWordCharacter(query[callStart-1]) {
+			callStart--
+		}
+		if !isCall || callStart == scanner.openedAt[callEnd] {
+			return windowText{}, false, fmt.Errorf("'over' needs to come after a function, e.g. row_number() over (order by id)")
+		}
+
+		overStart := index + len(overPattern.FindString(query[index:])) - 1
+		overEnd, closed := closingBracket(query, overStart)
+		if !closed {
+			return windowText{}, false, fmt.Errorf("the bracket after 'over' isn't closed")
+		}
+
+		return windowText{
+			start: callStart,
+			end:   overEnd,
+			call:  query[callStart : callEnd+1],
+			over:  query[overStart+1 : overEnd],
+		}, true, nil
+	}
+
+	return windowText{}, false, nil
+}
+
+// Writes the text as a quoted string that the parser will read back the same
+func quoted(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+}
+
+// Reads one of the placeholders for a window function. The window is added to the
+// query, and the expression uses its result
+func readWindowPlaceholder(node *ast.FuncCallExpr, result *models.Query) (models.Expression, error) {
+	if result == nil {
+		return models.Expression{}, fmt.Errorf("window functions can't be used in 'where', but their results can be filtered from a subquery, e.g. select * from (select ..., row_number() over (...) as n from ...) s where n = 1")
+	}
+
+	var text []string
+	for _, arg := range node.Args {
+		value, _ := arg.(*ast.ValueExpr).GetDatum().ToString()
+		text = append(text, value)
+	}
+
+	window, err := readWindowFunction(text[0], text[1])
+	if err != nil {
+		return models.Expression{}, err
+	}
+
+	if !windowIsUsed(result.Windows, window.Name) {
+		result.Windows = append(result.Windows, window)
+	}
+	return models.Expression{Type: "column", FieldName: window.Name}, nil
+}
+
+func windowIsUsed(windows []models.WindowFunction, name string) bool {
+	for _, window := range windows {
+		if window.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// The functions that only look at the row's place in the window
+var rankingFunctions = []string{"row_number", "rank", "dense_rank"}
+
+// Reads the function (e.g. 'lag(finishtime)') and window (e.g. 'partition by pipeline
+// order by id') of a window function, by parsing them as parts of a select
+func readWindowFunction(call string, over string) (models.WindowFunction, error) {
+	result := models.WindowFunction{}
+
+	stmt, err := parseSelect("select " + call + " from t")
+	if err != nil {
+		return result, fmt.Errorf("couldn't read the window function '%v'", call)
+	}
+
+	switch expr := stmt.Fields.Fields[0].Expr.(type) {
+
+	case *ast.AggregateFuncExpr:
+		aggregate, err := readAggregate(expr)
+		if err != nil {
+			return result, err
+		}
+		if aggregate.Distinct {
+			return result, fmt.Errorf("'distinct' can't be used in window functions")
+		}
+		result.Function = aggregate.Function
+		result.FieldName = aggregate.FieldName
+		call = aggregate.Name
+
+	case *ast.FuncCallExpr:
+		result.Function = expr.FnName.L
+		call, err = readWindowCall(expr, &result)
+		if err != nil {
+			return result, err
+		}
+
+	default:
+		return result, fmt.Errorf("couldn't read the window function '%v'", call)
+	}
+
+	// The window reads the same as a 'group by' and 'order by', so it's parsed as them
+	stmt, err = parseSelect("select 1 from t " + partitionByPattern.ReplaceAllString(over, "group by "))
+	if err != nil {
+		return result, fmt.Errorf("a window can only have 'partition by' and 'order by', e.g. over (partition by pipeline order by id)")
+	}
+
+	var window []string
+	if stmt.GroupBy != nil {
+		for _, item := range stmt.GroupBy.Items {
+			column, isColumn := item.Expr.(*ast.ColumnNameExpr)
+			if !isColumn {
+				return result, fmt.Errorf("only columns can be used in 'partition by'")
+			}
+			result.PartitionBy = append(result.PartitionBy, columnName(column.Name))
+		}
+		window = append(window, "partition by "+strings.Join(result.PartitionBy, ", "))
+	}
+
+	if stmt.OrderBy != nil {
+		var columns []string
+		for _, item := range stmt.OrderBy.Items {
+			column, isColumn := item.Expr.(*ast.ColumnNameExpr)
+			if !isColumn {
+				return result, fmt.Errorf("only columns can be used in the 'order by' of a window")
+			}
+			orderBy := models.OrderBy{FieldName: columnName(column.Name), Descending: item.Desc}
+			result.OrderBy = append(result.OrderBy, orderBy)
+
+			if orderBy.Descending {
+				columns = append(columns, orderBy.FieldName+" desc")
+			} else {
+				columns = append(columns, orderBy.FieldName)
+			}
+		}
+		window = append(window, "order by "+strings.Join(columns, ", "))
+	}
+
+	result.Name = call + " over (" + strings.Join(window, " ") + ")"
+	return result, nil
+}
+
+var partitionByPattern = regexp.MustCompile(`(?i)^\s*partition\s+by\s`)
+
+// Reads the functions that aren't aggregates, and returns how they're written
+func readWindowCall(expr *ast.FuncCallExpr, result *models.WindowFunction) (string, error) {
+	function := result.Function
+
+	if slices.Contains(rankingFunctions, function) {
+		if len(expr.Args) > 0 {
+			return "", fmt.Errorf("'%v' doesn't take any arguments", function)
+		}
+		return function + "()", nil
+	}
+
+	if function != "lag" && function != "lead" {
+		return "", fmt.Errorf("unknown window function '%v'", function)
+	}
+
+	if len(expr.Args) == 0 || len(expr.Args) > 3 {
+		return "", fmt.Errorf("'%v' needs a column, and optionally how many rows away to look and a default, e.g. %v(finishtime, 1, '')", function, function)
+	}
+	column, isColumn := expr.Args[0].(*ast.ColumnNameExpr)
+	if !isColumn {
+		return "", fmt.Errorf("'%v' needs a column, e.g. %v(finishtime)", function, function)
+	}
+	result.FieldName = columnName(column.Name)
+	result.Offset = 1
+	arguments := []string{result.FieldName}
+
+	if len(expr.Args) > 1 {
+		value, isValue := expr.Args[1].(*ast.ValueExpr)
+		offset := -1
+		if isValue {
+			text, _ := value.GetDatum().ToString()
+			if number, err := strconv.Atoi(text); err == nil {
+				offset = number
+			}
+		}
+		if offset < 0 {
+			return "", fmt.Errorf("how many rows '%v' looks away needs to be a whole number", function)
+		}
+		result.Offset = offset
+		arguments = append(arguments, strconv.Itoa(offset))
+	}
+
+	if len(expr.Args) > 2 {
+		value, isValue := expr.Args[2].(*ast.ValueExpr)
+		if !isValue {
+			return "", fmt.Errorf("the default for '%v' needs to be a value", function)
+		}
+		result.Default, _ = value.GetDatum().ToString()
+		arguments = append(arguments, models.Expression{Type: "value", Value: result.Default}.String())
+	}
+
+	return function + "(" + strings.Join(arguments, ", ") + ")", nil
+}
+
+func parseSelect(query string) (*ast.SelectStmt, error) {
+	stmtNodes, err := parser.New().Parse(query, "", "")
+	if err != nil {
+		return nil, err
+	}
+	stmt, isSelect := stmtNodes[0].(*ast.SelectStmt)
+	if !isSelect {
+		return nil, fmt.Errorf("only select statements are supported")
+	}
+	return stmt, nil
+}
@@ -0,0 +1,66 @@
+package inputs
+
+import (
+	"devopsdb/models"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The parser doesn't know about 'with' clauses, so we read them ourselves and leave the
+// rest of the query (with any 'explain' in front of it) for the parser
+var withPattern = regexp.MustCompile(`(?i)^(\s*explain(\s+analyze)?)?\s*with\s`)
+
+// The start of each query in a 'with' clause, e.g. 'recent as ('
+var commonTableExpressionPattern = regexp.MustCompile(`(?i)^\s*([a-z_][a-z0-9_]*)\s+as\s*\(`)
+
+// Splits 'with a as (select ...), b as (select ...) select ...' in to the named queries
+// and the query that uses them. Queries without a 'with' are returned as they are
+func readWith(query string) (string, []models.CommonTableExpression, error) {
+	match := withPattern.FindStringSubmatchIndex(query)
+	if match == nil {
+		return query, nil, nil
+	}
+
+	prefix := ""
+	if match[2] >= 0 {
+		prefix = query[match[2]:match[3]] + " "
+	}
+	rest := query[match[1]:]
+
+	var expressions []models.CommonTableExpression
+	for {
+		nameMatch := commonTableExpressionPattern.FindStringSubmatchIndex(rest)
+		if nameMatch == nil {
+			return "", nil, fmt.Errorf("each query in a 'with' clause needs to look like 'name as (select ...)'")
+		}
+		name := strings.ToLower(rest[nameMatch[2]:nameMatch[3]])
+
+		// The opening bracket is the last thing we matched
+		end, found := closingBracket(rest, nameMatch[1]-1)
+		if !found {
+			return "", nil, fmt.Errorf("a bracket in the 'with' clause isn't closed")
+		}
+
+		subquery, err := statementToQuery(rest[nameMatch[1]:end])
+		if err != nil {
+			return "", nil, fmt.Errorf("in '%v': %v", name, err)
+		}
+		if subquery.Explain {
+			return "", nil, fmt.Errorf("in '%v': only select statements can be used in a 'with' clause", name)
+		}
+
+		for _, existing := range expressions {
+			if existing.Name == name {
+				return "", nil, fmt.Errorf("'%v' is defined more than once in the 'with' clause", name)
+			}
+		}
+		expressions = append(expressions, models.CommonTableExpression{Name: name, Query: subquery})
+
+		rest = strings.TrimSpace(rest[end+1:])
+		if !strings.HasPrefix(rest, ",") {
+			return prefix + rest, expressions, nil
+		}
+		rest = rest[1:]
+	}
+}
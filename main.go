@@ -2,13 +2,21 @@ package main
 
 import (
 	"bufio"
+	"devopsdb/config"
 	"devopsdb/connectors"
 	"devopsdb/engine"
 	"devopsdb/inputs"
+	"devopsdb/middleware"
+	"devopsdb/mirror"
+	"devopsdb/models"
+	"devopsdb/outputs"
+	"flag"
 	"fmt"
-	"math"
+	"io"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
 // This is a test bed for the real implementation
@@ -16,122 +24,180 @@ import (
 // in favour of a proper command-line interface
 func main() {
 
-	// Init the whole thing
-	engine := engine.New()
-	engine.AddConnector(
-		"devops",
-		connectors.CreateDevopsClient(
-			"",
-			"",
-		),
-	)
+	configPath := flag.String("config", "devopsdb.json", "The config file that describes the connectors")
+	noCache := flag.Bool("no-cache", false, "Always call the connectors, rather than using cached results")
+	source := flag.String("source", "live", "Where queries read from: 'live' (the connectors) or 'mirror' (the tables copied by 'sync')")
+	flag.Parse()
 
-	fmt.Println("Enter your query:")
+	settings, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Println("Error while reading config.", err)
+		return
+	}
 
-	reader := bufio.NewReader(os.Stdin)
-	// ReadString will block until the delimiter is entered
-	input, err := reader.ReadString('\n')
+	models.TimeZone, err = settings.Location()
 	if err != nil {
-		fmt.Println("Error while reading query.", err)
+		fmt.Println("Error while reading config.", err)
 		return
 	}
 
-	// remove the delimeter from the string
-	input = strings.TrimSuffix(input, "\n")
+	// The DevOps SDK creates its own http.Client for each connection without a way to
+	// pass in a transport, and those clients use the default one, so that's where the
+	// rate limiting and retries have to go
+	http.DefaultTransport = middleware.New(http.DefaultTransport, httpOptions(settings.Http))
 
-	query, _ := inputs.SqlToQuery(input)
+	mirrorDir := settings.Mirror.Dir
+	if mirrorDir == "" {
+		mirrorDir = ".devopsdb"
+	}
+	store := mirror.NewStore(mirrorDir)
+
+	// 'devopsdb sync' updates the mirror, rather than running queries
+	if flag.Arg(0) == "sync" {
+		// Always read fresh data when syncing
+		engine, err := liveEngine(settings, false)
+		if err != nil {
+			fmt.Println("Error while setting up connectors.", err)
+			return
+		}
+		syncMirror(engine, store, settings.Mirror)
+		return
+	}
 
-	result := engine.Execute(query)
+	// Init the whole thing
+	var engine *engine.QueryEngine
+	switch *source {
+	case "live":
+		engine, err = liveEngine(settings, !*noCache)
+	case "mirror":
+		engine = mirrorEngine(settings, store)
+	default:
+		err = fmt.Errorf("unknown source '%v', use 'live' or 'mirror'", *source)
+	}
+	if err != nil {
+		fmt.Println("Error while setting up connectors.", err)
+		return
+	}
 
-	if len(result.Results) == 0 {
-		fmt.Print("No results")
-		os.Exit(0)
+	// Keep asking for queries, so running the same one again can use the cache
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Println("Enter your query:")
+
+		// ReadString will block until the delimiter is entered
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				fmt.Println("Error while reading query.", err)
+			}
+			return
+		}
+
+		// remove the delimeter from the string
+		input = strings.TrimSuffix(input, "\n")
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+
+		runQuery(engine, input)
 	}
+}
 
-	fmt.Println()
-	fmt.Printf("%v results:\n", len(result.Results))
-	fmt.Println()
+// An engine that calls the real APIs
+func liveEngine(settings *config.Config, useCache bool) (*engine.QueryEngine, error) {
+	result := engine.New()
+	for _, connector := range settings.Connectors {
+		if connector.Type != "devops" {
+			return nil, fmt.Errorf("unknown connector type '%v' for schema '%v'", connector.Type, connector.Schema)
+		}
 
-	// Get column sizes
-	columnSizes := make(map[string]int)
+		var client connectors.Connector = connectors.CreateDevopsClient(
+			connector.Url,
+			connector.Pat,
+		)
+		if useCache {
+			client = connectors.NewCachingConnector(client, connector.CacheTtls())
+		}
 
-	for _, item := range result.Results {
-		for column, _ := range item {
-			if columnSizes[column] == 0 || columnSizes[column] < len(item[column]) {
-				columnSizes[column] = len(item[column])
-			}
+		result.AddConnector(connector.Schema, client)
+		result.SetConcurrency(connector.Schema, connector.Concurrency)
+		for table, columns := range connector.CaseSensitive {
+			result.SetCaseSensitive(connector.Schema, table, columns)
 		}
 	}
+	return result, nil
+}
 
-	totalLength := 0
-	for _, size := range columnSizes {
-		totalLength += size
+// An engine that reads the tables copied to disk by 'sync'
+func mirrorEngine(settings *config.Config, store *mirror.Store) *engine.QueryEngine {
+	result := engine.New()
+	for _, connector := range settings.Connectors {
+		result.AddConnector(connector.Schema, mirror.NewConnector(store, connector.Schema))
+		for table, columns := range connector.CaseSensitive {
+			result.SetCaseSensitive(connector.Schema, table, columns)
+		}
 	}
+	return result
+}
 
-	// Print column headers
-	fmt.Print("| ")
-	for _, column := range result.Columns {
-		fmt.Print(StrPad(column, columnSizes[column], " ", "RIGHT"))
-		fmt.Print(" | ")
+func syncMirror(engine *engine.QueryEngine, store *mirror.Store, settings config.MirrorConfig) {
+	if len(settings.Tables) == 0 {
+		fmt.Println("There are no tables to sync, add them to 'mirror.tables' in the config file")
+		return
 	}
 
-	fmt.Println()
-	// Underline
-	fmt.Print("|-")
-	for _, column := range result.Columns {
-		fmt.Print(StrPad("-", columnSizes[column], "-", "RIGHT"))
-		fmt.Print("-| ")
+	for _, table := range settings.Tables {
+		schema, name, found := strings.Cut(table.Table, ".")
+		if !found {
+			fmt.Printf("Mirror table '%v' should be written as 'schema.table'\n", table.Table)
+			continue
+		}
+
+		result, err := mirror.Sync(engine, store, mirror.TableConfig{
+			Schema:     schema,
+			Table:      name,
+			DateColumn: table.DateColumn,
+			KeyColumn:  table.KeyColumn,
+			Days:       table.Days,
+		}, time.Now())
+		if err != nil {
+			fmt.Printf("Error while syncing '%v'. %v\n", table.Table, err)
+			continue
+		}
+
+		fmt.Printf("Synced '%v': fetched %v rows, %v rows in the mirror, up to %v\n", table.Table, result.Fetched, result.Total, result.Watermark)
 	}
-	fmt.Println()
+}
 
-	// Values
-	for _, item := range result.Results {
-		fmt.Print("| ")
+func runQuery(engine *engine.QueryEngine, input string) {
+	query, err := inputs.SqlToQuery(input)
+	if err != nil {
+		fmt.Println("Error while reading query.", err)
+		return
+	}
 
-		for _, column := range result.Columns {
-			val := item[column]
-			fmt.Print(StrPad(val, columnSizes[column], " ", "RIGHT"))
-			fmt.Print(" | ")
-		}
-		fmt.Println()
+	result, err := engine.Execute(query)
+	if err != nil {
+		fmt.Println("Error while running query.", err)
+		return
 	}
 
-	fmt.Println()
+	err = outputs.NewTableWriter(os.Stdout).Write(result)
+	if err != nil {
+		fmt.Println("Error while reading results.", err)
+	}
 }
 
-// StrPad returns the input string padded on the left, right or both sides using padType to the specified padding length padLength.
-//
-// Example:
-// input := "Codes";
-// StrPad(input, 10, " ", "RIGHT")        // produces "Codes     "
-// StrPad(input, 10, "-=", "LEFT")        // produces "=-=-=Codes"
-// StrPad(input, 10, "_", "BOTH")         // produces "__Codes___"
-// StrPad(input, 6, "___", "RIGHT")       // produces "Codes_"
-// StrPad(input, 3, "*", "RIGHT")         // produces "Codes"
-func StrPad(input string, padLength int, padString string, padType string) string {
-	var output string
-
-	inputLength := len(input)
-	padStringLength := len(padString)
-
-	if inputLength >= padLength {
-		return input
-	}
-
-	repeat := math.Ceil(float64(1) + (float64(padLength-padStringLength))/float64(padStringLength))
-
-	switch padType {
-	case "RIGHT":
-		output = input + strings.Repeat(padString, int(repeat))
-		output = output[:padLength]
-	case "LEFT":
-		output = strings.Repeat(padString, int(repeat)) + input
-		output = output[len(output)-padLength:]
-	case "BOTH":
-		length := (float64(padLength - inputLength)) / float64(2)
-		repeat = math.Ceil(length / float64(padStringLength))
-		output = strings.Repeat(padString, int(repeat))[:int(math.Floor(float64(length)))] + input + strings.Repeat(padString, int(repeat))[:int(math.Ceil(float64(length)))]
-	}
-
-	return output
+func httpOptions(settings config.HttpConfig) middleware.Options {
+	options := middleware.DefaultOptions()
+	if settings.RequestsPerSecond > 0 {
+		options.RequestsPerSecond = settings.RequestsPerSecond
+	}
+	if settings.Burst > 0 {
+		options.Burst = settings.Burst
+	}
+	if settings.MaxRetries > 0 {
+		options.MaxRetries = settings.MaxRetries
+	}
+	return options
 }
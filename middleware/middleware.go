@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Options controls how the connectors' HTTP calls are throttled and retried
+type Options struct {
+	// The steady rate of requests allowed to each host, and how many can be made in a
+	// burst above that. A rate of zero means requests aren't rate limited
+	RequestsPerSecond float64
+	Burst             int
+
+	// How many times a failed idempotent request is retried, and the delays used for the
+	// exponential backoff between attempts (before jitter is added)
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		RequestsPerSecond: 10,
+		Burst:             20,
+		MaxRetries:        5,
+		BaseDelay:         500 * time.Millisecond,
+		MaxDelay:          30 * time.Second,
+	}
+}
+
+// New wraps a transport so that every request made through it is rate limited per host,
+// and retried with backoff if it fails in a way that's worth retrying (throttling,
+// server errors or network errors). Requests made with a context from WithStats are
+// counted
+func New(next http.RoundTripper, options Options) http.RoundTripper {
+	limiter := newRateLimiter(options.RequestsPerSecond, options.Burst)
+
+	return &retryTransport{
+		next:    &rateLimitedTransport{next: &statsTransport{next: next}, limiter: limiter},
+		limiter: limiter,
+		options: options,
+		sleep:   sleep,
+	}
+}
+
+// Waits for the duration, or until the context is cancelled
+func sleep(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
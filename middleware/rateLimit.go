@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type rateLimitedTransport struct {
+	next    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *rateLimitedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	err := t.limiter.wait(request.Context(), request.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(request)
+}
+
+// rateLimiter keeps a token bucket for each host, so being throttled by one API
+// doesn't slow down calls to another
+type rateLimiter struct {
+	requestsPerSecond float64
+	burst             float64
+
+	lock    sync.Mutex
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+	sleep   func(ctx context.Context, duration time.Duration) error
+}
+
+type tokenBucket struct {
+	tokens      float64
+	lastRefill  time.Time
+	pausedUntil time.Time
+}
+
+func newRateLimiter(requestsPerSecond float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		requestsPerSecond: requestsPerSecond,
+		burst:             float64(burst),
+		buckets:           make(map[string]*tokenBucket),
+		now:               time.Now,
+		sleep:             sleep,
+	}
+}
+
+// Waits until a request to the host is allowed
+func (l *rateLimiter) wait(ctx context.Context, host string) error {
+	return l.sleep(ctx, l.reserve(host))
+}
+
+// Takes a token from the host's bucket, and returns how long the caller needs to wait
+// before it can be used. Tokens can be borrowed from the future, so each caller waits
+// in turn rather than all of them waking up at once
+func (l *rateLimiter) reserve(host string) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	bucket := l.bucketFor(host, now)
+
+	delay := time.Duration(0)
+
+	if l.requestsPerSecond > 0 {
+		elapsed := now.Sub(bucket.lastRefill).Seconds()
+		bucket.tokens = minFloat(l.burst, bucket.tokens+elapsed*l.requestsPerSecond)
+		bucket.lastRefill = now
+
+		bucket.tokens--
+		if bucket.tokens < 0 {
+			delay = time.Duration(-bucket.tokens / l.requestsPerSecond * float64(time.Second))
+		}
+	}
+
+	if bucket.pausedUntil.After(now.Add(delay)) {
+		delay = bucket.pausedUntil.Sub(now)
+	}
+
+	return delay
+}
+
+// Stops any more requests going to the host until the given time (e.g. when the
+// server tells us to back off with a Retry-After header)
+func (l *rateLimiter) pause(host string, until time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	bucket := l.bucketFor(host, l.now())
+	if until.After(bucket.pausedUntil) {
+		bucket.pausedUntil = until
+	}
+}
+
+func (l *rateLimiter) bucketFor(host string, now time.Time) *tokenBucket {
+	bucket, found := l.buckets[host]
+	if !found {
+		bucket = &tokenBucket{tokens: l.burst, lastRefill: now}
+		l.buckets[host] = bucket
+	}
+	return bucket
+}
+
+func minFloat(a float64, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
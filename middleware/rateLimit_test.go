@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLimiter(requestsPerSecond float64, burst int) (*rateLimiter, *time.Time) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(requestsPerSecond, burst)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestAllowsBurstWithoutWaiting(t *testing.T) {
+
+	limiter, _ := newTestLimiter(1, 3)
+
+	assert.Equal(t, time.Duration(0), limiter.reserve("a"))
+	assert.Equal(t, time.Duration(0), limiter.reserve("a"))
+	assert.Equal(t, time.Duration(0), limiter.reserve("a"))
+}
+
+func TestQueuesRequestsOverTheRate(t *testing.T) {
+
+	limiter, _ := newTestLimiter(2, 1)
+
+	assert.Equal(t, time.Duration(0), limiter.reserve("a"))
+	assert.Equal(t, 500*time.Millisecond, limiter.reserve("a"))
+	assert.Equal(t, time.Second, limiter.reserve("a"))
+}
+
+func TestRefillsOverTime(t *testing.T) {
+
+	limiter, now := newTestLimiter(2, 1)
+
+	limiter.reserve("a")
+	*now = now.Add(500 * time.Millisecond)
+
+	assert.Equal(t, time.Duration(0), limiter.reserve("a"))
+}
+
+func TestLimitsEachHostSeparately(t *testing.T) {
+
+	limiter, _ := newTestLimiter(1, 1)
+
+	limiter.reserve("a")
+
+	assert.Equal(t, time.Duration(0), limiter.reserve("b"))
+}
+
+func TestPausedHostWaitsUntilPauseEnds(t *testing.T) {
+
+	limiter, now := newTestLimiter(0, 1)
+
+	limiter.pause("a", now.Add(3*time.Second))
+
+	assert.Equal(t, 3*time.Second, limiter.reserve("a"))
+	assert.Equal(t, time.Duration(0), limiter.reserve("b"))
+}
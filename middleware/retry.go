@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// Only these methods are safe to send again if we don't know whether the first attempt
+// reached the server
+var idempotentMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPut,
+	http.MethodDelete,
+}
+
+// Status codes that mean 'try again later' rather than 'this request is wrong'
+var retryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+type retryTransport struct {
+	next    http.RoundTripper
+	limiter *rateLimiter
+	options Options
+	sleep   func(ctx context.Context, duration time.Duration) error
+}
+
+func (t *retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !canRetry(request) {
+		return t.next.RoundTrip(request)
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptRequest, err := rewind(request, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := t.next.RoundTrip(attemptRequest)
+
+		if attempt >= t.options.MaxRetries || !shouldRetry(response, err) {
+			return response, err
+		}
+
+		delay := t.backoff(attempt)
+
+		// The server knows better than us how long to wait, and it applies to
+		// every request to that host, not just this one
+		if retryAfter, found := retryAfterDelay(response, time.Now()); found {
+			delay = retryAfter
+			t.limiter.pause(request.URL.Host, time.Now().Add(retryAfter))
+		}
+
+		if response != nil {
+			// Read the rest of the body so the connection can be reused
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		err = t.sleep(request.Context(), delay)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Exponential backoff with 'full jitter', so that lots of clients that failed at the
+// same time don't all retry at the same time
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	maxDelay := float64(t.options.BaseDelay) * math.Pow(2, float64(attempt))
+	if maxDelay > float64(t.options.MaxDelay) {
+		maxDelay = float64(t.options.MaxDelay)
+	}
+	return time.Duration(rand.Float64() * maxDelay)
+}
+
+func canRetry(request *http.Request) bool {
+	if !slices.Contains(idempotentMethods, request.Method) {
+		return false
+	}
+
+	// We can only send a body again if we can get a fresh copy of it
+	return request.Body == nil || request.Body == http.NoBody || request.GetBody != nil
+}
+
+func shouldRetry(response *http.Response, err error) bool {
+	if err != nil {
+		// Giving up because the caller cancelled isn't a transient error
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return slices.Contains(retryableStatusCodes, response.StatusCode)
+}
+
+// Makes a copy of the request with a fresh body for each retry
+func rewind(request *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || request.GetBody == nil {
+		return request, nil
+	}
+
+	body, err := request.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	copy := request.Clone(request.Context())
+	copy.Body = body
+	return copy, nil
+}
+
+// Reads the Retry-After header, which is either a number of seconds or a date
+func retryAfterDelay(response *http.Response, now time.Time) (time.Duration, bool) {
+	if response == nil {
+		return 0, false
+	}
+
+	header := response.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return date.Sub(now), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Builds the middleware with sleeps that return straight away, but remember how long
+// they were asked to wait
+func newTestTransport(options Options) (http.RoundTripper, *[]time.Duration) {
+	delays := &[]time.Duration{}
+	recordSleep := func(ctx context.Context, duration time.Duration) error {
+		if duration > 0 {
+			*delays = append(*delays, duration)
+		}
+		return ctx.Err()
+	}
+
+	transport := New(http.DefaultTransport, options).(*retryTransport)
+	transport.sleep = recordSleep
+	transport.limiter.sleep = recordSleep
+
+	return transport, delays
+}
+
+func testOptions() Options {
+	return Options{MaxRetries: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+}
+
+// A server that responds with each status in turn, then 200 for everything after that
+func newFlakyServer(statuses ...int) (*httptest.Server, *int32) {
+	calls := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(atomic.AddInt32(calls, 1))
+		if call <= len(statuses) {
+			if statuses[call-1] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "2")
+			}
+			w.WriteHeader(statuses[call-1])
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	return server, calls
+}
+
+func TestRetriesServerErrorsWithBackoff(t *testing.T) {
+
+	server, calls := newFlakyServer(http.StatusServiceUnavailable, http.StatusBadGateway)
+	defer server.Close()
+	client := &http.Client{}
+	client.Transport, _ = newTestTransport(testOptions())
+
+	response, err := client.Get(server.URL)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, int32(3), *calls)
+}
+
+func TestHonoursRetryAfter(t *testing.T) {
+
+	server, calls := newFlakyServer(http.StatusTooManyRequests)
+	defer server.Close()
+	client := &http.Client{}
+	var delays *[]time.Duration
+	client.Transport, delays = newTestTransport(testOptions())
+
+	response, err := client.Get(server.URL)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, int32(2), *calls)
+	// The retry itself waits, and so does the next request through the rate limiter
+	assert.NotEmpty(t, *delays)
+	assert.InDelta(t, 2*time.Second, (*delays)[0], float64(100*time.Millisecond))
+}
+
+func TestDoesNotRetryOtherErrors(t *testing.T) {
+
+	server, calls := newFlakyServer(http.StatusInternalServerError)
+	defer server.Close()
+	client := &http.Client{}
+	client.Transport, _ = newTestTransport(testOptions())
+
+	response, err := client.Get(server.URL)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.Equal(t, int32(1), *calls)
+}
+
+func TestReturnsLastResponseWhenRetriesRunOut(t *testing.T) {
+
+	server, calls := newFlakyServer(503, 503, 503, 503, 503, 503)
+	defer server.Close()
+	client := &http.Client{}
+	client.Transport, _ = newTestTransport(testOptions())
+
+	response, err := client.Get(server.URL)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, int32(4), *calls)
+}
+
+func TestDoesNotRetryNonIdempotentRequests(t *testing.T) {
+
+	server, calls := newFlakyServer(http.StatusServiceUnavailable)
+	defer server.Close()
+	client := &http.Client{}
+	client.Transport, _ = newTestTransport(testOptions())
+
+	response, err := client.Post(server.URL, "application/json", strings.NewReader("{}"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, int32(1), *calls)
+}
+
+func TestResendsBodyWhenRetrying(t *testing.T) {
+
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	client := &http.Client{}
+	client.Transport, _ = newTestTransport(testOptions())
+
+	request, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("payload"))
+	response, err := client.Do(request)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, []string{"payload", "payload"}, bodies)
+}
+
+func TestBackoffGrowsExponentiallyUpToMaxDelay(t *testing.T) {
+
+	transport := &retryTransport{options: Options{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}}
+
+	for i := 0; i < 20; i++ {
+		assert.LessOrEqual(t, transport.backoff(0), 100*time.Millisecond)
+		assert.LessOrEqual(t, transport.backoff(2), 400*time.Millisecond)
+		assert.LessOrEqual(t, transport.backoff(10), time.Second)
+	}
+}
+
+func TestReadsRetryAfterDates(t *testing.T) {
+
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	response := &http.Response{Header: http.Header{}}
+	response.Header.Set("Retry-After", now.Add(5*time.Second).Format(http.TimeFormat))
+
+	delay, found := retryAfterDelay(response, now)
+
+	assert.True(t, found)
+	assert.Equal(t, 5*time.Second, delay)
+}
+
+func TestDoesNotRetryCancelledRequests(t *testing.T) {
+
+	// The HTTP client wraps the context's error in the URL it was fetching
+	cancelled := &url.Error{Op: "Get", URL: "https://dev.azure.com", Err: context.Canceled}
+	timedOut := &url.Error{Op: "Get", URL: "https://dev.azure.com", Err: context.DeadlineExceeded}
+	other := &url.Error{Op: "Get", URL: "https://dev.azure.com", Err: io.ErrUnexpectedEOF}
+
+	assert.False(t, shouldRetry(nil, cancelled))
+	assert.False(t, shouldRetry(nil, timedOut))
+	assert.True(t, shouldRetry(nil, other))
+}
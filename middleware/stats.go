@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// Stats counts the HTTP requests made with a context, and how many bytes they sent
+// and received. It's safe to use from more than one goroutine
+type Stats struct {
+	requests int64
+	bytes    int64
+}
+
+func (s *Stats) Requests() int64 {
+	return atomic.LoadInt64(&s.requests)
+}
+
+func (s *Stats) Bytes() int64 {
+	return atomic.LoadInt64(&s.bytes)
+}
+
+type statsKey struct{}
+
+// WithStats returns a context that counts every request made with it in the stats.
+// A nil Stats doesn't count anything
+func WithStats(ctx context.Context, stats *Stats) context.Context {
+	if stats == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, statsKey{}, stats)
+}
+
+// statsTransport counts each attempt at a request, so retries show up too
+type statsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *statsTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	stats, found := request.Context().Value(statsKey{}).(*Stats)
+	if !found {
+		return t.next.RoundTrip(request)
+	}
+
+	atomic.AddInt64(&stats.requests, 1)
+	if request.ContentLength > 0 {
+		atomic.AddInt64(&stats.bytes, request.ContentLength)
+	}
+
+	response, err := t.next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// The body is counted as it's read, as we don't always know how long it is up front
+	response.Body = &countingReader{ReadCloser: response.Body, stats: stats}
+	return response, nil
+}
+
+type countingReader struct {
+	io.ReadCloser
+	stats *Stats
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(&r.stats.bytes, int64(n))
+	return n, err
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountsRequestsAndBytesIncludingRetries(t *testing.T) {
+
+	server, _ := newFlakyServer(http.StatusServiceUnavailable)
+	defer server.Close()
+	client := &http.Client{}
+	client.Transport, _ = newTestTransport(testOptions())
+
+	stats := &Stats{}
+	request, _ := http.NewRequestWithContext(WithStats(context.Background(), stats), http.MethodGet, server.URL, nil)
+	response, err := client.Do(request)
+	io.ReadAll(response.Body)
+	response.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), stats.Requests())
+	assert.Equal(t, int64(len("ok")), stats.Bytes())
+}
+
+func TestDoesNotCountRequestsWithoutStats(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := &http.Client{}
+	client.Transport, _ = newTestTransport(testOptions())
+
+	response, err := client.Get(server.URL)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
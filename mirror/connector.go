@@ -0,0 +1,92 @@
+package mirror
+
+import (
+	"devopsdb/connectors"
+	"devopsdb/models"
+	"fmt"
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+// Connector answers queries from the mirrored copies of a schema's tables, so they
+// can run without calling the real APIs
+type Connector struct {
+	store  *Store
+	schema string
+
+	// The tables we've read, which are only read again once they've been synced, rather than
+	// every time a query (or each batch of a lookup join) reads them
+	lock   sync.Mutex
+	loaded map[string]loadedTable
+}
+
+type loadedTable struct {
+	version  string
+	contents *Table
+}
+
+func NewConnector(store *Store, schema string) *Connector {
+	return &Connector{store: store, schema: schema, loaded: make(map[string]loadedTable)}
+}
+
+func (c *Connector) GetSchemaForTable(table string) ([]string, error) {
+	return c.store.Columns(c.schema, table)
+}
+
+func (c *Connector) GetRequiredFiltersForTable(table string) []connectors.RequiredFilter {
+	// Everything is already on disk, so there's nothing we can't read
+	return []connectors.RequiredFilter(nil)
+}
+
+func (c *Connector) SupportsFilter(table string, filter models.QueryFilter) bool {
+	return false
+}
+
+func (c *Connector) Get(query connectors.ConnectorQuery) models.RowIterator {
+	contents, err := c.load(query.TableName)
+	if err != nil {
+		return models.NewErrorIterator(err)
+	}
+	if contents == nil {
+		return models.NewErrorIterator(
+			fmt.Errorf("'%v.%v' hasn't been mirrored, add it to the mirror config and run 'sync'", c.schema, query.TableName),
+		)
+	}
+
+	// The same rows are read by every query, so they're copied rather than changed
+	rows := make(models.ResultTable, len(contents.Rows))
+	for index, row := range contents.Rows {
+		copied := make(map[string]string, len(row))
+		for column, value := range row {
+			if len(query.ColumnNames) == 0 || slices.Contains(query.ColumnNames, column) {
+				copied[column] = value
+			}
+		}
+		rows[index] = copied
+	}
+
+	return models.NewTableIterator(rows)
+}
+
+// The table as it was last synced, or nil if it never has been
+func (c *Connector) load(table string) (*Table, error) {
+	version, err := c.store.Version(c.schema, table)
+	if err != nil || version == "" {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if loaded, found := c.loaded[table]; found && loaded.version == version {
+		return loaded.contents, nil
+	}
+
+	contents, err := c.store.Load(c.schema, table)
+	if err != nil || contents == nil {
+		return nil, err
+	}
+	c.loaded[table] = loadedTable{version: version, contents: contents}
+	return contents, nil
+}
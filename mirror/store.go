@@ -0,0 +1,144 @@
+package mirror
+
+import (
+	"devopsdb/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Store keeps mirrored tables on disk, as one JSON file per table under a directory
+// for each schema (e.g. '{dir}/devops/builds.json')
+type Store struct {
+	Dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+// Table is everything we know about a mirrored table
+type Table struct {
+	Columns []string           `json:"columns"`
+	Rows    models.ResultTable `json:"rows"`
+
+	// The latest value of the table's date column we've seen, so the next sync
+	// only needs to ask for rows from then onwards
+	Watermark string    `json:"watermark"`
+	SyncedAt  time.Time `json:"syncedAt"`
+}
+
+// Load reads a mirrored table, or returns nil if it's never been synced
+func (s *Store) Load(schema string, table string) (*Table, error) {
+	contents, err := os.ReadFile(s.path(schema, table))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Table{}
+	err = json.Unmarshal(contents, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Columns reads just the names of a mirrored table's columns. They're written at the start
+// of the table's file, so planning a query doesn't need to read every row. It returns nil
+// if the table has never been synced
+func (s *Store) Columns(schema string, table string) ([]string, error) {
+	file, err := os.Open(s.path(schema, table))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	columns, err := readColumns(json.NewDecoder(file))
+	if err != nil {
+		return nil, fmt.Errorf("the columns of the mirrored table '%v.%v' can't be read: %v", schema, table, err)
+	}
+	return columns, nil
+}
+
+// Reads the table's properties in order until it gets to its columns
+func readColumns(decoder *json.Decoder) ([]string, error) {
+	if start, err := decoder.Token(); err != nil || start != json.Delim('{') {
+		return nil, fmt.Errorf("it isn't a table")
+	}
+
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		if key == "columns" {
+			var columns []string
+			err = decoder.Decode(&columns)
+			return columns, err
+		}
+
+		var skipped json.RawMessage
+		err = decoder.Decode(&skipped)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// Version says which sync the table's file is from, so a copy of it that's already been
+// read can be used until the next sync. It's empty if the table has never been synced
+func (s *Store) Version(schema string, table string) (string, error) {
+	info, err := os.Stat(s.path(schema, table))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v-%v", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+// Save replaces the mirrored table. The new version is written alongside the old one
+// first, and the columns and rows are in the same file, so a sync that fails half way
+// through doesn't lose what we already had or leave the two out of step
+func (s *Store) Save(schema string, table string, contents *Table) error {
+	path := s.path(schema, table)
+
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	return writeJson(path, contents)
+}
+
+func writeJson(path string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(path+".tmp", data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func (s *Store) path(schema string, table string) string {
+	return filepath.Join(s.Dir, schema, table+".json")
+}
@@ -0,0 +1,83 @@
+package mirror
+
+import (
+	"devopsdb/connectors"
+	"devopsdb/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnsAreReadWithoutTheRows(t *testing.T) {
+
+	store := NewStore(t.TempDir())
+	store.Save("devops", "builds", &Table{Columns: []string{"id", "finished"}, Rows: models.ResultTable{{"id": "1"}}})
+
+	// If the rows were read, this would fail
+	path := filepath.Join(store.Dir, "devops", "builds.json")
+	contents, _ := os.ReadFile(path)
+	os.WriteFile(path, append(contents[:strings.Index(string(contents), `"rows":`)], "not json"...), 0600)
+
+	columns, err := store.Columns("devops", "builds")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "finished"}, columns)
+}
+
+// The columns used to be written to a file of their own, after the rows
+func TestColumnsAndRowsAreSavedTogether(t *testing.T) {
+
+	store := NewStore(t.TempDir())
+	store.Save("devops", "builds", &Table{Columns: []string{"id", "finished"}, Rows: models.ResultTable{{"id": "1"}}})
+
+	files, _ := os.ReadDir(filepath.Join(store.Dir, "devops"))
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "builds.json", files[0].Name())
+}
+
+func TestColumnsOfUnsyncedTablesAreNil(t *testing.T) {
+
+	columns, err := NewStore(t.TempDir()).Columns("devops", "builds")
+
+	assert.Nil(t, err)
+	assert.Nil(t, columns)
+}
+
+func TestMirrorConnectorReturnsErrorsReadingTheColumns(t *testing.T) {
+
+	store := NewStore(t.TempDir())
+	os.MkdirAll(filepath.Join(store.Dir, "devops"), 0700)
+	os.WriteFile(filepath.Join(store.Dir, "devops", "builds.json"), []byte("{"), 0600)
+
+	_, err := NewConnector(store, "devops").GetSchemaForTable("builds")
+
+	assert.ErrorContains(t, err, "the columns of the mirrored table 'devops.builds' can't be read")
+}
+
+func TestMirrorConnectorOnlyReadsTheTableAgainOnceItsSynced(t *testing.T) {
+
+	store := NewStore(t.TempDir())
+	store.Save("devops", "builds", &Table{Columns: []string{"id"}, Rows: models.ResultTable{{"id": "1"}}})
+	connector := NewConnector(store, "devops")
+	models.Collect(connector.Get(connectors.ConnectorQuery{TableName: "builds"}))
+
+	// A table that's been read isn't read again while it hasn't changed..
+	path := filepath.Join(store.Dir, "devops", "builds.json")
+	info, _ := os.Stat(path)
+	os.WriteFile(path, []byte("not json"), 0600)
+	os.Truncate(path, info.Size())
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+
+	results, err := models.Collect(connector.Get(connectors.ConnectorQuery{TableName: "builds", ColumnNames: []string{"id"}}))
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"id": "1"}}, results)
+
+	// .. but it is once it's been synced again
+	store.Save("devops", "builds", &Table{Columns: []string{"id"}, Rows: models.ResultTable{{"id": "1"}, {"id": "2"}}})
+
+	results, err = models.Collect(connector.Get(connectors.ConnectorQuery{TableName: "builds"}))
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"id": "1"}, {"id": "2"}}, results)
+}
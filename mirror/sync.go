@@ -0,0 +1,141 @@
+package mirror
+
+import (
+	"devopsdb/models"
+	"fmt"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// Executor runs queries against the live connectors (i.e. the query engine)
+type Executor interface {
+	Execute(query models.Query) (*models.QueryResult, error)
+}
+
+// TableConfig says which table to mirror, and how to keep it up to date
+type TableConfig struct {
+	Schema string
+	Table  string
+
+	// Only rows where this column is within the last 'Days' days are kept, and each
+	// sync only asks for rows on or after the latest value we've already got
+	DateColumn string
+	Days       int
+
+	// Identifies a row, so a row we fetch again replaces the copy we already have
+	KeyColumn string
+}
+
+type SyncResult struct {
+	Fetched   int // How many rows we read from the connector
+	Total     int // How many rows are now in the mirror
+	Watermark string
+}
+
+// Sync brings the mirrored copy of a table up to date. The first sync reads the last
+// 'Days' days of rows, and after that only rows newer than the watermark are read
+func Sync(executor Executor, store *Store, config TableConfig, now time.Time) (SyncResult, error) {
+	existing, err := store.Load(config.Schema, config.Table)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	if existing == nil {
+		existing = &Table{}
+	}
+
+	cutoff := ""
+	if config.Days > 0 {
+		cutoff = now.AddDate(0, 0, -config.Days).UTC().Format(time.RFC3339)
+	}
+
+	// The watermark row is read again, in case other rows share its date
+	from := cutoff
+	if existing.Watermark > from {
+		from = existing.Watermark
+	}
+
+	query := models.Query{SchemaName: config.Schema, Table: config.Table}
+	if from != "" {
+		query.Filters = []models.QueryFilter{{Type: "ge", FieldName: config.DateColumn, Value: from}}
+	}
+
+	result, err := executor.Execute(query)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	err = checkColumns(config, result.Columns)
+	if err != nil {
+		result.Rows.Close()
+		return SyncResult{}, err
+	}
+
+	fetched, err := models.Collect(result.Rows)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	rows := merge(existing.Rows, fetched, config.KeyColumn)
+
+	var kept models.ResultTable
+	watermark := existing.Watermark
+	for _, row := range rows {
+		date := row[config.DateColumn]
+		if cutoff != "" && date < cutoff {
+			continue
+		}
+		if date > watermark {
+			watermark = date
+		}
+		kept = append(kept, row)
+	}
+
+	err = store.Save(config.Schema, config.Table, &Table{
+		Columns:   result.Columns,
+		Rows:      kept,
+		Watermark: watermark,
+		SyncedAt:  now,
+	})
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	return SyncResult{Fetched: len(fetched), Total: len(kept), Watermark: watermark}, nil
+}
+
+// Without the key column every sync would add the rows again, and without the date column
+// every row would look too old to keep
+func checkColumns(config TableConfig, columns []string) error {
+	if !slices.Contains(columns, config.KeyColumn) {
+		return fmt.Errorf("the keyColumn '%v' isn't a column of '%v.%v'", config.KeyColumn, config.Schema, config.Table)
+	}
+	if config.DateColumn == "" && config.Days > 0 {
+		return fmt.Errorf("'%v.%v' needs a dateColumn to only keep the last %v days", config.Schema, config.Table, config.Days)
+	}
+	if config.DateColumn != "" && !slices.Contains(columns, config.DateColumn) {
+		return fmt.Errorf("the dateColumn '%v' isn't a column of '%v.%v'", config.DateColumn, config.Schema, config.Table)
+	}
+	return nil
+}
+
+// Adds the fetched rows to the existing ones, replacing any with the same key
+func merge(existing models.ResultTable, fetched models.ResultTable, keyColumn string) models.ResultTable {
+	positions := make(map[string]int, len(existing))
+	result := make(models.ResultTable, 0, len(existing)+len(fetched))
+
+	for _, row := range append(existing, fetched...) {
+		key, hasKey := row[keyColumn]
+		if position, found := positions[key]; hasKey && found {
+			result[position] = row
+			continue
+		}
+
+		if hasKey {
+			positions[key] = len(result)
+		}
+		result = append(result, row)
+	}
+
+	return result
+}
@@ -0,0 +1,134 @@
+package mirror
+
+import (
+	"devopsdb/connectors"
+	"devopsdb/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeExecutor struct {
+	rows    models.ResultTable
+	queries []models.Query
+}
+
+func (e *fakeExecutor) Execute(query models.Query) (*models.QueryResult, error) {
+	e.queries = append(e.queries, query)
+	return &models.QueryResult{
+		Columns: []string{"id", "finished"},
+		Rows:    models.NewFilterIterator(models.NewTableIterator(e.rows), query.Filters),
+	}, nil
+}
+
+var syncNow = time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+
+var buildsConfig = TableConfig{Schema: "devops", Table: "builds", DateColumn: "finished", KeyColumn: "id", Days: 90}
+
+func TestFirstSyncReadsTheWholeWindow(t *testing.T) {
+
+	store := NewStore(t.TempDir())
+	executor := &fakeExecutor{rows: models.ResultTable{
+		{"id": "1", "finished": "2021-12-01T00:00:00Z"},
+		{"id": "2", "finished": "2022-03-01T00:00:00Z"},
+	}}
+
+	result, err := Sync(executor, store, buildsConfig, syncNow)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.QueryFilter{{Type: "ge", FieldName: "finished", Value: "2022-01-01T00:00:00Z"}}, executor.queries[0].Filters)
+	assert.Equal(t, SyncResult{Fetched: 1, Total: 1, Watermark: "2022-03-01T00:00:00Z"}, result)
+}
+
+func TestLaterSyncsStartFromTheWatermark(t *testing.T) {
+
+	store := NewStore(t.TempDir())
+	executor := &fakeExecutor{rows: models.ResultTable{
+		{"id": "1", "finished": "2022-03-01T00:00:00Z"},
+	}}
+	Sync(executor, store, buildsConfig, syncNow)
+
+	executor.rows = append(executor.rows, models.ResultTable{
+		{"id": "2", "finished": "2022-03-02T00:00:00Z"},
+		{"id": "3", "finished": "2022-03-03T00:00:00Z"},
+	}...)
+	result, err := Sync(executor, store, buildsConfig, syncNow.Add(time.Hour))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "2022-03-01T00:00:00Z", executor.queries[1].Filters[0].Value)
+	assert.Equal(t, SyncResult{Fetched: 3, Total: 3, Watermark: "2022-03-03T00:00:00Z"}, result)
+
+	table, _ := store.Load("devops", "builds")
+	assert.Equal(t, models.ResultTable{
+		{"id": "1", "finished": "2022-03-01T00:00:00Z"},
+		{"id": "2", "finished": "2022-03-02T00:00:00Z"},
+		{"id": "3", "finished": "2022-03-03T00:00:00Z"},
+	}, table.Rows)
+}
+
+func TestSyncDropsRowsThatFallOutOfTheWindow(t *testing.T) {
+
+	store := NewStore(t.TempDir())
+	executor := &fakeExecutor{rows: models.ResultTable{
+		{"id": "1", "finished": "2022-01-02T00:00:00Z"},
+		{"id": "2", "finished": "2022-03-01T00:00:00Z"},
+	}}
+	Sync(executor, store, buildsConfig, syncNow)
+
+	result, _ := Sync(executor, store, buildsConfig, syncNow.AddDate(0, 0, 7))
+
+	assert.Equal(t, 1, result.Total)
+}
+
+func TestSyncChecksTheKeyAndDateColumns(t *testing.T) {
+
+	store := NewStore(t.TempDir())
+	executor := &fakeExecutor{rows: models.ResultTable{{"id": "1", "finished": "2022-03-01T00:00:00Z"}}}
+
+	misspeltKey := buildsConfig
+	misspeltKey.KeyColumn = "ID"
+	_, err := Sync(executor, store, misspeltKey, syncNow)
+	assert.EqualError(t, err, "the keyColumn 'ID' isn't a column of 'devops.builds'")
+
+	misspeltDate := buildsConfig
+	misspeltDate.DateColumn = "finish"
+	_, err = Sync(executor, store, misspeltDate, syncNow)
+	assert.EqualError(t, err, "the dateColumn 'finish' isn't a column of 'devops.builds'")
+
+	missingDate := buildsConfig
+	missingDate.DateColumn = ""
+	_, err = Sync(executor, store, missingDate, syncNow)
+	assert.EqualError(t, err, "'devops.builds' needs a dateColumn to only keep the last 90 days")
+
+	// Nothing was saved
+	table, _ := store.Load("devops", "builds")
+	assert.Nil(t, table)
+}
+
+func TestMirrorConnectorReadsSyncedTable(t *testing.T) {
+
+	store := NewStore(t.TempDir())
+	Sync(&fakeExecutor{rows: models.ResultTable{
+		{"id": "1", "finished": "2022-03-01T00:00:00Z"},
+	}}, store, buildsConfig, syncNow)
+	connector := NewConnector(store, "devops")
+
+	results, err := models.Collect(connector.Get(connectors.ConnectorQuery{TableName: "builds", ColumnNames: []string{"id"}}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.ResultTable{{"id": "1"}}, results)
+
+	columns, err := connector.GetSchemaForTable("builds")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "finished"}, columns)
+}
+
+func TestMirrorConnectorReturnsErrorForUnsyncedTable(t *testing.T) {
+
+	connector := NewConnector(NewStore(t.TempDir()), "devops")
+
+	_, err := models.Collect(connector.Get(connectors.ConnectorQuery{TableName: "builds"}))
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expression is a value worked out from each row, e.g. 'duration * 60',
+// "concat(project, '/', name)" or "case when result = 'failed' then 1 else 0 end"
+type Expression struct {
+	Type      string       // 'column', 'value', 'operator', 'function' or 'case'
+	FieldName string       // The column, for column nodes
+	Value     string       // The value, for value nodes
+	Operator  string       // +, -, *, / or % for operator nodes. A '-' with one argument negates it
+	Function  string       // The name of the function, for function nodes
+	Arguments []Expression // The operands of operator nodes, the arguments of function nodes, and the results of case nodes
+
+	// The condition for each of the results of a case node, in order. If there's one more
+	// result than there are conditions, it's the 'else'
+	Conditions []QueryFilter
+}
+
+// Evaluate works out the expression's value for the row. Like everything else, values are
+// text. Arithmetic on anything that isn't a number gives an empty value
+func (e Expression) Evaluate(row map[string]string) string {
+	switch e.Type {
+
+	case "column":
+		return row[e.FieldName]
+
+	case "value":
+		return e.Value
+
+	case "operator":
+		var operands []float64
+		for _, argument := range e.Arguments {
+			number, isNumber := ParseNumber(argument.Evaluate(row))
+			if !isNumber {
+				return ""
+			}
+			operands = append(operands, number)
+		}
+		return calculate(e.Operator, operands)
+
+	case "function":
+		var arguments []string
+		for _, argument := range e.Arguments {
+			arguments = append(arguments, argument.Evaluate(row))
+		}
+		return functions[e.Function].evaluate(arguments)
+
+	case "case":
+		for index, condition := range e.Conditions {
+			if condition.rowPasses(row) {
+				return e.Arguments[index].Evaluate(row)
+			}
+		}
+		if len(e.Arguments) > len(e.Conditions) {
+			return e.Arguments[len(e.Conditions)].Evaluate(row)
+		}
+	}
+
+	return ""
+}
+
+func calculate(operator string, operands []float64) string {
+	if len(operands) == 1 && operator == "-" {
+		return FormatNumber(-operands[0])
+	}
+
+	left, right := operands[0], operands[1]
+	switch operator {
+	case "+":
+		return FormatNumber(left + right)
+	case "-":
+		return FormatNumber(left - right)
+	case "*":
+		return FormatNumber(left * right)
+	case "/":
+		if right == 0 {
+			return ""
+		}
+		return FormatNumber(left / right)
+	case "%":
+		if right == 0 {
+			return ""
+		}
+		return FormatNumber(float64(int64(left) % int64(right)))
+	}
+	return ""
+}
+
+// FormatNumber writes numbers without any trailing zeros, e.g. '2' or '2.5'
+func FormatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// Numbers are written in decimal, with an optional exponent (e.g. "-1.5e3")
+var decimalNumber = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+
+// ParseNumber reads the value as a number if it's written as one. Text that Go would also
+// read as a number (e.g. "nan", "inf" or "0x1p4") isn't, and neither are numbers too big to store
+func ParseNumber(value string) (float64, bool) {
+	if !decimalNumber.MatchString(value) {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number, true
+}
+
+// How the functions the parser uses for typed literals are written
+var dateLiterals = map[string]string{
+	"dateliteral":      "date",
+	"timestampliteral": "timestamp",
+}
+
+// FieldNames returns every column the expression uses
+func (e Expression) FieldNames() []string {
+	if e.Type == "column" {
+		return []string{e.FieldName}
+	}
+
+	var result []string
+	add := func(fields []string) {
+		for _, field := range fields {
+			if !containsIgnoringCase(result, field) {
+				result = append(result, field)
+			}
+		}
+	}
+
+	add(FieldNames(e.Conditions))
+	for _, argument := range e.Arguments {
+		add(argument.FieldNames())
+	}
+	return result
+}
+
+// RenameFields returns a copy of the expression with each column renamed
+func (e Expression) RenameFields(rename func(string) string) Expression {
+	if e.Type == "column" {
+		e.FieldName = rename(e.FieldName)
+	}
+
+	if e.Arguments != nil {
+		arguments := make([]Expression, len(e.Arguments))
+		for index, argument := range e.Arguments {
+			arguments[index] = argument.RenameFields(rename)
+		}
+		e.Arguments = arguments
+	}
+
+	if e.Conditions != nil {
+		conditions := make([]QueryFilter, len(e.Conditions))
+		for index, condition := range e.Conditions {
+			conditions[index] = condition.RenameFields(rename)
+		}
+		e.Conditions = conditions
+	}
+
+	return e
+}
+
+// String writes the expression out in the same way as it would appear in SQL
+func (e Expression) String() string {
+	switch e.Type {
+
+	case "column":
+		return e.FieldName
+
+	case "value":
+		if _, isNumber := ParseNumber(e.Value); isNumber {
+			return e.Value
+		}
+		return "'" + e.Value + "'"
+
+	case "operator":
+		var operands []string
+		for _, argument := range e.Arguments {
+			operand := argument.String()
+			if argument.Type == "operator" {
+				operand = "(" + operand + ")"
+			}
+			operands = append(operands, operand)
+		}
+		if len(operands) == 1 {
+			return e.Operator + operands[0]
+		}
+		return strings.Join(operands, " "+e.Operator+" ")
+
+	case "function":
+		var arguments []string
+		for _, argument := range e.Arguments {
+			arguments = append(arguments, argument.String())
+		}
+		if literal, isLiteral := dateLiterals[e.Function]; isLiteral {
+			return literal + " " + strings.Join(arguments, ", ")
+		}
+		return e.Function + "(" + strings.Join(arguments, ", ") + ")"
+
+	case "case":
+		result := "case"
+		for index, condition := range e.Conditions {
+			result += " when " + condition.String() + " then " + e.Arguments[index].String()
+		}
+		if len(e.Arguments) > len(e.Conditions) {
+			result += " else " + e.Arguments[len(e.Conditions)].String()
+		}
+		return result + " end"
+	}
+
+	return ""
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func column(name string) Expression {
+	return Expression{Type: "column", FieldName: name}
+}
+
+func value(value string) Expression {
+	return Expression{Type: "value", Value: value}
+}
+
+func TestArithmetic(t *testing.T) {
+
+	row := map[string]string{"duration": "90", "name": "deploy"}
+
+	minutes := Expression{Type: "operator", Operator: "/", Arguments: []Expression{column("duration"), value("60")}}
+	negated := Expression{Type: "operator", Operator: "-", Arguments: []Expression{minutes}}
+	remainder := Expression{Type: "operator", Operator: "%", Arguments: []Expression{column("duration"), value("60")}}
+	byZero := Expression{Type: "operator", Operator: "/", Arguments: []Expression{column("duration"), value("0")}}
+	notANumber := Expression{Type: "operator", Operator: "+", Arguments: []Expression{column("name"), value("1")}}
+
+	assert.Equal(t, "1.5", minutes.Evaluate(row))
+	assert.Equal(t, "-1.5", negated.Evaluate(row))
+	assert.Equal(t, "30", remainder.Evaluate(row))
+	assert.Equal(t, "", byZero.Evaluate(row))
+	assert.Equal(t, "", notANumber.Evaluate(row))
+}
+
+func TestConcat(t *testing.T) {
+
+	expression := Expression{Type: "function", Function: "concat", Arguments: []Expression{column("project"), value("/"), column("name")}}
+
+	assert.Equal(t, "a/deploy", expression.Evaluate(map[string]string{"project": "a", "name": "deploy"}))
+	assert.Equal(t, []string{"project", "name"}, expression.FieldNames())
+	assert.Equal(t, "concat(project, '/', name)", expression.String())
+}
+
+func TestExpressionString(t *testing.T) {
+
+	sum := Expression{Type: "operator", Operator: "+", Arguments: []Expression{column("a"), value("2")}}
+	expression := Expression{Type: "operator", Operator: "*", Arguments: []Expression{sum, Expression{Type: "operator", Operator: "-", Arguments: []Expression{column("b")}}}}
+
+	assert.Equal(t, "(a + 2) * (-b)", expression.String())
+}
+
+func TestCase(t *testing.T) {
+
+	expression := Expression{
+		Type: "case",
+		Conditions: []QueryFilter{
+			{Type: "eq", FieldName: "result", Value: "failed"},
+			{Type: "gt", Expression: &Expression{Type: "function", Function: "abs", Arguments: []Expression{column("duration")}}, Value: "60"},
+		},
+		Arguments: []Expression{value("broken"), value("slow"), column("result")},
+	}
+
+	assert.Equal(t, "broken", expression.Evaluate(map[string]string{"result": "Failed", "duration": "90"}))
+	assert.Equal(t, "slow", expression.Evaluate(map[string]string{"result": "succeeded", "duration": "-90"}))
+	assert.Equal(t, "succeeded", expression.Evaluate(map[string]string{"result": "succeeded", "duration": "5"}))
+	assert.Equal(t, []string{"result", "duration"}, expression.FieldNames())
+	assert.Equal(t, "case when result = 'failed' then 'broken' when abs(duration) > '60' then 'slow' else result end", expression.String())
+
+	renamed := expression.RenameFields(func(field string) string { return "b." + field })
+	assert.Equal(t, []string{"b.result", "b.duration"}, renamed.FieldNames())
+	assert.Equal(t, []string{"result", "duration"}, expression.FieldNames())
+}
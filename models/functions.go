@@ -0,0 +1,422 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A function that can be used in expressions. Like everything else, the arguments and the
+// result are text, and anything that can't be worked out (e.g. the date of something that
+// isn't a date) gives an empty value
+type function struct {
+	minArguments int
+	maxArguments int // -1 for any number
+	evaluate     func(arguments []string) string
+}
+
+// The functions that can be used in expressions, by name
+var functions = map[string]function{
+	"concat": {1, -1, func(arguments []string) string {
+		return strings.Join(arguments, "")
+	}},
+
+	"lower": {1, 1, func(arguments []string) string {
+		return strings.ToLower(arguments[0])
+	}},
+
+	"upper": {1, 1, func(arguments []string) string {
+		return strings.ToUpper(arguments[0])
+	}},
+
+	// substr(text, start, length), counting from 1. A negative start counts back from the end
+	"substr":    {2, 3, substr},
+	"substring": {2, 3, substr},
+
+	"replace": {3, 3, func(arguments []string) string {
+		return strings.ReplaceAll(arguments[0], arguments[1], arguments[2])
+	}},
+
+	// split_part('a/b/c', '/', 2) is 'b'
+	"split_part": {3, 3, func(arguments []string) string {
+		index, err := strconv.Atoi(arguments[2])
+		parts := strings.Split(arguments[0], arguments[1])
+		if err != nil || index < 1 || index > len(parts) {
+			return ""
+		}
+		return parts[index-1]
+	}},
+
+	// regexp_extract(text, pattern, group) is the part that matches the pattern (or one
+	// of its groups)
+	"regexp_extract": {2, 3, func(arguments []string) string {
+		regex, err := regexp.Compile(arguments[1])
+		if err != nil {
+			return ""
+		}
+		group := 0
+		if len(arguments) == 3 {
+			if group, err = strconv.Atoi(arguments[2]); err != nil {
+				return ""
+			}
+		}
+		match := regex.FindStringSubmatch(arguments[0])
+		if group < 0 || group >= len(match) {
+			return ""
+		}
+		return match[group]
+	}},
+
+	"now": {0, 0, func(arguments []string) string {
+		return formatDate(now())
+	}},
+	"current_timestamp": {0, 0, func(arguments []string) string {
+		return formatDate(now())
+	}},
+
+	// The start of today, in TimeZone
+	"current_date": {0, 0, func(arguments []string) string {
+		today, _ := truncateDate("day", now())
+		return formatDate(today)
+	}},
+
+	// The parser reads "date '2022-01-31'" and "timestamp '2022-01-31 09:00:00'" as these
+	"dateliteral": {1, 1, func(arguments []string) string {
+		date, ok := parseDate(arguments[0])
+		if !ok {
+			return ""
+		}
+		day, _ := truncateDate("day", date)
+		return formatDate(day)
+	}},
+	"timestampliteral": {1, 1, func(arguments []string) string {
+		date, ok := parseDate(arguments[0])
+		if !ok {
+			return ""
+		}
+		return formatDate(date)
+	}},
+
+	// date_trunc('day', date) is the start of the day (or week, month etc.)
+	"date_trunc": {2, 2, func(arguments []string) string {
+		date, ok := parseDate(arguments[1])
+		if !ok {
+			return ""
+		}
+		truncated, ok := truncateDate(strings.ToLower(arguments[0]), date)
+		if !ok {
+			return ""
+		}
+		return formatDate(truncated)
+	}},
+
+	// datediff('day', start, end) is the number of whole days (or hours, months etc.) from
+	// start to end. As in MySQL, datediff(end, start) is the number of days between their dates
+	"datediff": {2, 3, func(arguments []string) string {
+		if len(arguments) == 2 {
+			return daysBetween(arguments[1], arguments[0])
+		}
+
+		start, startOk := parseDate(arguments[1])
+		end, endOk := parseDate(arguments[2])
+		if !startOk || !endOk {
+			return ""
+		}
+		difference, ok := dateDifference(strings.ToLower(arguments[0]), start, end)
+		if !ok {
+			return ""
+		}
+		return strconv.Itoa(difference)
+	}},
+
+	// The parser reads 'date_add(date, interval 7 day)' as date_add(date, 7, 'day')
+	"date_add": {3, 3, func(arguments []string) string {
+		return addToDate(arguments, 1)
+	}},
+	"date_sub": {3, 3, func(arguments []string) string {
+		return addToDate(arguments, -1)
+	}},
+
+	// format_date(date, '%Y-%m-%d'), using the same placeholders as MySQL's date_format. It's
+	// written in TimeZone, unless another is given, e.g. format_date(date, '%H:%i', 'Asia/Tokyo')
+	"format_date": {2, 3, func(arguments []string) string {
+		date, ok := parseDate(arguments[0])
+		if !ok {
+			return ""
+		}
+		location := TimeZone
+		if len(arguments) == 3 {
+			var err error
+			if location, err = time.LoadLocation(arguments[2]); err != nil {
+				return ""
+			}
+		}
+		return formatDateAs(date.In(location), arguments[1])
+	}},
+
+	// round(number, places), to a whole number if there are no places
+	"round": {1, 2, func(arguments []string) string {
+		number, isNumber := ParseNumber(arguments[0])
+		if !isNumber {
+			return ""
+		}
+		places := 0
+		var err error
+		if len(arguments) == 2 {
+			if places, err = strconv.Atoi(arguments[1]); err != nil {
+				return ""
+			}
+		}
+		scale := math.Pow(10, float64(places))
+		return FormatNumber(math.Round(number*scale) / scale)
+	}},
+
+	"abs": {1, 1, func(arguments []string) string {
+		number, isNumber := ParseNumber(arguments[0])
+		if !isNumber {
+			return ""
+		}
+		return FormatNumber(math.Abs(number))
+	}},
+
+	// coalesce(a, b, ...) is the first value that isn't empty
+	"coalesce": {1, -1, func(arguments []string) string {
+		for _, argument := range arguments {
+			if argument != "" {
+				return argument
+			}
+		}
+		return ""
+	}},
+
+	// nullif(a, b) is empty if a and b are the same (ignoring case, like filters), otherwise a
+	"nullif": {2, 2, func(arguments []string) string {
+		if strings.EqualFold(arguments[0], arguments[1]) {
+			return ""
+		}
+		return arguments[0]
+	}},
+}
+
+// CheckFunction says whether there's a function with the name that can take the number
+// of arguments
+func CheckFunction(name string, arguments int) error {
+	function, found := functions[name]
+	if !found {
+		return fmt.Errorf("unknown function '%v'", name)
+	}
+
+	if arguments >= function.minArguments && (function.maxArguments < 0 || arguments <= function.maxArguments) {
+		return nil
+	}
+
+	switch {
+	case function.maxArguments == 0:
+		return fmt.Errorf("'%v' doesn't take any arguments", name)
+	case function.maxArguments < 0:
+		return fmt.Errorf("'%v' needs at least %v", name, argumentCount(function.minArguments))
+	case function.minArguments == function.maxArguments:
+		return fmt.Errorf("'%v' needs %v", name, argumentCount(function.minArguments))
+	}
+	return fmt.Errorf("'%v' needs %v or %v", name, function.minArguments, argumentCount(function.maxArguments))
+}
+
+func argumentCount(count int) string {
+	if count == 1 {
+		return "1 argument"
+	}
+	return strconv.Itoa(count) + " arguments"
+}
+
+func substr(arguments []string) string {
+	text := []rune(arguments[0])
+	start, err := strconv.Atoi(arguments[1])
+	if err != nil {
+		return ""
+	}
+
+	if start < 0 {
+		start = len(text) + start
+	} else if start > 0 {
+		start--
+	}
+	if start < 0 || start >= len(text) {
+		return ""
+	}
+
+	end := len(text)
+	if len(arguments) == 3 {
+		length, err := strconv.Atoi(arguments[2])
+		if err != nil || length < 0 {
+			return ""
+		}
+		if start+length < end {
+			end = start + length
+		}
+	}
+	return string(text[start:end])
+}
+
+// now is a variable so tests can choose the time
+var now = time.Now
+
+// TimeZone is where dates without a time zone (e.g. '2022-01-31 09:00') are, and where days,
+// weeks etc. start for date_trunc. Dates are always written out in UTC
+var TimeZone = time.UTC
+
+// The formats dates can be written in. They're always written back out in the first one, in
+// UTC, so they sort correctly as text
+var dateFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseDate(value string) (time.Time, bool) {
+	for _, format := range dateFormats {
+		if date, err := time.ParseInLocation(format, value, TimeZone); err == nil {
+			return date.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func formatDate(date time.Time) string {
+	return date.UTC().Format(time.RFC3339)
+}
+
+func truncateDate(unit string, date time.Time) (time.Time, bool) {
+	date = date.In(TimeZone)
+
+	switch unit {
+	case "second":
+		return date.Truncate(time.Second), true
+	case "minute":
+		return date.Truncate(time.Minute), true
+	case "hour":
+		return time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), 0, 0, 0, TimeZone), true
+	case "day":
+		return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, TimeZone), true
+	case "week":
+		// Weeks start on a Monday
+		day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, TimeZone)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)), true
+	case "month":
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, TimeZone), true
+	case "year":
+		return time.Date(date.Year(), 1, 1, 0, 0, 0, 0, TimeZone), true
+	}
+	return date, false
+}
+
+var unitDurations = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+func dateDifference(unit string, start time.Time, end time.Time) (int, bool) {
+	if duration, found := unitDurations[unit]; found {
+		return int(end.Sub(start) / duration), true
+	}
+
+	monthsPerUnit := map[string]int{"month": 1, "year": 12}[unit]
+	if monthsPerUnit == 0 {
+		return 0, false
+	}
+
+	// Only whole months count, so a month is taken off if the end is earlier in its
+	// month than the start
+	months := (end.Year()-start.Year())*12 + int(end.Month()) - int(start.Month())
+	if months > 0 && start.AddDate(0, months, 0).After(end) {
+		months--
+	}
+	if months < 0 && start.AddDate(0, months, 0).Before(end) {
+		months++
+	}
+	return months / monthsPerUnit, true
+}
+
+// The number of days from the start's date to the end's, ignoring the times
+func daysBetween(start string, end string) string {
+	startDate, startOk := parseDate(start)
+	endDate, endOk := parseDate(end)
+	if !startOk || !endOk {
+		return ""
+	}
+	startDay, _ := truncateDate("day", startDate)
+	endDay, _ := truncateDate("day", endDate)
+
+	// Days aren't always 24 hours long when the clocks change
+	return strconv.Itoa(int(math.Round(endDay.Sub(startDay).Hours() / 24)))
+}
+
+// Adds an amount of a unit (e.g. 7 and 'day') to a date. sign is -1 to take it away instead
+func addToDate(arguments []string, sign int) string {
+	date, ok := parseDate(arguments[0])
+	amount, err := strconv.Atoi(arguments[1])
+	if !ok || err != nil {
+		return ""
+	}
+	amount *= sign
+
+	switch strings.ToLower(arguments[2]) {
+	case "month":
+		return formatDate(date.AddDate(0, amount, 0))
+	case "year":
+		return formatDate(date.AddDate(amount, 0, 0))
+	}
+
+	duration, found := unitDurations[strings.ToLower(arguments[2])]
+	if !found {
+		return ""
+	}
+	return formatDate(date.Add(time.Duration(amount) * duration))
+}
+
+// The placeholders format_date understands, and the layouts Go uses for them
+var dateFormatPlaceholders = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'c': "1",
+	'd': "02",
+	'e': "2",
+	'H': "15",
+	'h': "03",
+	'i': "04",
+	's': "05",
+	'p': "PM",
+	'M': "January",
+	'b': "Jan",
+	'W': "Monday",
+	'a': "Mon",
+}
+
+func formatDateAs(date time.Time, format string) string {
+	var result strings.Builder
+	for index := 0; index < len(format); index++ {
+		if format[index] != '%' || index == len(format)-1 {
+			result.WriteByte(format[index])
+			continue
+		}
+
+		index++
+		layout, found := dateFormatPlaceholders[format[index]]
+		if !found {
+			// Including '%%', which is just a '%'
+			result.WriteByte(format[index])
+			continue
+		}
+		result.WriteString(date.Format(layout))
+	}
+	return result.String()
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func call(name string, arguments ...string) string {
+	return functions[name].evaluate(arguments)
+}
+
+func TestStringFunctions(t *testing.T) {
+
+	assert.Equal(t, "main", call("lower", "Main"))
+	assert.Equal(t, "MAIN", call("upper", "Main"))
+	assert.Equal(t, "eplo", call("substr", "deploy", "2", "4"))
+	assert.Equal(t, "loy", call("substr", "deploy", "-3"))
+	assert.Equal(t, "", call("substr", "deploy", "10"))
+	assert.Equal(t, "a-b-c", call("replace", "a/b/c", "/", "-"))
+	assert.Equal(t, "feature", call("split_part", "refs/heads/feature", "/", "3"))
+	assert.Equal(t, "", call("split_part", "refs/heads/feature", "/", "4"))
+	assert.Equal(t, "123", call("regexp_extract", "PR-123: fix", `PR-(\d+)`, "1"))
+	assert.Equal(t, "PR-123", call("regexp_extract", "PR-123: fix", `PR-\d+`))
+	assert.Equal(t, "", call("regexp_extract", "fix", `PR-(\d+)`, "1"))
+}
+
+func TestDateFunctions(t *testing.T) {
+
+	now = func() time.Time { return time.Date(2022, 3, 15, 10, 30, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	assert.Equal(t, "2022-03-15T10:30:00Z", call("now"))
+	assert.Equal(t, "2022-03-15T00:00:00Z", call("date_trunc", "day", "2022-03-15T10:30:00Z"))
+	assert.Equal(t, "2022-03-14T00:00:00Z", call("date_trunc", "week", "2022-03-15T10:30:00Z"))
+	assert.Equal(t, "2022-03-01T00:00:00Z", call("date_trunc", "MONTH", "2022-03-15"))
+	assert.Equal(t, "", call("date_trunc", "fortnight", "2022-03-15"))
+	assert.Equal(t, "90", call("datediff", "minute", "2022-03-15T09:00:00Z", "2022-03-15T10:30:00Z"))
+	assert.Equal(t, "1", call("datediff", "month", "2022-01-31", "2022-03-15"))
+	assert.Equal(t, "-2", call("datediff", "day", "2022-03-15", "2022-03-13"))
+	assert.Equal(t, "1", call("datediff", "2022-03-15T00:10:00Z", "2022-03-14T23:50:00Z"))
+	assert.Equal(t, "-2", call("datediff", "2022-03-13", "2022-03-15T10:30:00Z"))
+	assert.Equal(t, "", call("datediff", "yesterday", "2022-03-15"))
+	assert.Equal(t, "2022-03-22T10:30:00Z", call("date_add", "2022-03-15T10:30:00Z", "7", "DAY"))
+	assert.Equal(t, "2022-02-15T10:30:00Z", call("date_sub", "2022-03-15T10:30:00Z", "1", "month"))
+	assert.Equal(t, "15/03/2022 10:30 100%", call("format_date", "2022-03-15T10:30:00Z", "%d/%m/%Y %H:%i 100%%"))
+	assert.Equal(t, "", call("format_date", "yesterday", "%Y"))
+}
+
+func TestNumericFunctions(t *testing.T) {
+
+	assert.Equal(t, "3", call("round", "2.5"))
+	assert.Equal(t, "2.57", call("round", "2.5678", "2"))
+	assert.Equal(t, "4", call("abs", "-4"))
+	assert.Equal(t, "", call("abs", "four"))
+	assert.Equal(t, "b", call("coalesce", "", "b", "c"))
+	assert.Equal(t, "", call("nullif", "None", "none"))
+	assert.Equal(t, "a", call("nullif", "a", "none"))
+}
+
+func TestCheckFunction(t *testing.T) {
+
+	assert.Nil(t, CheckFunction("substr", 3))
+	assert.Nil(t, CheckFunction("concat", 5))
+	assert.EqualError(t, CheckFunction("nope", 1), "unknown function 'nope'")
+	assert.EqualError(t, CheckFunction("lower", 2), "'lower' needs 1 argument")
+	assert.EqualError(t, CheckFunction("substr", 1), "'substr' needs 2 or 3 arguments")
+	assert.EqualError(t, CheckFunction("coalesce", 0), "'coalesce' needs at least 1 argument")
+	assert.EqualError(t, CheckFunction("now", 1), "'now' doesn't take any arguments")
+}
+
+func TestDatesWithoutATimeZoneAreInTimeZone(t *testing.T) {
+
+	london, err := time.LoadLocation("Europe/London")
+	assert.Nil(t, err)
+
+	TimeZone = london
+	now = func() time.Time { return time.Date(2022, 6, 30, 23, 30, 0, 0, time.UTC) }
+	defer func() { TimeZone, now = time.UTC, time.Now }()
+
+	// It's already July 1st in London (which is an hour ahead in the summer)
+	assert.Equal(t, "2022-06-30T23:00:00Z", call("current_date"))
+	assert.Equal(t, "2022-06-30T23:00:00Z", call("dateliteral", "2022-07-01"))
+	assert.Equal(t, "2022-07-01T08:00:00Z", call("timestampliteral", "2022-07-01 09:00:00"))
+	assert.Equal(t, "2022-07-01T09:00:00Z", call("timestampliteral", "2022-07-01 09:00:00Z"))
+	assert.Equal(t, "2022-06-30T23:00:00Z", call("date_trunc", "month", "2022-07-15T12:00:00Z"))
+	assert.Equal(t, "00:30", call("format_date", call("now"), "%H:%i"))
+	assert.Equal(t, "08:30", call("format_date", call("now"), "%H:%i", "Asia/Tokyo"))
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Filters' patterns are compiled the first time they're used, rather than for every row.
+// Queries only use a few, so the cache is just emptied if it gets big
+var patterns = struct {
+	sync.Mutex
+	compiled map[patternKey]*regexp.Regexp
+}{compiled: make(map[patternKey]*regexp.Regexp)}
+
+const maxCachedPatterns = 1000
+
+type patternKey struct {
+	pattern       string
+	like          bool
+	caseSensitive bool
+}
+
+// Compiles a 'like' pattern or regex, or returns nil if it isn't valid
+func compiledPattern(pattern string, like bool, caseSensitive bool) *regexp.Regexp {
+	key := patternKey{pattern, like, caseSensitive}
+
+	patterns.Lock()
+	defer patterns.Unlock()
+
+	if regex, found := patterns.compiled[key]; found {
+		return regex
+	}
+
+	if like {
+		pattern = likeToRegex(pattern)
+	}
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		regex = nil
+	}
+
+	if len(patterns.compiled) >= maxCachedPatterns {
+		patterns.compiled = make(map[patternKey]*regexp.Regexp)
+	}
+	patterns.compiled[key] = regex
+	return regex
+}
+
+// Turns a 'like' pattern in to a regex that matches the same text. '%' is any
+// number of characters, '_' is exactly one, and '\' makes a '%', '_' or '\' after it match
+// itself. Everything else matches itself, including a '\' before anything else, as DevOps
+// folders start with one (e.g. '\prod%')
+func likeToRegex(pattern string) string {
+	var result strings.Builder
+	result.WriteString("(?s)^")
+
+	for index := 0; index < len(pattern); index++ {
+		switch char := pattern[index]; {
+		case char == '\\' && index+1 < len(pattern) && isLikeEscapable(pattern[index+1]):
+			index++
+			result.WriteString(regexp.QuoteMeta(pattern[index : index+1]))
+		case char == '%':
+			result.WriteString(".*")
+		case char == '_':
+			result.WriteString(".")
+		default:
+			result.WriteString(regexp.QuoteMeta(pattern[index : index+1]))
+		}
+	}
+
+	result.WriteString("$")
+	return result.String()
+}
+
+// Whether a '\' before the character makes it match itself
+func isLikeEscapable(char byte) bool {
+	return char == '%' || char == '_' || char == '\\'
+}
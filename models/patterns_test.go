@@ -0,0 +1,43 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLikeToRegex(t *testing.T) {
+
+	assert.Equal(t, `(?s)^deploy.*$`, likeToRegex("deploy%"))
+	assert.Equal(t, `(?s)^a.b\.c\(d\)\+$`, likeToRegex("a_b.c(d)+"))
+	assert.Equal(t, `(?s)^100%_\\$`, likeToRegex(`100\%\_\\`))
+
+	// A '\' at the end or before anything else doesn't escape anything, so it's just a '\'
+	assert.Equal(t, `(?s)^a\\$`, likeToRegex(`a\`))
+	assert.Equal(t, `(?s)^\\prod.*$`, likeToRegex(`\prod%`))
+}
+
+// DevOps folders start with a '\'
+func TestLikeMatchesFolders(t *testing.T) {
+
+	results := ResultTable{
+		{"folder": `\prod\web`},
+		{"folder": `\prod`},
+		{"folder": `\test\prod`},
+		{"folder": `prod`},
+	}
+
+	results = (&QueryFilter{Type: "like", FieldName: "folder", Value: `\prod%`}).Filter(results)
+
+	assert.Equal(t, ResultTable{{"folder": `\prod\web`}, {"folder": `\prod`}}, results)
+}
+
+func TestPatternsAreOnlyCompiledOnce(t *testing.T) {
+
+	first := compiledPattern("deploy%", true, false)
+	second := compiledPattern("deploy%", true, false)
+
+	assert.Same(t, first, second)
+	assert.NotSame(t, first, compiledPattern("deploy%", true, true))
+	assert.Nil(t, compiledPattern("(unclosed", false, false))
+}
@@ -3,12 +3,119 @@ package models
 type Query struct {
 	SchemaName string
 	Table      string
+	Alias      string // e.g. 'b' in 'from devops.builds b'. Empty if there isn't one
+	Subquery   *Query // A query used as the table, e.g. 'from (select ...) recent'. Table is empty if there is one
 	Columns    []string
+	Distinct   bool // Only return one of each row
 	Limit      int
+	Offset     int // How many rows to skip before the ones returned, e.g. 'limit 10 offset 20'
 	Filters    []QueryFilter
+
+	// How to work out the selected columns that aren't just a column of the table or an
+	// aggregate, by their name in Columns, e.g. 'pipeline' for 'name as pipeline'
+	Expressions map[string]Expression
+
+	Joins      []Join
+	GroupBy    []string
+	Aggregates []Aggregate // The aggregate functions used in the select list, which also appear in Columns by name
+	OrderBy    []OrderBy
+
+	// The window functions used in the select list or 'order by', which are worked out after
+	// any aggregates. Like aggregates, expressions use them by name
+	Windows []WindowFunction
+
+	// Other queries whose results are combined with this one's, e.g. 'union select ...'. When
+	// there are any, OrderBy, Limit and Offset apply to the combined results
+	SetOperations []SetOperation
+
+	// Named queries from a 'with' clause, which the rest of the query can use as tables
+	With []CommonTableExpression
+
+	// Describe how the query would run, rather than running it
+	Explain bool
+
+	// Run the query, and describe how it went rather than returning the results
+	Analyze bool
+
+	// A token from the results of the same query, to get the page after them rather than the first
+	Continuation string
+}
+
+// Join is another table joined on to the query, e.g. 'inner join devops.pipelines p on p.id = b.pipelineid'
+type Join struct {
+	Type       string // 'inner' or 'left'
+	SchemaName string
+	Table      string
+	Alias      string
+	Subquery   *Query // As for Query.Subquery
+
+	// The columns that must be equal for rows to be joined
+	On []JoinCondition
+
+	// Any other conditions in the 'on' clause, e.g. "p.folder = 'prod'"
+	Filters []QueryFilter
+}
+
+// SetOperation combines the results of a query with the results before it
+type SetOperation struct {
+	Type  string // 'union', 'unionall', 'intersect' or 'except'
+	Query Query
+}
+
+// CommonTableExpression is a named query from a 'with' clause, e.g. 'with recent as (select ...)'.
+// It's used like a table with no schema, e.g. 'from recent'
+type CommonTableExpression struct {
+	Name  string
+	Query Query
+}
+
+type JoinCondition struct {
+	LeftField  string
+	RightField string
+}
+
+// Aggregate is a function like 'count(*)' or 'sum(duration)' that combines the rows in each group
+type Aggregate struct {
+	Function  string // count, sum, min, max or avg
+	FieldName string // Empty for 'count(*)'
+	Distinct  bool   // Only use each value once, e.g. 'count(distinct result)'
+	Name      string // The name of the column in the results, e.g. 'count(*)'
+}
+
+// WindowFunction is worked out for each row from the other rows in its partition, e.g.
+// 'row_number() over (partition by pipeline order by finishtime desc)'
+type WindowFunction struct {
+	Function  string // row_number, rank, dense_rank, lag, lead, or an aggregate (count, sum, min, max or avg)
+	FieldName string // The column for lag, lead and aggregates. Empty for 'count(*)'
+	Offset    int    // How many rows back (lag) or forward (lead) to look
+	Default   string // The value lag and lead give when there's no row there
+
+	PartitionBy []string
+	OrderBy     []OrderBy // Aggregates are running totals if the window is ordered
+
+	Name string // The name of the column in the results, e.g. 'row_number() over (order by id)'
+}
+
+type OrderBy struct {
+	FieldName  string
+	Descending bool
 }
 
 type QueryResult struct {
 	Columns []string
-	Results ResultTable
+	Rows    RowIterator
+
+	// Works out the token for the next page once Rows has been read. Nil if the query
+	// doesn't have a limit
+	NextPage func() string
+}
+
+// ContinuationToken gives the token that returns the next page of results when it's
+// passed back with the same query. It's empty if there are no more, and should only be
+// asked for once the rows have been read
+func (r *QueryResult) ContinuationToken() string {
+	if r.NextPage == nil {
+		return ""
+	}
+	return r.NextPage()
 }
@@ -1,15 +1,97 @@
 package models
 
 import (
-	"regexp"
+	"strconv"
 	"strings"
+
+	"golang.org/x/exp/slices"
 )
 
 type QueryFilter struct {
-	Type      string // eq ('equal'), ne ('not equal'), 'regex', 'and', 'or'
-	FieldName string // The name of the field to check
-	Value     string // The value to compare against
+	Type      string        // eq ('equal'), ne ('not equal'), gt, ge, lt, le, 'like', 'notlike', 'regex', 'notregex', 'in', 'notin', 'exists', 'notexists', 'and', 'or'
+	FieldName string        // The name of the field to check
+	Value     string        // The value to compare against. For like/notlike it's the pattern, with '\' escaping '%' and '_'
+	Values    []string      // The list of values to compare against for in/notin nodes
 	Children  []QueryFilter // Inner conditions for and/or nodes
+
+	// What's compared instead of a field, e.g. "lower(name) = 'main'". FieldName is empty
+	// when this is set
+	Expression *Expression
+
+	// What's compared against instead of Value when it changes from row to row, e.g. the
+	// 'queuetime' in "finishtime > queuetime" or the 'lower(b)' in "a = lower(b)"
+	ValueExpression *Expression
+
+	// How text is compared: CaseSensitive or CaseInsensitive. When it's empty the engine
+	// uses the column's, which is case-insensitive unless the column is configured otherwise
+	Collation string
+
+	// The type of the literal Value (or Values) was written as: NumberValue, BoolValue, or
+	// empty for text. Numbers are compared as numbers, so 42 = '42.0', and bools match
+	// 'true' or '1' etc.
+	ValueType string
+
+	// The query that gives the values for in/notin nodes, or that has to return rows (or not)
+	// for exists/notexists nodes. The engine runs it first, and replaces the filter with one
+	// that doesn't need it
+	Subquery *Query
+}
+
+// The collations filters can use
+const (
+	CaseInsensitive = "ci"
+	CaseSensitive   = "cs"
+)
+
+// The types of literal values, other than text
+const (
+	NumberValue = "number"
+	BoolValue   = "bool"
+)
+
+// IsCaseSensitive says whether the filter tells 'Main' and 'main' apart
+func (f QueryFilter) IsCaseSensitive() bool {
+	return f.Collation == CaseSensitive
+}
+
+// WithCollation returns a copy of the filter, and its children, that compares text with
+// the collation
+func (f QueryFilter) WithCollation(collation string) QueryFilter {
+	f.Collation = collation
+	if f.Children != nil {
+		children := make([]QueryFilter, len(f.Children))
+		for index, child := range f.Children {
+			children[index] = child.WithCollation(collation)
+		}
+		f.Children = children
+	}
+	return f
+}
+
+// What each type of filter becomes when it's negated
+var negatedFilterTypes = map[string]string{
+	"eq": "ne", "ne": "eq",
+	"gt": "le", "le": "gt",
+	"ge": "lt", "lt": "ge",
+	"like": "notlike", "notlike": "like",
+	"regex": "notregex", "notregex": "regex",
+	"in": "notin", "notin": "in",
+	"exists": "notexists", "notexists": "exists",
+	"and": "or", "or": "and",
+}
+
+// Negated returns a filter that passes the rows this one doesn't, e.g. "not (a = 1 and b > 2)"
+// becomes "a != 1 or b <= 2". Missing values are empty text, so every row passes one or the other
+func (f QueryFilter) Negated() QueryFilter {
+	f.Type = negatedFilterTypes[f.Type]
+	if f.Children != nil {
+		children := make([]QueryFilter, len(f.Children))
+		for index, child := range f.Children {
+			children[index] = child.Negated()
+		}
+		f.Children = children
+	}
+	return f
 }
 
 func (f *QueryFilter) Filter(results ResultTable) ResultTable {
@@ -29,16 +111,34 @@ func (f *QueryFilter) rowPasses(row map[string]string) bool {
 	switch f.Type {
 
 	case "eq":
-		var target = strings.ToLower(f.Value)
-		return strings.ToLower(row[f.FieldName]) == target
+		return f.equal(f.fieldValue(row), f.value(row))
 
 	case "ne":
-		var target = strings.ToLower(f.Value)
-		return strings.ToLower(row[f.FieldName]) != target
+		return !f.equal(f.fieldValue(row), f.value(row))
+
+	case "gt":
+		return f.compare(f.fieldValue(row), f.value(row)) > 0
+
+	case "ge":
+		return f.compare(f.fieldValue(row), f.value(row)) >= 0
+
+	case "lt":
+		return f.compare(f.fieldValue(row), f.value(row)) < 0
+
+	case "le":
+		return f.compare(f.fieldValue(row), f.value(row)) <= 0
+
+	case "in":
+		return f.contains(f.Values, f.fieldValue(row))
+
+	case "notin":
+		return !f.contains(f.Values, f.fieldValue(row))
 
-	case "regex":
-		regex := regexp.MustCompile("(?i)" + f.Value)
-		return regex.MatchString(row[f.FieldName])
+	case "like", "regex":
+		return f.matches(f.fieldValue(row), f.value(row))
+
+	case "notlike", "notregex":
+		return !f.matches(f.fieldValue(row), f.value(row))
 
 	case "and":
 		passes := true
@@ -60,3 +160,320 @@ func (f *QueryFilter) rowPasses(row map[string]string) bool {
 
 	return false
 }
+
+func (f *QueryFilter) equal(a string, b string) bool {
+	switch f.ValueType {
+	case NumberValue:
+		comparison, bothNumbers := compareNumbers(a, b)
+		return bothNumbers && comparison == 0
+	case BoolValue:
+		aBool, aErr := strconv.ParseBool(a)
+		bBool, bErr := strconv.ParseBool(b)
+		return aErr == nil && bErr == nil && aBool == bBool
+	}
+
+	if f.IsCaseSensitive() {
+		return a == b
+	}
+	return strings.EqualFold(a, b)
+}
+
+func (f *QueryFilter) compare(a string, b string) int {
+	if f.IsCaseSensitive() {
+		return CompareValuesWithCase(a, b)
+	}
+	return CompareValues(a, b)
+}
+
+func (f *QueryFilter) contains(values []string, target string) bool {
+	if f.ValueType != "" {
+		return slices.IndexFunc(values, func(value string) bool { return f.equal(target, value) }) >= 0
+	}
+	if f.IsCaseSensitive() {
+		return slices.Contains(values, target)
+	}
+	return containsIgnoringCase(values, target)
+}
+
+// Whether the value matches the 'like' pattern or regex. A regex that isn't valid
+// doesn't match anything
+func (f *QueryFilter) matches(value string, pattern string) bool {
+	like := f.Type == "like" || f.Type == "notlike"
+	regex := compiledPattern(pattern, like, f.IsCaseSensitive())
+	return regex != nil && regex.MatchString(value)
+}
+
+// The value being compared, from the row's field or the expression
+func (f *QueryFilter) fieldValue(row map[string]string) string {
+	if f.Expression != nil {
+		return f.Expression.Evaluate(row)
+	}
+	return row[f.FieldName]
+}
+
+// The value it's compared against, which is worked out from the row if it isn't fixed
+func (f *QueryFilter) value(row map[string]string) string {
+	if f.ValueExpression != nil {
+		return f.ValueExpression.Evaluate(row)
+	}
+	return f.Value
+}
+
+// SplitConjuncts breaks the filters down in to the individual conditions that must all be true,
+// by flattening out any ANDs. e.g. "a and (b and c)" becomes [a, b, c]
+func SplitConjuncts(filters []QueryFilter) []QueryFilter {
+	var result []QueryFilter
+	for _, filter := range filters {
+		if filter.Type == "and" {
+			result = append(result, SplitConjuncts(filter.Children)...)
+		} else {
+			result = append(result, filter)
+		}
+	}
+	return result
+}
+
+// FieldNames returns every field the filters look at
+func FieldNames(filters []QueryFilter) []string {
+	var result []string
+	for _, filter := range filters {
+		if filter.FieldName != "" && !slices.Contains(result, filter.FieldName) {
+			result = append(result, filter.FieldName)
+		}
+
+		var fields []string
+		if filter.Expression != nil {
+			fields = filter.Expression.FieldNames()
+		}
+		if filter.ValueExpression != nil {
+			fields = append(fields, filter.ValueExpression.FieldNames()...)
+		}
+		for _, child := range append(fields, FieldNames(filter.Children)...) {
+			if !slices.Contains(result, child) {
+				result = append(result, child)
+			}
+		}
+	}
+	return result
+}
+
+// RenameFields returns a copy of the filter with each field renamed, including those
+// in its children and expression
+func (f QueryFilter) RenameFields(rename func(string) string) QueryFilter {
+	if f.FieldName != "" {
+		f.FieldName = rename(f.FieldName)
+	}
+
+	if f.Expression != nil {
+		expression := f.Expression.RenameFields(rename)
+		f.Expression = &expression
+	}
+
+	if f.ValueExpression != nil {
+		expression := f.ValueExpression.RenameFields(rename)
+		f.ValueExpression = &expression
+	}
+
+	if f.Children != nil {
+		children := make([]QueryFilter, len(f.Children))
+		for index, child := range f.Children {
+			children[index] = child.RenameFields(rename)
+		}
+		f.Children = children
+	}
+
+	return f
+}
+
+// ValuesForField works out whether the filters (which are implicitly ANDed together, like
+// the top level of a WHERE clause) restrict the given field to a known set of values, and
+// if so returns them.
+//
+// e.g. "project = 'a'", "project in ('a', 'b')" or "(project = 'a' or project = 'b') and name = 'c'"
+// all restrict 'project', whereas "project = 'a' or name = 'c'" doesn't
+func ValuesForField(filters []QueryFilter, fieldName string) ([]string, bool) {
+	return (&QueryFilter{Type: "and", Children: filters}).valuesForField(fieldName)
+}
+
+func (f *QueryFilter) valuesForField(fieldName string) ([]string, bool) {
+	switch f.Type {
+
+	case "eq":
+		if f.FieldName == fieldName && f.ValueExpression == nil {
+			return []string{f.Value}, true
+		}
+
+	case "in":
+		if f.FieldName == fieldName {
+			return distinctIgnoringCase(f.Values), true
+		}
+
+	case "and":
+		// Every child has to pass, so only the values allowed by all of the
+		// restricting children can match
+		var values []string
+		restricted := false
+		for _, child := range f.Children {
+			childValues, childRestricts := child.valuesForField(fieldName)
+			if !childRestricts {
+				continue
+			}
+
+			if !restricted {
+				values = childValues
+				restricted = true
+				continue
+			}
+
+			var intersection []string
+			for _, value := range values {
+				if containsIgnoringCase(childValues, value) {
+					intersection = append(intersection, value)
+				}
+			}
+			values = intersection
+		}
+		return values, restricted
+
+	case "or":
+		// Any child can pass, so every child has to restrict the field for the
+		// whole thing to be restricted
+		var values []string
+		for _, child := range f.Children {
+			childValues, childRestricts := child.valuesForField(fieldName)
+			if !childRestricts {
+				return nil, false
+			}
+			values = append(values, childValues...)
+		}
+		return distinctIgnoringCase(values), len(f.Children) > 0
+	}
+
+	return nil, false
+}
+
+// CompareValues compares two values as numbers if they both are, otherwise as text. Dates are
+// always written in ISO 8601 format (e.g. "2022-01-31T09:00:00Z"), so they sort correctly as text
+func CompareValues(a string, b string) int {
+	if comparison, bothNumbers := compareNumbers(a, b); bothNumbers {
+		return comparison
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// CompareValuesWithCase is CompareValues, but 'Main' and 'main' are different
+func CompareValuesWithCase(a string, b string) int {
+	if comparison, bothNumbers := compareNumbers(a, b); bothNumbers {
+		return comparison
+	}
+	return strings.Compare(a, b)
+}
+
+func compareNumbers(a string, b string) (int, bool) {
+	aNumber, aIsNumber := ParseNumber(a)
+	bNumber, bIsNumber := ParseNumber(b)
+	if !aIsNumber || !bIsNumber {
+		return 0, false
+	}
+
+	if aNumber < bNumber {
+		return -1, true
+	}
+	if aNumber > bNumber {
+		return 1, true
+	}
+	return 0, true
+}
+
+// String writes the filter out in roughly the same way as it would appear in SQL
+func (f QueryFilter) String() string {
+	field := f.FieldName
+	if f.Expression != nil {
+		field = f.Expression.String()
+	}
+	if f.IsCaseSensitive() {
+		field = "binary " + field
+	}
+
+	switch f.Type {
+	case "and", "or":
+		// With no children, 'and' is always true and 'or' is always false
+		if len(f.Children) == 0 && f.Type == "and" {
+			return "true"
+		}
+		if len(f.Children) == 0 {
+			return "false"
+		}
+
+		var children []string
+		for _, child := range f.Children {
+			children = append(children, child.String())
+		}
+		return "(" + strings.Join(children, " "+f.Type+" ") + ")"
+
+	case "in", "notin":
+		var values []string
+		for _, value := range f.Values {
+			values = append(values, f.literal(value))
+		}
+		operator := "in"
+		if f.Type == "notin" {
+			operator = "not in"
+		}
+		if f.Subquery != nil {
+			return field + " " + operator + " (subquery)"
+		}
+		return field + " " + operator + " (" + strings.Join(values, ", ") + ")"
+
+	case "exists":
+		return "exists (subquery)"
+
+	case "notexists":
+		return "not exists (subquery)"
+	}
+
+	if f.ValueExpression != nil {
+		return field + " " + filterOperators[f.Type] + " " + f.ValueExpression.String()
+	}
+	return field + " " + filterOperators[f.Type] + " " + f.literal(f.Value)
+}
+
+// Writes one of the filter's values as it would appear in SQL, e.g. 'main', 42 or true
+func (f QueryFilter) literal(value string) string {
+	if f.ValueType != "" {
+		return value
+	}
+	return "'" + value + "'"
+}
+
+var filterOperators = map[string]string{
+	"eq":       "=",
+	"ne":       "!=",
+	"gt":       ">",
+	"ge":       ">=",
+	"lt":       "<",
+	"le":       "<=",
+	"like":     "like",
+	"notlike":  "not like",
+	"regex":    "regexp",
+	"notregex": "not regexp",
+}
+
+func containsIgnoringCase(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func distinctIgnoringCase(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if !containsIgnoringCase(result, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -54,6 +54,44 @@ func TestMatchesReges(t *testing.T) {
 	assert.Equal(t, "saltpeter", results[1]["name"])
 }
 
+func TestLike(t *testing.T) {
+
+	results := ResultTable{
+		{"name": "deploy (prod)"},
+		{"name": "deploy.prod"},
+		{"name": "deploy_prod"},
+		{"name": "Deploy-Prod"},
+		{"name": "deploy 100%"},
+		{"name": "deploy\nprod"},
+	}
+
+	tests := []struct {
+		filter   QueryFilter
+		expected []string
+	}{
+		{QueryFilter{Type: "like", Value: "deploy_prod"}, []string{"deploy.prod", "deploy_prod", "Deploy-Prod", "deploy\nprod"}},
+		{QueryFilter{Type: "like", Value: `deploy\_prod`}, []string{"deploy_prod"}},
+		{QueryFilter{Type: "like", Value: "deploy (%)"}, []string{"deploy (prod)"}},
+		{QueryFilter{Type: "like", Value: "%.prod"}, []string{"deploy.prod"}},
+		{QueryFilter{Type: "like", Value: `%\%`}, []string{"deploy 100%"}},
+		{QueryFilter{Type: "like", Value: "deploy-%", Collation: CaseSensitive}, nil},
+		{QueryFilter{Type: "notlike", Value: "deploy%prod"}, []string{"deploy (prod)", "deploy 100%"}},
+		{QueryFilter{Type: "regex", Value: "^deploy[._]"}, []string{"deploy.prod", "deploy_prod"}},
+		{QueryFilter{Type: "notregex", Value: "prod"}, []string{"deploy 100%"}},
+		{QueryFilter{Type: "regex", Value: "(unclosed"}, nil},
+	}
+
+	for _, test := range tests {
+		test.filter.FieldName = "name"
+
+		var names []string
+		for _, row := range test.filter.Filter(results) {
+			names = append(names, row["name"])
+		}
+		assert.Equal(t, test.expected, names, test.filter.String())
+	}
+}
+
 func TestAnd(t *testing.T) {
 
 	results := ResultTable{
@@ -98,3 +136,362 @@ func TestOr(t *testing.T) {
 	assert.Equal(t, "Peter", results[0]["name"])
 	assert.Equal(t, "Bob Dole", results[1]["name"])
 }
+
+func TestIn(t *testing.T) {
+
+	results := ResultTable{
+		{"name": "Peter", "age": "30"},
+		{"name": "Bob Dole", "age": "30"},
+		{"name": "saltpeter", "age": "19"},
+		{"name": "sally field", "age": "40"},
+	}
+
+	results = (&QueryFilter{Type: "in", FieldName: "name", Values: []string{"peter", "Sally Field"}}).Filter(results)
+
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, "Peter", results[0]["name"])
+	assert.Equal(t, "sally field", results[1]["name"])
+}
+
+func TestNotIn(t *testing.T) {
+
+	results := ResultTable{
+		{"name": "Peter", "age": "30"},
+		{"name": "Bob Dole", "age": "30"},
+		{"name": "saltpeter", "age": "19"},
+		{"name": "sally field", "age": "40"},
+	}
+
+	results = (&QueryFilter{Type: "notin", FieldName: "name", Values: []string{"peter", "Sally Field"}}).Filter(results)
+
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, "Bob Dole", results[0]["name"])
+	assert.Equal(t, "saltpeter", results[1]["name"])
+}
+
+func TestComparesNumbersAsNumbers(t *testing.T) {
+
+	results := ResultTable{
+		{"name": "bob", "age": "30"},
+		{"name": "alice", "age": "100"},
+		{"name": "herbert", "age": "9"},
+	}
+
+	results = (&QueryFilter{Type: "gt", FieldName: "age", Value: "10"}).Filter(results)
+
+	assert.Equal(t, ResultTable{{"name": "bob", "age": "30"}, {"name": "alice", "age": "100"}}, results)
+}
+
+// Go reads these as numbers too, but they're names here
+func TestOnlyComparesDecimalNumbersAsNumbers(t *testing.T) {
+
+	assert.Equal(t, 1, CompareValues("nan", "5"))
+	assert.Equal(t, -1, CompareValues("NaN", "NaN2"))
+	assert.Equal(t, -1, CompareValues("Inf", "nan"))
+	assert.Equal(t, -1, CompareValues("infinity", "j"))
+	assert.Equal(t, -1, CompareValues("0x1p4", "9"))
+	assert.Equal(t, -1, CompareValues("1e999", "2"))
+	assert.Equal(t, 1, CompareValues("1e3", "999"))
+	assert.Equal(t, -1, CompareValues("-.5", "0"))
+
+	results := ResultTable{{"name": "nan"}, {"name": "5"}}
+	results = (&QueryFilter{Type: "eq", FieldName: "name", Value: "5"}).Filter(results)
+	assert.Equal(t, ResultTable{{"name": "5"}}, results)
+}
+
+func TestNumberAndBoolValues(t *testing.T) {
+
+	results := ResultTable{
+		{"id": "42", "enabled": "true", "folder": ""},
+		{"id": "42.0", "enabled": "1", "folder": "prod"},
+		{"id": "7", "enabled": "false", "folder": ""},
+	}
+
+	assert.Equal(t, 2, len((&QueryFilter{Type: "eq", FieldName: "id", Value: "42", ValueType: NumberValue}).Filter(results)))
+	assert.Equal(t, 1, len((&QueryFilter{Type: "eq", FieldName: "id", Value: "42"}).Filter(results)))
+	assert.Equal(t, 3, len((&QueryFilter{Type: "in", FieldName: "id", Values: []string{"7", "42"}, ValueType: NumberValue}).Filter(results)))
+	assert.Equal(t, 2, len((&QueryFilter{Type: "eq", FieldName: "enabled", Value: "true", ValueType: BoolValue}).Filter(results)))
+	assert.Equal(t, 1, len((&QueryFilter{Type: "ne", FieldName: "enabled", Value: "true", ValueType: BoolValue}).Filter(results)))
+	assert.Equal(t, 2, len((&QueryFilter{Type: "eq", FieldName: "folder", Value: ""}).Filter(results)))
+}
+
+func TestComparesWithOtherColumns(t *testing.T) {
+
+	results := ResultTable{
+		{"name": "deploy", "pattern": "dep%", "queued": "2022-01-01T09:00:00Z", "finished": "2022-01-01T10:00:00Z"},
+		{"name": "Test", "pattern": "test", "queued": "2022-01-01T09:00:00Z", "finished": "2022-01-01T08:00:00Z"},
+	}
+
+	queued := &Expression{Type: "column", FieldName: "queued"}
+	pattern := &Expression{Type: "column", FieldName: "pattern"}
+
+	assert.Equal(t, ResultTable{results[0]}, (&QueryFilter{Type: "gt", FieldName: "finished", ValueExpression: queued}).Filter(results))
+	assert.Equal(t, ResultTable{results[1]}, (&QueryFilter{Type: "le", FieldName: "finished", ValueExpression: queued}).Filter(results))
+	assert.Equal(t, results, (&QueryFilter{Type: "like", FieldName: "name", ValueExpression: pattern}).Filter(results))
+	assert.Equal(t, ResultTable{results[0]}, (&QueryFilter{Type: "like", FieldName: "name", ValueExpression: pattern, Collation: CaseSensitive}).Filter(results))
+
+	filter := QueryFilter{Type: "gt", FieldName: "finished", ValueExpression: queued}
+	assert.Equal(t, []string{"finished", "queued"}, FieldNames([]QueryFilter{filter}))
+	assert.Equal(t, "b.finished > b.queued", filter.RenameFields(func(field string) string { return "b." + field }).String())
+
+	// The values of the field aren't known until the rows are read
+	_, restricted := ValuesForField([]QueryFilter{{Type: "eq", FieldName: "name", ValueExpression: pattern}}, "name")
+	assert.False(t, restricted)
+}
+
+func TestComparesDates(t *testing.T) {
+
+	results := ResultTable{
+		{"finished": "2022-01-01T09:00:00Z"},
+		{"finished": "2022-01-02T09:00:00Z"},
+		{"finished": "2022-01-03T09:00:00Z"},
+	}
+
+	assert.Equal(t, 2, len((&QueryFilter{Type: "ge", FieldName: "finished", Value: "2022-01-02T09:00:00Z"}).Filter(results)))
+	assert.Equal(t, 1, len((&QueryFilter{Type: "gt", FieldName: "finished", Value: "2022-01-02T09:00:00Z"}).Filter(results)))
+	assert.Equal(t, 1, len((&QueryFilter{Type: "lt", FieldName: "finished", Value: "2022-01-02"}).Filter(results)))
+	assert.Equal(t, 2, len((&QueryFilter{Type: "le", FieldName: "finished", Value: "2022-01-02T09:00:00Z"}).Filter(results)))
+}
+
+func TestValuesForField(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		filters    []QueryFilter
+		values     []string
+		restricted bool
+	}{
+		{
+			"no filters",
+			[]QueryFilter{},
+			nil,
+			false,
+		},
+		{
+			"top-level equals",
+			[]QueryFilter{{Type: "eq", FieldName: "project", Value: "a"}},
+			[]string{"a"},
+			true,
+		},
+		{
+			"equals on another field",
+			[]QueryFilter{{Type: "eq", FieldName: "name", Value: "a"}},
+			nil,
+			false,
+		},
+		{
+			"not equals",
+			[]QueryFilter{{Type: "ne", FieldName: "project", Value: "a"}},
+			nil,
+			false,
+		},
+		{
+			"in list",
+			[]QueryFilter{{Type: "in", FieldName: "project", Values: []string{"a", "b", "A"}}},
+			[]string{"a", "b"},
+			true,
+		},
+		{
+			"nested and",
+			[]QueryFilter{
+				{
+					Type: "and",
+					Children: []QueryFilter{
+						{Type: "eq", FieldName: "name", Value: "x"},
+						{
+							Type: "and",
+							Children: []QueryFilter{
+								{Type: "eq", FieldName: "project", Value: "a"},
+								{Type: "eq", FieldName: "folder", Value: "y"},
+							},
+						},
+					},
+				},
+			},
+			[]string{"a"},
+			true,
+		},
+		{
+			"and of two restrictions intersects them",
+			[]QueryFilter{
+				{Type: "in", FieldName: "project", Values: []string{"a", "b"}},
+				{Type: "in", FieldName: "project", Values: []string{"B", "c"}},
+			},
+			[]string{"b"},
+			true,
+		},
+		{
+			"or of equalities",
+			[]QueryFilter{
+				{
+					Type: "or",
+					Children: []QueryFilter{
+						{Type: "eq", FieldName: "project", Value: "a"},
+						{Type: "in", FieldName: "project", Values: []string{"b", "c"}},
+					},
+				},
+			},
+			[]string{"a", "b", "c"},
+			true,
+		},
+		{
+			"or where one side doesn't restrict",
+			[]QueryFilter{
+				{
+					Type: "or",
+					Children: []QueryFilter{
+						{Type: "eq", FieldName: "project", Value: "a"},
+						{Type: "eq", FieldName: "name", Value: "b"},
+					},
+				},
+			},
+			nil,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		values, restricted := ValuesForField(test.filters, "project")
+		assert.Equal(t, test.values, values, "Test '"+test.name+"' failed")
+		assert.Equal(t, test.restricted, restricted, "Test '"+test.name+"' failed")
+	}
+}
+
+func TestSplitConjuncts(t *testing.T) {
+
+	a := QueryFilter{Type: "eq", FieldName: "a", Value: "1"}
+	b := QueryFilter{Type: "eq", FieldName: "b", Value: "2"}
+	c := QueryFilter{Type: "eq", FieldName: "c", Value: "3"}
+	bOrC := QueryFilter{Type: "or", Children: []QueryFilter{b, c}}
+
+	filters := []QueryFilter{
+		{Type: "and", Children: []QueryFilter{
+			a,
+			{Type: "and", Children: []QueryFilter{b, c}},
+		}},
+		bOrC,
+	}
+
+	assert.Equal(t, []QueryFilter{a, b, c, bOrC}, SplitConjuncts(filters))
+}
+
+func TestFieldNames(t *testing.T) {
+
+	filters := []QueryFilter{
+		{Type: "eq", FieldName: "a", Value: "1"},
+		{Type: "or", Children: []QueryFilter{
+			{Type: "eq", FieldName: "b", Value: "2"},
+			{Type: "in", FieldName: "a", Values: []string{"3"}},
+		}},
+	}
+
+	assert.Equal(t, []string{"a", "b"}, FieldNames(filters))
+}
+
+func TestFilterString(t *testing.T) {
+
+	filter := QueryFilter{Type: "or", Children: []QueryFilter{
+		{Type: "ge", FieldName: "started", Value: "2022-01-01"},
+		{Type: "notin", FieldName: "name", Values: []string{"a", "b"}},
+	}}
+
+	assert.Equal(t, "(started >= '2022-01-01' or name not in ('a', 'b'))", filter.String())
+
+	filter = QueryFilter{Type: "and", Children: []QueryFilter{
+		{Type: "in", FieldName: "id", Values: []string{"1", "2"}, ValueType: NumberValue},
+		{Type: "eq", FieldName: "enabled", Value: "true", ValueType: BoolValue},
+	}}
+
+	assert.Equal(t, "(id in (1, 2) and enabled = true)", filter.String())
+}
+
+func TestFilterOnAnExpression(t *testing.T) {
+
+	results := ResultTable{
+		{"branch": "refs/heads/main"},
+		{"branch": "refs/heads/feature"},
+	}
+
+	filter := QueryFilter{Type: "eq", Value: "main", Expression: &Expression{
+		Type: "function", Function: "split_part",
+		Arguments: []Expression{{Type: "column", FieldName: "branch"}, {Type: "value", Value: "/"}, {Type: "value", Value: "3"}},
+	}}
+	results = filter.Filter(results)
+
+	assert.Equal(t, ResultTable{{"branch": "refs/heads/main"}}, results)
+	assert.Equal(t, []string{"branch"}, FieldNames([]QueryFilter{filter}))
+	assert.Equal(t, "split_part(branch, '/', 3) = 'main'", filter.String())
+}
+
+func TestCaseSensitiveFilters(t *testing.T) {
+
+	results := ResultTable{
+		{"branch": "Main"},
+		{"branch": "main"},
+		{"branch": "MAIN"},
+	}
+
+	tests := []struct {
+		filter   QueryFilter
+		expected ResultTable
+	}{
+		{QueryFilter{Type: "eq", FieldName: "branch", Value: "main", Collation: CaseSensitive}, ResultTable{{"branch": "main"}}},
+		{QueryFilter{Type: "ne", FieldName: "branch", Value: "main", Collation: CaseSensitive}, ResultTable{{"branch": "Main"}, {"branch": "MAIN"}}},
+		{QueryFilter{Type: "in", FieldName: "branch", Values: []string{"Main", "MAIN"}, Collation: CaseSensitive}, ResultTable{{"branch": "Main"}, {"branch": "MAIN"}}},
+		{QueryFilter{Type: "regex", FieldName: "branch", Value: "^ma", Collation: CaseSensitive}, ResultTable{{"branch": "main"}}},
+		{QueryFilter{Type: "gt", FieldName: "branch", Value: "Main", Collation: CaseSensitive}, ResultTable{{"branch": "main"}}},
+		{QueryFilter{Type: "eq", FieldName: "branch", Value: "main", Collation: CaseInsensitive}, results},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.filter.Filter(results), test.filter.String())
+	}
+}
+
+func TestWithCollation(t *testing.T) {
+
+	filter := QueryFilter{Type: "or", Children: []QueryFilter{
+		{Type: "eq", FieldName: "branch", Value: "Main"},
+		{Type: "regex", FieldName: "branch", Value: "^release/"},
+	}}
+
+	caseSensitive := filter.WithCollation(CaseSensitive)
+
+	assert.Equal(t, "(binary branch = 'Main' or binary branch regexp '^release/')", caseSensitive.String())
+	assert.Equal(t, "(branch = 'Main' or branch regexp '^release/')", filter.String())
+}
+
+func TestNegatedPassesEveryOtherRow(t *testing.T) {
+
+	results := ResultTable{
+		{"name": "Peter", "age": "30"},
+		{"name": "Bob Dole", "age": "9"},
+		{"name": "saltpeter"},
+		{"name": "sally field", "age": "40"},
+	}
+
+	filters := []QueryFilter{
+		{Type: "eq", FieldName: "name", Value: "peter"},
+		{Type: "gt", FieldName: "age", Value: "10", ValueType: NumberValue},
+		{Type: "like", FieldName: "name", Value: "%peter"},
+		{Type: "in", FieldName: "age", Values: []string{"9", ""}},
+		{Type: "or", Children: []QueryFilter{
+			{Type: "regex", FieldName: "name", Value: "^s"},
+			{Type: "and", Children: []QueryFilter{
+				{Type: "ge", FieldName: "age", Value: "30", ValueType: NumberValue},
+				{Type: "lt", FieldName: "age", Value: "40", ValueType: NumberValue},
+			}},
+		}},
+	}
+
+	for _, filter := range filters {
+		negated := filter.Negated()
+		passed := filter.Filter(results)
+		failed := negated.Filter(results)
+
+		assert.Equal(t, len(results), len(passed)+len(failed), filter.String())
+		for _, row := range failed {
+			assert.NotContains(t, passed, row, negated.String())
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package models
+
+import "io"
+
+// RowIterator hands out rows one at a time, so results can be streamed from the
+// APIs to the output without holding them all in memory.
+//
+// Next returns io.EOF once there are no more rows. Close should be called if the
+// caller stops reading before then, so the source can stop fetching
+type RowIterator interface {
+	Next() (map[string]string, error)
+	Close()
+}
+
+// Collect reads every remaining row from the iterator
+func Collect(rows RowIterator) (ResultTable, error) {
+	defer rows.Close()
+
+	result := ResultTable{}
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+		result = append(result, row)
+	}
+}
+
+// NewTableIterator iterates over rows that are already in memory
+func NewTableIterator(table ResultTable) RowIterator {
+	return &tableIterator{table: table}
+}
+
+type tableIterator struct {
+	table ResultTable
+}
+
+func (it *tableIterator) Next() (map[string]string, error) {
+	if len(it.table) == 0 {
+		return nil, io.EOF
+	}
+
+	row := it.table[0]
+	it.table = it.table[1:]
+	return row, nil
+}
+
+func (it *tableIterator) Close() {
+	it.table = nil
+}
+
+// NewErrorIterator returns the error as soon as it's read from, for when we can't
+// even start reading the rows
+func NewErrorIterator(err error) RowIterator {
+	return &errorIterator{err: err}
+}
+
+type errorIterator struct {
+	err error
+}
+
+func (it *errorIterator) Next() (map[string]string, error) {
+	return nil, it.err
+}
+
+func (it *errorIterator) Close() {}
+
+// NewConcatIterator returns the rows from each source in turn. The sources are only
+// created when they're needed, so if the caller stops early we never call the later ones
+func NewConcatIterator(sources []func() RowIterator) RowIterator {
+	return &concatIterator{sources: sources}
+}
+
+type concatIterator struct {
+	sources []func() RowIterator
+	current RowIterator
+}
+
+func (it *concatIterator) Next() (map[string]string, error) {
+	for {
+		if it.current == nil {
+			if len(it.sources) == 0 {
+				return nil, io.EOF
+			}
+			it.current = it.sources[0]()
+			it.sources = it.sources[1:]
+		}
+
+		row, err := it.current.Next()
+		if err == io.EOF {
+			it.current.Close()
+			it.current = nil
+			continue
+		}
+		return row, err
+	}
+}
+
+func (it *concatIterator) Close() {
+	if it.current != nil {
+		it.current.Close()
+		it.current = nil
+	}
+	it.sources = nil
+}
+
+// NewFilterIterator only returns the rows that pass all of the filters
+func NewFilterIterator(rows RowIterator, filters []QueryFilter) RowIterator {
+	if len(filters) == 0 {
+		return rows
+	}
+	return &filterIterator{rows: rows, filters: filters}
+}
+
+type filterIterator struct {
+	rows    RowIterator
+	filters []QueryFilter
+}
+
+func (it *filterIterator) Next() (map[string]string, error) {
+	for {
+		row, err := it.rows.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		passes := true
+		for _, filter := range it.filters {
+			if !filter.rowPasses(row) {
+				passes = false
+				break
+			}
+		}
+
+		if passes {
+			return row, nil
+		}
+	}
+}
+
+func (it *filterIterator) Close() {
+	it.rows.Close()
+}
+
+// NewColumnsIterator strips every column that isn't in the list from each row,
+// in the same way as OnlyColumns
+func NewColumnsIterator(rows RowIterator, columns []string) RowIterator {
+	if len(columns) == 0 {
+		return rows
+	}
+	return &columnsIterator{rows: rows, columns: columns}
+}
+
+type columnsIterator struct {
+	rows    RowIterator
+	columns []string
+}
+
+func (it *columnsIterator) Next() (map[string]string, error) {
+	row, err := it.rows.Next()
+	if err != nil {
+		return nil, err
+	}
+	return OnlyColumns(ResultTable{row}, it.columns)[0], nil
+}
+
+func (it *columnsIterator) Close() {
+	it.rows.Close()
+}
+
+// NewOffsetIterator skips the given number of rows before returning the rest
+func NewOffsetIterator(rows RowIterator, offset int) RowIterator {
+	return &offsetIterator{rows: rows, remaining: offset}
+}
+
+type offsetIterator struct {
+	rows      RowIterator
+	remaining int
+}
+
+func (it *offsetIterator) Next() (map[string]string, error) {
+	for ; it.remaining > 0; it.remaining-- {
+		if _, err := it.rows.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return it.rows.Next()
+}
+
+func (it *offsetIterator) Close() {
+	it.rows.Close()
+}
+
+// NewLimitIterator stops after the given number of rows, and closes the source
+// so it doesn't fetch anything else
+func NewLimitIterator(rows RowIterator, limit int) RowIterator {
+	return &limitIterator{rows: rows, remaining: limit}
+}
+
+type limitIterator struct {
+	rows      RowIterator
+	remaining int
+}
+
+func (it *limitIterator) Next() (map[string]string, error) {
+	if it.remaining <= 0 {
+		it.rows.Close()
+		return nil, io.EOF
+	}
+
+	row, err := it.rows.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	it.remaining--
+	return row, nil
+}
+
+func (it *limitIterator) Close() {
+	it.rows.Close()
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectReadsEveryRow(t *testing.T) {
+
+	table := ResultTable{{"name": "bob"}, {"name": "alice"}}
+
+	results, err := Collect(NewTableIterator(table))
+
+	assert.Nil(t, err)
+	assert.Equal(t, table, results)
+}
+
+func TestConcatOnlyCreatesSourcesWhenNeeded(t *testing.T) {
+
+	created := 0
+	source := func() RowIterator {
+		created++
+		return NewTableIterator(ResultTable{{"name": "bob"}, {"name": "alice"}})
+	}
+
+	rows := NewConcatIterator([]func() RowIterator{source, source, source})
+
+	first, _ := rows.Next()
+	assert.Equal(t, "bob", first["name"])
+	assert.Equal(t, 1, created)
+
+	rows.Next()
+	rows.Next()
+	assert.Equal(t, 2, created)
+
+	results, _ := Collect(rows)
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, 3, created)
+}
+
+func TestFilterIteratorAppliesEveryFilter(t *testing.T) {
+
+	rows := NewFilterIterator(
+		NewTableIterator(ResultTable{
+			{"name": "bob", "age": "30"},
+			{"name": "alice", "age": "30"},
+			{"name": "bob", "age": "40"},
+		}),
+		[]QueryFilter{
+			{Type: "eq", FieldName: "name", Value: "bob"},
+			{Type: "eq", FieldName: "age", Value: "30"},
+		},
+	)
+
+	results, _ := Collect(rows)
+
+	assert.Equal(t, ResultTable{{"name": "bob", "age": "30"}}, results)
+}
+
+func TestColumnsIteratorRemovesOtherColumns(t *testing.T) {
+
+	rows := NewColumnsIterator(
+		NewTableIterator(ResultTable{{"name": "bob", "age": "30"}}),
+		[]string{"age"},
+	)
+
+	results, _ := Collect(rows)
+
+	assert.Equal(t, ResultTable{{"age": "30"}}, results)
+}
+
+func TestLimitIteratorStopsAndClosesSource(t *testing.T) {
+
+	source := &closeRecordingIterator{RowIterator: NewTableIterator(ResultTable{{"name": "bob"}, {"name": "alice"}})}
+	rows := NewLimitIterator(source, 1)
+
+	first, _ := rows.Next()
+	_, err := rows.Next()
+
+	assert.Equal(t, "bob", first["name"])
+	assert.Equal(t, io.EOF, err)
+	assert.True(t, source.closed)
+}
+
+type closeRecordingIterator struct {
+	RowIterator
+	closed bool
+}
+
+func (it *closeRecordingIterator) Close() {
+	it.closed = true
+	it.RowIterator.Close()
+}
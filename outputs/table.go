@@ -0,0 +1,121 @@
+package outputs
+
+import (
+	"devopsdb/models"
+	"devopsdb/utils"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TableWriter prints query results as a text table.
+//
+// Rows are printed in batches as they arrive rather than waiting for the whole result,
+// so the column widths are worked out from the rows seen so far. If a later batch needs
+// wider columns, the headers are printed again with the new widths
+type TableWriter struct {
+	Out       io.Writer
+	BatchSize int
+}
+
+func NewTableWriter(out io.Writer) *TableWriter {
+	return &TableWriter{
+		Out:       out,
+		BatchSize: 100,
+	}
+}
+
+func (w *TableWriter) Write(result *models.QueryResult) error {
+	defer result.Rows.Close()
+
+	columnSizes := make(map[string]int)
+	for _, column := range result.Columns {
+		columnSizes[column] = len(column)
+	}
+
+	total := 0
+	for {
+		batch, err := readBatch(result.Rows, w.BatchSize)
+		finished := err == io.EOF
+		if err != nil && !finished {
+			return err
+		}
+
+		if len(batch) > 0 {
+			if widenColumns(columnSizes, batch) || total == 0 {
+				w.writeHeaders(result.Columns, columnSizes)
+			}
+
+			for _, row := range batch {
+				w.writeRow(result.Columns, columnSizes, row)
+			}
+
+			total += len(batch)
+		}
+
+		if finished {
+			break
+		}
+	}
+
+	if total == 0 {
+		fmt.Fprintln(w.Out, "No results")
+		return nil
+	}
+
+	fmt.Fprintln(w.Out)
+	fmt.Fprintf(w.Out, "%v results\n", total)
+	return nil
+}
+
+func (w *TableWriter) writeHeaders(columns []string, columnSizes map[string]int) {
+	fmt.Fprintln(w.Out)
+
+	var headers []string
+	var underlines []string
+	for _, column := range columns {
+		headers = append(headers, utils.StrPad(column, columnSizes[column], " ", "RIGHT"))
+		underlines = append(underlines, strings.Repeat("-", columnSizes[column]))
+	}
+
+	fmt.Fprintln(w.Out, "| "+strings.Join(headers, " | ")+" |")
+	fmt.Fprintln(w.Out, "|-"+strings.Join(underlines, "-|-")+"-|")
+}
+
+func (w *TableWriter) writeRow(columns []string, columnSizes map[string]int, row map[string]string) {
+	var values []string
+	for _, column := range columns {
+		values = append(values, utils.StrPad(row[column], columnSizes[column], " ", "RIGHT"))
+	}
+
+	fmt.Fprintln(w.Out, "| "+strings.Join(values, " | ")+" |")
+}
+
+// Reads up to batchSize rows. Returns io.EOF (along with any rows read) once
+// there's nothing left
+func readBatch(rows models.RowIterator, batchSize int) (models.ResultTable, error) {
+	batch := models.ResultTable{}
+	for len(batch) < batchSize {
+		row, err := rows.Next()
+		if err != nil {
+			return batch, err
+		}
+		batch = append(batch, row)
+	}
+	return batch, nil
+}
+
+// Makes sure every column is wide enough for the rows, and returns whether any
+// of them had to change
+func widenColumns(columnSizes map[string]int, rows models.ResultTable) bool {
+	changed := false
+	for _, row := range rows {
+		for column, value := range row {
+			if size, found := columnSizes[column]; found && len(value) > size {
+				columnSizes[column] = len(value)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
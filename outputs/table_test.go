@@ -0,0 +1,74 @@
+package outputs
+
+import (
+	"bytes"
+	"devopsdb/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritesTable(t *testing.T) {
+
+	out := &bytes.Buffer{}
+
+	err := NewTableWriter(out).Write(&models.QueryResult{
+		Columns: []string{"name", "age"},
+		Rows: models.NewTableIterator(models.ResultTable{
+			{"name": "bob", "age": "30"},
+			{"name": "herbert", "age": "101"},
+		}),
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, `
+| name    | age |
+|---------|-----|
+| bob     | 30  |
+| herbert | 101 |
+
+2 results
+`, out.String())
+}
+
+func TestWritesHeadersAgainWhenColumnsWiden(t *testing.T) {
+
+	out := &bytes.Buffer{}
+
+	writer := NewTableWriter(out)
+	writer.BatchSize = 1
+
+	writer.Write(&models.QueryResult{
+		Columns: []string{"name"},
+		Rows: models.NewTableIterator(models.ResultTable{
+			{"name": "bob"},
+			{"name": "al"},
+			{"name": "herbert"},
+		}),
+	})
+
+	assert.Equal(t, `
+| name |
+|------|
+| bob  |
+| al   |
+
+| name    |
+|---------|
+| herbert |
+
+3 results
+`, out.String())
+}
+
+func TestWritesNoResults(t *testing.T) {
+
+	out := &bytes.Buffer{}
+
+	NewTableWriter(out).Write(&models.QueryResult{
+		Columns: []string{"name"},
+		Rows:    models.NewTableIterator(models.ResultTable{}),
+	})
+
+	assert.Equal(t, "No results\n", out.String())
+}
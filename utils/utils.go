@@ -1,6 +1,11 @@
 package utils
 
-import "golang.org/x/exp/constraints"
+import (
+	"math"
+	"strings"
+
+	"golang.org/x/exp/constraints"
+)
 
 func Min[T constraints.Ordered](args ...T) T {
 	min := args[0]
@@ -25,3 +30,40 @@ func Max[T constraints.Ordered](args ...T) T {
 func Foo() {
 
 }
+
+// StrPad returns the input string padded on the left, right or both sides using padType to the specified padding length padLength.
+//
+// Example:
+// input := "Codes";
+// StrPad(input, 10, " ", "RIGHT")        // produces "Codes     "
+// StrPad(input, 10, "-=", "LEFT")        // produces "=-=-=Codes"
+// StrPad(input, 10, "_", "BOTH")         // produces "__Codes___"
+// StrPad(input, 6, "___", "RIGHT")       // produces "Codes_"
+// StrPad(input, 3, "*", "RIGHT")         // produces "Codes"
+func StrPad(input string, padLength int, padString string, padType string) string {
+	var output string
+
+	inputLength := len(input)
+	padStringLength := len(padString)
+
+	if inputLength >= padLength {
+		return input
+	}
+
+	repeat := math.Ceil(float64(1) + (float64(padLength-padStringLength))/float64(padStringLength))
+
+	switch padType {
+	case "RIGHT":
+		output = input + strings.Repeat(padString, int(repeat))
+		output = output[:padLength]
+	case "LEFT":
+		output = strings.Repeat(padString, int(repeat)) + input
+		output = output[len(output)-padLength:]
+	case "BOTH":
+		length := (float64(padLength - inputLength)) / float64(2)
+		repeat = math.Ceil(length / float64(padStringLength))
+		output = strings.Repeat(padString, int(repeat))[:int(math.Floor(float64(length)))] + input + strings.Repeat(padString, int(repeat))[:int(math.Ceil(float64(length)))]
+	}
+
+	return output
+}